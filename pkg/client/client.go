@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/ecadlabs/tezos-grafana-datasource/pkg/model"
@@ -27,6 +28,21 @@ type Client struct {
 	URL    string
 	Chain  string
 	Client *http.Client
+	// Lenient enables accepting JSON fields unknown to the model. Otherwise they cause decoding errors
+	Lenient bool
+	// UnknownFields collects unknown fields seen in lenient mode if not nil
+	UnknownFields *UnknownFields
+	// Retry is a retry policy. DefaultRetryPolicy is used if nil
+	Retry *RetryPolicy
+	// Breaker is an optional circuit breaker shared by requests to the same endpoint
+	Breaker *CircuitBreaker
+	// Endpoints lists additional node URLs used for failover
+	Endpoints []string
+	// MaxHeadLag is a number of levels an endpoint may lag behind the most up to date one before being deprioritized
+	MaxHeadLag int64
+
+	epMtx   sync.Mutex
+	epState map[string]*endpointState
 }
 
 func (c *Client) chain() string {
@@ -43,26 +59,154 @@ func (c *Client) client() *http.Client {
 	return http.DefaultClient
 }
 
-func (c *Client) do(r *http.Request) (io.ReadCloser, error) {
-	res, err := c.client().Do(r)
+// streamClient returns a client suitable for long lived streaming responses. The overall request timeout would break them
+func (c *Client) streamClient() *http.Client {
+	cl := c.client()
+	if cl.Timeout == 0 {
+		return cl
+	}
+	tmp := *cl
+	tmp.Timeout = 0
+	return &tmp
+}
+
+func (c *Client) retryPolicy() *RetryPolicy {
+	if c.Retry != nil {
+		return c.Retry
+	}
+	return &DefaultRetryPolicy
+}
+
+// attempt sends the request to the endpoint and updates the endpoint's state. retryable reports whether the failure is worth retrying
+func (c *Client) attempt(client *http.Client, r *http.Request, endpoint string, policy *RetryPolicy) (body io.ReadCloser, retryable bool, delay time.Duration, err error) {
+	req, err := c.rebase(r, endpoint)
 	if err != nil {
-		return nil, err
+		return nil, false, 0, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		if r.Context().Err() != nil {
+			// cancelled by the caller, not the endpoint's fault
+			c.Breaker.report(endpoint, true, time.Now())
+			return nil, false, 0, err
+		}
+		c.Breaker.report(endpoint, false, time.Now())
+		c.reportEndpoint(endpoint, err)
+		return nil, true, 0, err
 	}
 
-	if res.StatusCode/100 != 2 {
-		defer res.Body.Close()
-		body, err := io.ReadAll(res.Body)
-		if err != nil {
-			return nil, err
+	if res.StatusCode/100 == 2 {
+		c.Breaker.report(endpoint, true, time.Now())
+		c.reportEndpoint(endpoint, nil)
+		return res.Body, false, 0, nil
+	}
+
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, false, 0, err
+	}
+	httpErr := &HTTPError{
+		StatusCode: res.StatusCode,
+		Status:     res.Status,
+		Body:       data,
+	}
+	retryable = policy.retryableStatus(res.StatusCode)
+	if retryable || res.StatusCode/100 == 5 {
+		c.Breaker.report(endpoint, false, time.Now())
+		c.reportEndpoint(endpoint, httpErr)
+	} else {
+		c.Breaker.report(endpoint, true, time.Now())
+		c.reportEndpoint(endpoint, nil)
+	}
+	return nil, retryable, retryAfter(res.Header, time.Now()), httpErr
+}
+
+func (c *Client) do(r *http.Request) (io.ReadCloser, error) {
+	return c.doWith(c.client(), r)
+}
+
+// doWith sends the request to the most preferable endpoint failing over to the other ones and retrying according to the policy
+func (c *Client) doWith(client *http.Client, r *http.Request) (io.ReadCloser, error) {
+	policy := c.retryPolicy()
+	stats := RetryStatsFromContext(r.Context())
+	canRetry := idempotent(r.Method) && r.Body == nil
+
+	var (
+		lastErr   error
+		lastDelay time.Duration
+		tried     = make(map[string]bool)
+	)
+	for retries := 0; ; {
+		var endpoint string
+		for _, u := range c.candidates() {
+			if !tried[u] && c.Breaker.allow(u, time.Now()) {
+				endpoint = u
+				break
+			}
 		}
-		return nil, &HTTPError{
-			StatusCode: res.StatusCode,
-			Status:     res.Status,
-			Body:       body,
+
+		if endpoint == "" {
+			if len(tried) == 0 {
+				return nil, fmt.Errorf("%s: %w", c.URL, ErrCircuitOpen)
+			}
+			// all available endpoints failed
+			if retries >= policy.MaxRetries {
+				return nil, lastErr
+			}
+			delay := policy.backoff(retries)
+			if lastDelay > delay {
+				delay = lastDelay
+			}
+			t := time.NewTimer(delay)
+			select {
+			case <-t.C:
+			case <-r.Context().Done():
+				t.Stop()
+				return nil, r.Context().Err()
+			}
+			retries++
+			tried = make(map[string]bool)
+			continue
 		}
+
+		if lastErr != nil && stats != nil {
+			stats.inc()
+		}
+		body, retryable, delay, err := c.attempt(client, r, endpoint, policy)
+		if err == nil {
+			return body, nil
+		}
+		if !retryable || !canRetry {
+			return nil, err
+		}
+		tried[endpoint] = true
+		lastErr, lastDelay = err, delay
+	}
+}
+
+func (c *Client) NewGetChainIDRequest(ctx context.Context) (*http.Request, error) {
+	u := fmt.Sprintf("%s/chains/%s/chain_id", c.URL, c.chain())
+	return http.NewRequestWithContext(ctx, "GET", u, nil)
+}
+
+func (c *Client) GetChainID(ctx context.Context) (model.Base58, error) {
+	req, err := c.NewGetChainIDRequest(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getChainID: %w", err)
 	}
+	res, err := c.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("getChainID: %w", err)
+	}
+	defer res.Close()
 
-	return res.Body, nil
+	var v model.Base58
+	dec := json.NewDecoder(res)
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("getChainID: %w", err)
+	}
+	return v, nil
 }
 
 func (c *Client) NewGetBlockHeaderRequest(ctx context.Context, blockID string) (*http.Request, error) {
@@ -82,9 +226,7 @@ func (c *Client) GetBlockHeader(ctx context.Context, blockID string) (*model.Blo
 	defer res.Close()
 
 	var v model.BlockHeader
-	dec := json.NewDecoder(res)
-	dec.DisallowUnknownFields()
-	if err := dec.Decode(&v); err != nil {
+	if err := c.decode(res, &v, "header"); err != nil {
 		return nil, fmt.Errorf("getBlockHeader: %w", err)
 	}
 	return &v, nil
@@ -107,21 +249,53 @@ func (c *Client) GetBlock(ctx context.Context, blockID string) (*model.Block, er
 	defer res.Close()
 
 	var v model.Block
-	dec := json.NewDecoder(res)
-	dec.DisallowUnknownFields()
-	if err := dec.Decode(&v); err != nil {
+	if err := c.decode(res, &v, "block"); err != nil {
 		return nil, fmt.Errorf("getBlock: %w", err)
 	}
 	return &v, nil
 }
 
-func (c *Client) NewGetProtocolConstantsRequest(ctx context.Context) (*http.Request, error) {
-	u := fmt.Sprintf("%s/chains/%s/blocks/head/context/constants", c.URL, c.chain())
+func (c *Client) NewGetBlockHashesRequest(ctx context.Context, head string, length int) (*http.Request, error) {
+	u, err := url.Parse(fmt.Sprintf("%s/chains/%s/blocks", c.URL, c.chain()))
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = url.Values{
+		"head":   []string{head},
+		"length": []string{strconv.FormatInt(int64(length), 10)},
+	}.Encode()
+	return http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+}
+
+// GetBlockHashes returns hashes of length blocks down from head, head first
+func (c *Client) GetBlockHashes(ctx context.Context, head string, length int) ([]model.Base58, error) {
+	req, err := c.NewGetBlockHashesRequest(ctx, head, length)
+	if err != nil {
+		return nil, fmt.Errorf("getBlockHashes: %w", err)
+	}
+	res, err := c.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("getBlockHashes: %w", err)
+	}
+	defer res.Close()
+
+	var v [][]model.Base58
+	if err := c.decode(res, &v, "block_hashes"); err != nil {
+		return nil, fmt.Errorf("getBlockHashes: %w", err)
+	}
+	if len(v) == 0 {
+		return nil, nil
+	}
+	return v[0], nil
+}
+
+func (c *Client) NewGetProtocolConstantsRequest(ctx context.Context, blockID string) (*http.Request, error) {
+	u := fmt.Sprintf("%s/chains/%s/blocks/%s/context/constants", c.URL, c.chain(), blockID)
 	return http.NewRequestWithContext(ctx, "GET", u, nil)
 }
 
-func (c *Client) GetProtocolConstants(ctx context.Context) (*model.ProtocolConstants, error) {
-	req, err := c.NewGetProtocolConstantsRequest(ctx)
+func (c *Client) GetProtocolConstants(ctx context.Context, blockID string) (*model.ProtocolConstants, error) {
+	req, err := c.NewGetProtocolConstantsRequest(ctx, blockID)
 	if err != nil {
 		return nil, fmt.Errorf("getProtocolConstants: %w", err)
 	}
@@ -132,9 +306,7 @@ func (c *Client) GetProtocolConstants(ctx context.Context) (*model.ProtocolConst
 	defer res.Close()
 
 	var v model.ProtocolConstants
-	dec := json.NewDecoder(res)
-	dec.DisallowUnknownFields()
-	if err := dec.Decode(&v); err != nil {
+	if err := c.decode(res, &v, "constants"); err != nil {
 		return nil, fmt.Errorf("getProtocolConstants: %w", err)
 	}
 	return &v, nil
@@ -157,9 +329,7 @@ func (c *Client) GetBlockOperations(ctx context.Context, blockID string) (model.
 	defer res.Close()
 
 	var v model.BlockOperations
-	dec := json.NewDecoder(res)
-	dec.DisallowUnknownFields()
-	if err := dec.Decode(&v); err != nil {
+	if err := c.decode(res, &v, "operations"); err != nil {
 		return nil, fmt.Errorf("getBlockOperations: %w", err)
 	}
 	return v, nil
@@ -188,15 +358,150 @@ func (c *Client) GetMinimalValidTime(ctx context.Context, blockID string, priori
 	}
 	defer res.Close()
 
-	dec := json.NewDecoder(res)
-	dec.DisallowUnknownFields()
 	var t time.Time
-	if err = dec.Decode(&t); err != nil {
+	if err = c.decode(res, &t, "minimal_valid_time"); err != nil {
 		return time.Time{}, fmt.Errorf("getMinimalValidTime: %w", err)
 	}
 	return t, nil
 }
 
+func (c *Client) NewGetCurrentLevelRequest(ctx context.Context, blockID string) (*http.Request, error) {
+	u := fmt.Sprintf("%s/chains/%s/blocks/%s/helpers/current_level", c.URL, c.chain(), blockID)
+	return http.NewRequestWithContext(ctx, "GET", u, nil)
+}
+
+func (c *Client) GetCurrentLevel(ctx context.Context, blockID string) (*model.LevelInfo, error) {
+	req, err := c.NewGetCurrentLevelRequest(ctx, blockID)
+	if err != nil {
+		return nil, fmt.Errorf("getCurrentLevel: %w", err)
+	}
+	res, err := c.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("getCurrentLevel: %w", err)
+	}
+	defer res.Close()
+
+	// older protocols include voting period data here
+	var v model.LegacyLevelInfo
+	if err := c.decode(res, &v, "current_level"); err != nil {
+		return nil, fmt.Errorf("getCurrentLevel: %w", err)
+	}
+	return &v.LevelInfo, nil
+}
+
+func (c *Client) NewGetCurrentPeriodRequest(ctx context.Context, blockID string) (*http.Request, error) {
+	u := fmt.Sprintf("%s/chains/%s/blocks/%s/votes/current_period", c.URL, c.chain(), blockID)
+	return http.NewRequestWithContext(ctx, "GET", u, nil)
+}
+
+// GetCurrentPeriod returns the voting period of the block. It's available since Florence
+func (c *Client) GetCurrentPeriod(ctx context.Context, blockID string) (*model.VotingPeriodInfo, error) {
+	req, err := c.NewGetCurrentPeriodRequest(ctx, blockID)
+	if err != nil {
+		return nil, fmt.Errorf("getCurrentPeriod: %w", err)
+	}
+	res, err := c.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("getCurrentPeriod: %w", err)
+	}
+	defer res.Close()
+
+	var v model.VotingPeriodInfo
+	if err := c.decode(res, &v, "current_period"); err != nil {
+		return nil, fmt.Errorf("getCurrentPeriod: %w", err)
+	}
+	return &v, nil
+}
+
+// RightsParams narrows down baking and endorsing rights requests
+type RightsParams struct {
+	Level    []int64
+	Cycle    []int64
+	Delegate []model.Base58
+	// MaxPriority and MaxRound are used by baking rights requests only. MaxRound replaces MaxPriority
+	// in Tenderbake based protocols
+	MaxPriority int
+	MaxRound    int
+	All         bool
+}
+
+func (p *RightsParams) values() url.Values {
+	v := make(url.Values)
+	for _, l := range p.Level {
+		v.Add("level", strconv.FormatInt(l, 10))
+	}
+	for _, c := range p.Cycle {
+		v.Add("cycle", strconv.FormatInt(c, 10))
+	}
+	for _, d := range p.Delegate {
+		v.Add("delegate", d.String())
+	}
+	if p.MaxPriority != 0 {
+		v.Set("max_priority", strconv.FormatInt(int64(p.MaxPriority), 10))
+	}
+	if p.MaxRound != 0 {
+		v.Set("max_round", strconv.FormatInt(int64(p.MaxRound), 10))
+	}
+	if p.All {
+		v.Set("all", "true")
+	}
+	return v
+}
+
+func (c *Client) NewGetBakingRightsRequest(ctx context.Context, blockID string, p *RightsParams) (*http.Request, error) {
+	u, err := url.Parse(fmt.Sprintf("%s/chains/%s/blocks/%s/helpers/baking_rights", c.URL, c.chain(), blockID))
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = p.values().Encode()
+	return http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+}
+
+func (c *Client) GetBakingRights(ctx context.Context, blockID string, p *RightsParams) ([]*model.BakingRight, error) {
+	req, err := c.NewGetBakingRightsRequest(ctx, blockID, p)
+	if err != nil {
+		return nil, fmt.Errorf("getBakingRights: %w", err)
+	}
+	res, err := c.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("getBakingRights: %w", err)
+	}
+	defer res.Close()
+
+	var v []*model.BakingRight
+	if err := c.decode(res, &v, "baking_rights"); err != nil {
+		return nil, fmt.Errorf("getBakingRights: %w", err)
+	}
+	return v, nil
+}
+
+func (c *Client) NewGetEndorsingRightsRequest(ctx context.Context, blockID string, p *RightsParams) (*http.Request, error) {
+	u, err := url.Parse(fmt.Sprintf("%s/chains/%s/blocks/%s/helpers/endorsing_rights", c.URL, c.chain(), blockID))
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = p.values().Encode()
+	return http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+}
+
+func (c *Client) GetEndorsingRights(ctx context.Context, blockID string, p *RightsParams) ([]*model.EndorsingRight, error) {
+	req, err := c.NewGetEndorsingRightsRequest(ctx, blockID, p)
+	if err != nil {
+		return nil, fmt.Errorf("getEndorsingRights: %w", err)
+	}
+	res, err := c.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("getEndorsingRights: %w", err)
+	}
+	defer res.Close()
+
+	var v model.EndorsingRightsEntries
+	if err := c.decode(res, &v, "endorsing_rights"); err != nil {
+		return nil, fmt.Errorf("getEndorsingRights: %w", err)
+	}
+	return v.Rights(), nil
+}
+
 func (c *Client) NewGetMonitorHeadsRequest(ctx context.Context) (*http.Request, error) {
 	u := fmt.Sprintf("%s/monitor/heads/%s", c.URL, c.chain())
 	return http.NewRequestWithContext(ctx, "GET", u, nil)
@@ -207,7 +512,7 @@ func (c *Client) GetMonitorHeads(ctx context.Context) (headerCh <-chan *model.Sh
 	if err != nil {
 		return nil, nil, fmt.Errorf("getMonitorHeads: %w", err)
 	}
-	res, err := c.do(req)
+	res, err := c.doWith(c.streamClient(), req)
 	if err != nil {
 		return nil, nil, fmt.Errorf("getMonitorHeads: %w", err)
 	}
@@ -223,15 +528,21 @@ func (c *Client) GetMonitorHeads(ctx context.Context) (headerCh <-chan *model.Sh
 		})()
 
 		dec := json.NewDecoder(res)
-		dec.DisallowUnknownFields()
 		for {
-			var v model.ShellBlockHeader
-			if err := dec.Decode(&v); err != nil {
+			var (
+				raw json.RawMessage
+				v   model.ShellBlockHeader
+			)
+			if err := dec.Decode(&raw); err != nil {
 				if err != io.EOF {
 					errCh <- err
 				}
 				return
 			}
+			if err := c.decodeBytes(raw, &v, "monitor_heads"); err != nil {
+				errCh <- err
+				return
+			}
 			select {
 			case hdrCh <- &v:
 			case <-ctx.Done():
@@ -242,3 +553,86 @@ func (c *Client) GetMonitorHeads(ctx context.Context) (headerCh <-chan *model.Sh
 	}()
 	return hdrCh, errCh, nil
 }
+
+func (c *Client) NewGetPendingOperationsRequest(ctx context.Context) (*http.Request, error) {
+	u := fmt.Sprintf("%s/chains/%s/mempool/pending_operations", c.URL, c.chain())
+	return http.NewRequestWithContext(ctx, "GET", u, nil)
+}
+
+func (c *Client) GetPendingOperations(ctx context.Context) (*model.PendingOperations, error) {
+	req, err := c.NewGetPendingOperationsRequest(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getPendingOperations: %w", err)
+	}
+	res, err := c.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("getPendingOperations: %w", err)
+	}
+	defer res.Close()
+
+	var v model.PendingOperations
+	if err := c.decode(res, &v, "pending_operations"); err != nil {
+		return nil, fmt.Errorf("getPendingOperations: %w", err)
+	}
+	return &v, nil
+}
+
+func (c *Client) NewGetMonitorOperationsRequest(ctx context.Context) (*http.Request, error) {
+	u, err := url.Parse(fmt.Sprintf("%s/chains/%s/mempool/monitor_operations", c.URL, c.chain()))
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = url.Values{
+		"applied":        []string{"true"},
+		"branch_delayed": []string{"true"},
+	}.Encode()
+	return http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+}
+
+// GetMonitorOperations streams batches of operations entering the mempool. The node ends the stream when the head changes
+func (c *Client) GetMonitorOperations(ctx context.Context) (opsCh <-chan []*model.MempoolOperation, errorsCh <-chan error, err error) {
+	req, err := c.NewGetMonitorOperationsRequest(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("getMonitorOperations: %w", err)
+	}
+	res, err := c.doWith(c.streamClient(), req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("getMonitorOperations: %w", err)
+	}
+
+	ch := make(chan []*model.MempoolOperation, 100)
+	errCh := make(chan error, 1)
+
+	go func() {
+		defer (func() {
+			res.Close()
+			close(ch)
+			close(errCh)
+		})()
+
+		dec := json.NewDecoder(res)
+		for {
+			var (
+				raw json.RawMessage
+				v   []*model.MempoolOperation
+			)
+			if err := dec.Decode(&raw); err != nil {
+				if err != io.EOF {
+					errCh <- err
+				}
+				return
+			}
+			if err := c.decodeBytes(raw, &v, "monitor_operations"); err != nil {
+				errCh <- err
+				return
+			}
+			select {
+			case ch <- v:
+			case <-ctx.Done():
+				errCh <- ctx.Err()
+				return
+			}
+		}
+	}()
+	return ch, errCh, nil
+}
@@ -0,0 +1,73 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/ecadlabs/tezos-grafana-datasource/pkg/model"
+)
+
+// UnknownFields counts occurrences of JSON fields unknown to the model by path
+type UnknownFields struct {
+	mtx    sync.Mutex
+	counts map[string]int64
+}
+
+func (u *UnknownFields) add(paths []string) {
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+	if u.counts == nil {
+		u.counts = make(map[string]int64)
+	}
+	for _, p := range paths {
+		u.counts[p]++
+	}
+}
+
+// Counts returns a copy of the collected counters
+func (u *UnknownFields) Counts() map[string]int64 {
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+	res := make(map[string]int64, len(u.counts))
+	for p, n := range u.counts {
+		res[p] = n
+	}
+	return res
+}
+
+func (c *Client) decode(r io.Reader, v interface{}, root string) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return c.decodeBytes(data, v, root)
+}
+
+// decodeBytes decodes the response and checks it for fields unknown to the model, including the ones the custom
+// unmarshalers skip. In strict mode unknown fields fail the decoding, in lenient mode they're counted by path
+// prefixed with root
+func (c *Client) decodeBytes(data []byte, v interface{}, root string) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+	unknown, err := model.UnknownFields(data, v)
+	if err != nil || len(unknown) == 0 {
+		return err
+	}
+	for i, p := range unknown {
+		if len(p) != 0 && p[0] == '[' {
+			unknown[i] = root + p
+		} else {
+			unknown[i] = root + "." + p
+		}
+	}
+	if !c.Lenient {
+		return fmt.Errorf("json: unknown field %q", unknown[0])
+	}
+	if c.UnknownFields != nil {
+		c.UnknownFields.add(unknown)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ecadlabs/tezos-grafana-datasource/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecode(t *testing.T) {
+	const src = `{"level": 1, "cycle": 0, "extra": {"x": 1}}`
+
+	strict := &Client{UnknownFields: new(UnknownFields)}
+	var v model.LevelInfo
+	assert.Error(t, strict.decode(strings.NewReader(src), &v, "level_info"))
+	assert.Error(t, strict.decodeBytes([]byte(src), &v, "level_info"))
+	assert.Empty(t, strict.UnknownFields.Counts())
+
+	lenient := &Client{Lenient: true, UnknownFields: new(UnknownFields)}
+	require.NoError(t, lenient.decode(strings.NewReader(src), &v, "level_info"))
+	require.NoError(t, lenient.decodeBytes([]byte(src), &v, "level_info"))
+	assert.Equal(t, int64(1), v.Level)
+	assert.Equal(t, map[string]int64{"level_info.extra": 2}, lenient.UnknownFields.Counts())
+}
+
+func TestDecodeStrictNested(t *testing.T) {
+	source := model.Base58{6, 161, 159, 2}
+	op := func(contentsField, updateField string) string {
+		return fmt.Sprintf(`{
+	"hash": "%[1]s",
+	"branch": "%[1]s",
+	"contents": [{
+		"kind": "transaction",
+		"source": "%[1]s",
+		"fee": "400",
+		"counter": "1",
+		"gas_limit": "1000",
+		"storage_limit": "0",
+		"amount": "1",
+		"destination": "%[1]s",%[2]s
+		"metadata": {"balance_updates": [{"kind": "contract", "contract": "%[1]s", "change": "-400", "origin": "block"%[3]s}],
+			"operation_result": {"status": "applied", "consumed_milligas": "1000000"}}
+	}]
+}`, source, contentsField, updateField)
+	}
+
+	strict := &Client{}
+	var v model.BlockOperation
+	require.NoError(t, strict.decode(strings.NewReader(op("", "")), &v, "operation"))
+
+	err := strict.decode(strings.NewReader(op(`"ticket_hash": "xyz",`, "")), &v, "operation")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "operation.contents[].ticket_hash")
+
+	err = strict.decode(strings.NewReader(op("", `, "reason": "fee"`)), &v, "operation")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "operation.contents[].metadata.balance_updates[].reason")
+}
+
+func TestCurrentLevel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/helpers/current_level"):
+			// older protocols include voting period data
+			w.Write([]byte(`{"level": 9, "level_position": 8, "cycle": 2, "cycle_position": 0, "voting_period": 1, "voting_period_position": 0, "expected_commitment": false}`))
+		case strings.HasSuffix(r.URL.Path, "/votes/current_period"):
+			w.Write([]byte(`{"voting_period": {"index": 1, "kind": "proposal", "start_position": 8}, "position": 0, "remaining": 7, "new_field": 1}`))
+		}
+	}))
+	defer srv.Close()
+
+	c := &Client{URL: srv.URL, UnknownFields: new(UnknownFields)}
+	level, err := c.GetCurrentLevel(context.Background(), "head")
+	require.NoError(t, err)
+	assert.Equal(t, &model.LevelInfo{Level: 9, LevelPosition: 8, Cycle: 2}, level)
+
+	// unknown fields are treated as in any other response
+	_, err = c.GetCurrentPeriod(context.Background(), "head")
+	assert.Error(t, err)
+	c.Lenient = true
+	period, err := c.GetCurrentPeriod(context.Background(), "head")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), period.VotingPeriod.Index)
+	assert.Equal(t, map[string]int64{"current_period.new_field": 1}, c.UnknownFields.Counts())
+}
@@ -0,0 +1,231 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EndpointStatus is a result of the last health check of an endpoint
+type EndpointStatus struct {
+	URL     string `json:"url"`
+	Healthy bool   `json:"healthy"`
+	// Level is the head level seen during the last check
+	Level int64 `json:"level"`
+	// Lag is a number of levels behind the most up to date endpoint
+	Lag       int64     `json:"lag"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+type endpointState struct {
+	checked bool
+	healthy bool
+	level   int64
+	err     error
+	at      time.Time
+}
+
+// endpoints returns the list of configured endpoints starting from the primary one
+func (c *Client) endpoints() []string {
+	res := make([]string, 0, 1+len(c.Endpoints))
+	seen := make(map[string]bool, cap(res))
+	for _, u := range append([]string{c.URL}, c.Endpoints...) {
+		u = strings.TrimRight(u, "/")
+		if u == "" || seen[u] {
+			continue
+		}
+		seen[u] = true
+		res = append(res, u)
+	}
+	return res
+}
+
+// bestLevel returns the highest head level among healthy endpoints. Must be called with the lock held
+func (c *Client) bestLevel() (level int64, ok bool) {
+	for _, s := range c.epState {
+		if s.checked && s.healthy && (!ok || s.level > level) {
+			level, ok = s.level, true
+		}
+	}
+	return
+}
+
+// candidates returns endpoints in order of preference: up to date healthy endpoints, then lagging ones, then failed ones.
+// Endpoints not checked yet are considered healthy
+func (c *Client) candidates() []string {
+	eps := c.endpoints()
+	if len(eps) < 2 {
+		return eps
+	}
+	c.epMtx.Lock()
+	defer c.epMtx.Unlock()
+	best, haveBest := c.bestLevel()
+	rank := func(u string) (int, int64) {
+		s, ok := c.epState[u]
+		if !ok || !s.checked {
+			if ok && !s.healthy {
+				return 2, 0
+			}
+			return 0, -1
+		}
+		if !s.healthy {
+			return 2, s.level
+		}
+		if haveBest && best-s.level > c.MaxHeadLag {
+			return 1, s.level
+		}
+		return 0, s.level
+	}
+	sort.SliceStable(eps, func(i, j int) bool {
+		ri, li := rank(eps[i])
+		rj, lj := rank(eps[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return li > lj
+	})
+	return eps
+}
+
+func (c *Client) reportEndpoint(u string, err error) {
+	if len(c.Endpoints) == 0 {
+		return
+	}
+	c.epMtx.Lock()
+	defer c.epMtx.Unlock()
+	if c.epState == nil {
+		c.epState = make(map[string]*endpointState)
+	}
+	s, ok := c.epState[u]
+	if !ok {
+		s = new(endpointState)
+		c.epState[u] = s
+	}
+	s.healthy = err == nil
+	s.err = err
+}
+
+// rebase returns a copy of the request pointed to the endpoint u.
+// The request is expected to be built against the primary URL
+func (c *Client) rebase(r *http.Request, u string) (*http.Request, error) {
+	base := strings.TrimRight(c.URL, "/")
+	if u == base {
+		return r, nil
+	}
+	s := r.URL.String()
+	if !strings.HasPrefix(s, base) {
+		return r, nil
+	}
+	nu, err := url.Parse(u + strings.TrimPrefix(s, base))
+	if err != nil {
+		return nil, err
+	}
+	req := r.Clone(r.Context())
+	req.URL = nu
+	req.Host = ""
+	return req, nil
+}
+
+func (c *Client) headLevel(ctx context.Context, u string) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/chains/%s/blocks/head/header", u, c.chain()), nil)
+	if err != nil {
+		return 0, err
+	}
+	res, err := c.client().Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return 0, &HTTPError{StatusCode: res.StatusCode, Status: res.Status}
+	}
+	var v struct {
+		Level int64 `json:"level"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&v); err != nil {
+		return 0, err
+	}
+	return v.Level, nil
+}
+
+// CheckEndpoints queries the head level of every endpoint and updates the routing state
+func (c *Client) CheckEndpoints(ctx context.Context) []*EndpointStatus {
+	eps := c.endpoints()
+	type result struct {
+		level int64
+		err   error
+	}
+	results := make([]result, len(eps))
+	var wg sync.WaitGroup
+	for i, u := range eps {
+		wg.Add(1)
+		go func(i int, u string) {
+			defer wg.Done()
+			results[i].level, results[i].err = c.headLevel(ctx, u)
+		}(i, u)
+	}
+	wg.Wait()
+
+	now := time.Now()
+	c.epMtx.Lock()
+	if c.epState == nil {
+		c.epState = make(map[string]*endpointState)
+	}
+	for i, u := range eps {
+		c.epState[u] = &endpointState{
+			checked: true,
+			healthy: results[i].err == nil,
+			level:   results[i].level,
+			err:     results[i].err,
+			at:      now,
+		}
+	}
+	c.epMtx.Unlock()
+	return c.EndpointsStatus()
+}
+
+// EndpointsStatus returns the routing state of all endpoints as of the last check
+func (c *Client) EndpointsStatus() []*EndpointStatus {
+	eps := c.endpoints()
+	c.epMtx.Lock()
+	defer c.epMtx.Unlock()
+	best, _ := c.bestLevel()
+	res := make([]*EndpointStatus, len(eps))
+	for i, u := range eps {
+		st := EndpointStatus{URL: u, Healthy: true}
+		if s, ok := c.epState[u]; ok {
+			st.Healthy = s.healthy
+			st.Level = s.level
+			st.CheckedAt = s.at
+			if s.err != nil {
+				st.Error = s.err.Error()
+			}
+			if s.checked && s.healthy {
+				st.Lag = best - s.level
+			}
+		}
+		res[i] = &st
+	}
+	return res
+}
+
+// RunHealthCheck checks the endpoints periodically until the context is cancelled
+func (c *Client) RunHealthCheck(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		c.CheckEndpoints(ctx)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
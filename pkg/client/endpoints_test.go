@@ -0,0 +1,103 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testNode struct {
+	level  int64
+	status int32
+	calls  int32
+}
+
+func (n *testNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt32(&n.calls, 1)
+	if st := atomic.LoadInt32(&n.status); st != 0 {
+		w.WriteHeader(int(st))
+		return
+	}
+	switch r.URL.Path {
+	case "/chains/main/blocks/head/header":
+		fmt.Fprintf(w, `{"level":%d}`, atomic.LoadInt64(&n.level))
+	case "/chains/main/chain_id":
+		w.Write([]byte(`"NetXdQprcVkpaWU"`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestFailover(t *testing.T) {
+	primary := &testNode{level: 10, status: http.StatusBadGateway}
+	secondary := &testNode{level: 10}
+	srv0 := httptest.NewServer(primary)
+	defer srv0.Close()
+	srv1 := httptest.NewServer(secondary)
+	defer srv1.Close()
+
+	c := &Client{
+		URL:       srv0.URL,
+		Endpoints: []string{srv1.URL},
+		// no retries but failover
+		Retry: &RetryPolicy{RetryableStatus: DefaultRetryPolicy.RetryableStatus},
+	}
+	ctx, stats := WithRetryStats(context.Background())
+	_, err := c.GetChainID(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&primary.calls))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&secondary.calls))
+	assert.Equal(t, int64(1), stats.Retries())
+
+	// the failed endpoint is avoided until it's back
+	_, err = c.GetChainID(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&primary.calls))
+
+	status := c.EndpointsStatus()
+	require.Len(t, status, 2)
+	assert.False(t, status[0].Healthy)
+	assert.NotEmpty(t, status[0].Error)
+	assert.True(t, status[1].Healthy)
+}
+
+func TestHeadLag(t *testing.T) {
+	primary := &testNode{level: 10}
+	secondary := &testNode{level: 20}
+	srv0 := httptest.NewServer(primary)
+	defer srv0.Close()
+	srv1 := httptest.NewServer(secondary)
+	defer srv1.Close()
+
+	c := &Client{
+		URL:        srv0.URL,
+		Endpoints:  []string{srv1.URL},
+		MaxHeadLag: 2,
+	}
+	assert.Equal(t, []string{srv0.URL, srv1.URL}, c.candidates())
+
+	status := c.CheckEndpoints(context.Background())
+	require.Len(t, status, 2)
+	assert.Equal(t, int64(10), status[0].Lag)
+	assert.Equal(t, int64(0), status[1].Lag)
+	assert.Equal(t, []string{srv1.URL, srv0.URL}, c.candidates())
+
+	_, err := c.GetChainID(context.Background())
+	require.NoError(t, err)
+	// only health checks reached the lagging node
+	assert.Equal(t, int32(1), atomic.LoadInt32(&primary.calls))
+
+	// the most up to date node is preferred, then the configuration order is kept
+	atomic.StoreInt64(&primary.level, 19)
+	c.CheckEndpoints(context.Background())
+	assert.Equal(t, []string{srv1.URL, srv0.URL}, c.candidates())
+	atomic.StoreInt64(&secondary.level, 19)
+	c.CheckEndpoints(context.Background())
+	assert.Equal(t, []string{srv0.URL, srv1.URL}, c.candidates())
+}
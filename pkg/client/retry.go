@@ -0,0 +1,194 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RetryPolicy controls retrying of idempotent requests failed due to transport errors or retryable status codes
+type RetryPolicy struct {
+	// MaxRetries is a number of attempts made after the first one. Zero disables retries but not failover to other endpoints
+	MaxRetries int
+	// MinBackoff is a delay before the first retry. Every next delay is doubled up to MaxBackoff
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// RetryableStatus lists HTTP status codes worth retrying
+	RetryableStatus []int
+}
+
+// DefaultRetryPolicy is used if no policy is set
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries: 3,
+	MinBackoff: 200 * time.Millisecond,
+	MaxBackoff: 5 * time.Second,
+	RetryableStatus: []int{
+		http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	},
+}
+
+func (p *RetryPolicy) retryableStatus(code int) bool {
+	for _, c := range p.RetryableStatus {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns a delay before the retry number n (zero based) using "full jitter"
+func (p *RetryPolicy) backoff(n int) time.Duration {
+	d := p.MinBackoff
+	for i := 0; i < n && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d)) + 1)
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// retryAfter parses the Retry-After header value given either in seconds or as an HTTP date
+func retryAfter(h http.Header, now time.Time) time.Duration {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if s, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if s < 0 {
+			return 0
+		}
+		return time.Duration(s) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// ErrCircuitOpen is returned without making a request while the endpoint is considered unavailable
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitBreaker stops sending requests to an endpoint after a number of consecutive failures.
+// After the cooldown period a single probe request is let through; its success closes the circuit
+type CircuitBreaker struct {
+	// Threshold is a number of consecutive failures opening the circuit. Zero disables the breaker
+	Threshold int
+	Cooldown  time.Duration
+
+	mtx       sync.Mutex
+	endpoints map[string]*breakerState
+}
+
+type breakerState struct {
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// allow reports whether a request to the endpoint may proceed
+func (b *CircuitBreaker) allow(endpoint string, now time.Time) bool {
+	if b == nil || b.Threshold <= 0 {
+		return true
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	s, ok := b.endpoints[endpoint]
+	if !ok || s.failures < b.Threshold {
+		return true
+	}
+	if s.probing || now.Sub(s.openedAt) < b.Cooldown {
+		return false
+	}
+	// half open
+	s.probing = true
+	return true
+}
+
+func (b *CircuitBreaker) report(endpoint string, ok bool, now time.Time) {
+	if b == nil || b.Threshold <= 0 {
+		return
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if b.endpoints == nil {
+		b.endpoints = make(map[string]*breakerState)
+	}
+	s, exist := b.endpoints[endpoint]
+	if !exist {
+		s = new(breakerState)
+		b.endpoints[endpoint] = s
+	}
+	s.probing = false
+	if ok {
+		s.failures = 0
+		return
+	}
+	s.failures++
+	if s.failures >= b.Threshold {
+		s.openedAt = now
+	}
+}
+
+// Open reports whether the circuit for the endpoint is open
+func (b *CircuitBreaker) Open(endpoint string) bool {
+	if b == nil || b.Threshold <= 0 {
+		return false
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	s, ok := b.endpoints[endpoint]
+	return ok && s.failures >= b.Threshold
+}
+
+// RetryStats accumulates the number of retries made on behalf of a context
+type RetryStats struct {
+	retries int64
+}
+
+// Retries returns the number of retries made so far
+func (r *RetryStats) Retries() int64 {
+	return atomic.LoadInt64(&r.retries)
+}
+
+func (r *RetryStats) inc() {
+	atomic.AddInt64(&r.retries, 1)
+}
+
+// Add adds retries made on behalf of the stats owner by requests bound to another context, e.g. shared between callers
+func (r *RetryStats) Add(n int64) {
+	atomic.AddInt64(&r.retries, n)
+}
+
+type retryStatsKey struct{}
+
+// WithRetryStats returns a context collecting retries made by the requests bound to it
+func WithRetryStats(ctx context.Context) (context.Context, *RetryStats) {
+	s := new(RetryStats)
+	return context.WithValue(ctx, retryStatsKey{}, s), s
+}
+
+// RetryStatsFromContext returns the stats bound to the context or nil
+func RetryStatsFromContext(ctx context.Context) *RetryStats {
+	s, _ := ctx.Value(retryStatsKey{}).(*RetryStats)
+	return s
+}
@@ -0,0 +1,134 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testRetryPolicy = RetryPolicy{
+	MaxRetries:      3,
+	MinBackoff:      time.Millisecond,
+	MaxBackoff:      5 * time.Millisecond,
+	RetryableStatus: DefaultRetryPolicy.RetryableStatus,
+}
+
+func TestRetry(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&calls, 1) {
+		case 1:
+			w.WriteHeader(http.StatusBadGateway)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte(`"NetXdQprcVkpaWU"`))
+		}
+	}))
+	defer srv.Close()
+
+	c := &Client{URL: srv.URL, Retry: &testRetryPolicy}
+	ctx, stats := WithRetryStats(context.Background())
+	id, err := c.GetChainID(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "NetXdQprcVkpaWU", id.String())
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	assert.Equal(t, int64(2), stats.Retries())
+}
+
+func TestRetryNotRetryable(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	c := &Client{URL: srv.URL, Retry: &testRetryPolicy}
+	_, err := c.GetChainID(context.Background())
+	var e *HTTPError
+	require.True(t, errors.As(err, &e))
+	assert.Equal(t, http.StatusNotFound, e.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestRetryExhausted(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusGatewayTimeout)
+	}))
+	defer srv.Close()
+
+	c := &Client{URL: srv.URL, Retry: &testRetryPolicy}
+	_, err := c.GetChainID(context.Background())
+	var e *HTTPError
+	require.True(t, errors.As(err, &e))
+	assert.Equal(t, http.StatusGatewayTimeout, e.StatusCode)
+	assert.Equal(t, int32(1+testRetryPolicy.MaxRetries), atomic.LoadInt32(&calls))
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC)
+	h := http.Header{}
+	assert.Equal(t, time.Duration(0), retryAfter(h, now))
+	h.Set("Retry-After", "3")
+	assert.Equal(t, 3*time.Second, retryAfter(h, now))
+	h.Set("Retry-After", now.Add(time.Minute).Format(http.TimeFormat))
+	assert.Equal(t, time.Minute, retryAfter(h, now))
+	h.Set("Retry-After", "garbage")
+	assert.Equal(t, time.Duration(0), retryAfter(h, now))
+}
+
+func TestBackoff(t *testing.T) {
+	p := RetryPolicy{MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for n := 0; n < 10; n++ {
+		d := p.backoff(n)
+		assert.Greater(t, int64(d), int64(0))
+		assert.LessOrEqual(t, int64(d), int64(time.Second))
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var calls int32
+	fail := int32(1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&fail) != 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`"NetXdQprcVkpaWU"`))
+	}))
+	defer srv.Close()
+
+	b := &CircuitBreaker{Threshold: 2, Cooldown: 50 * time.Millisecond}
+	c := &Client{URL: srv.URL, Retry: &RetryPolicy{}, Breaker: b}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		_, err := c.GetChainID(ctx)
+		require.Error(t, err)
+	}
+	assert.True(t, b.Open(srv.URL))
+
+	// fails fast without reaching the server
+	_, err := c.GetChainID(ctx)
+	assert.True(t, errors.Is(err, ErrCircuitOpen))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	// the probe after the cooldown closes the circuit
+	time.Sleep(60 * time.Millisecond)
+	atomic.StoreInt32(&fail, 0)
+	_, err = c.GetChainID(ctx)
+	require.NoError(t, err)
+	assert.False(t, b.Open(srv.URL))
+}
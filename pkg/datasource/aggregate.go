@@ -0,0 +1,156 @@
+package datasource
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Block grouping modes
+const (
+	GroupByCycle        = "cycle"
+	GroupByVotingPeriod = "voting_period"
+	GroupByLevels       = "levels"
+)
+
+// BlockBucket holds aggregates of the blocks belonging to the same cycle, voting period or level bucket
+type BlockBucket struct {
+	// Index is the cycle, voting period or level bucket number
+	Index int64 `json:"index"`
+	// StartTime is the timestamp of the earliest block of the bucket within the time range
+	StartTime  time.Time `json:"start_time"`
+	StartLevel int64     `json:"start_level"`
+	EndLevel   int64     `json:"end_level"`
+	Blocks     int64     `json:"blocks"`
+	DelayAvg   int64     `json:"delay_avg" tz:"ns" title:"Average delay"`
+	DelayP95   int64     `json:"delay_p95" tz:"ns" title:"95th percentile delay"`
+	NumOps     uint64    `json:"n_ops_total"`
+	// MissedPriorities is the sum of priorities (or rounds) the blocks were produced at
+	MissedPriorities int64 `json:"missed_priorities"`
+	// EndorsementCoverage is the ratio of the used endorsement slots (or power) to the available ones
+	EndorsementCoverage float64 `json:"endorsement_coverage" tz:"ratio" title:"Endorsement coverage"`
+
+	delays []int64
+	slots  uint64
+	quota  uint64
+}
+
+type BlockBucketInfo struct {
+	Bucket *BlockBucket `json:"bucket"`
+}
+
+// percentile returns the nearest rank percentile of the sorted values
+func percentile(sorted []int64, p float64) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+// bucketIndex returns the bucket the block belongs to. Cycles and voting periods are taken from the block metadata
+// and requested from the node if the metadata lacks them
+func (d *Datasource) bucketIndex(ctx context.Context, b *BlockInfo, groupBy string, size int64) (int64, error) {
+	switch groupBy {
+	case GroupByCycle:
+		if b.Metadata != nil && b.Metadata.LevelInfo != nil {
+			return b.Metadata.LevelInfo.Cycle, nil
+		}
+		l, err := d.Client.GetCurrentLevel(ctx, b.Header.Hash.String())
+		if err != nil {
+			return 0, err
+		}
+		return l.Cycle, nil
+
+	case GroupByVotingPeriod:
+		if b.Metadata != nil && b.Metadata.VotingPeriodInfo != nil {
+			return b.Metadata.VotingPeriodInfo.VotingPeriod.Index, nil
+		}
+		p, err := d.Client.GetCurrentPeriod(ctx, b.Header.Hash.String())
+		if err != nil {
+			return 0, err
+		}
+		return p.VotingPeriod.Index, nil
+
+	case GroupByLevels:
+		if size <= 0 {
+			return 0, fmt.Errorf("invalid bucket size: %d", size)
+		}
+		return b.Header.Level / size, nil
+
+	default:
+		return 0, fmt.Errorf("unknown grouping: %q", groupBy)
+	}
+}
+
+// endorsementQuota returns the number of endorsement slots (or the consensus committee size) of a block
+func (d *Datasource) endorsementQuota(ctx context.Context, b *BlockInfo) (uint64, error) {
+	c, err := d.getProtocolConstants(ctx, b.Header)
+	if err != nil {
+		return 0, err
+	}
+	if b.Header.IsTenderbake() {
+		return uint64(c.ConsensusCommitteeSize), nil
+	}
+	return c.EndorsersPerBlock, nil
+}
+
+// GetBlockBuckets groups blocks within the time range by cycle, voting period or size levels and returns
+// the aggregates of each group ordered by level
+func (d *Datasource) GetBlockBuckets(ctx context.Context, start, end time.Time, groupBy string, size int64) ([]*BlockBucketInfo, error) {
+	blocks, err := d.GetBlocksInfo(ctx, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	var buckets []*BlockBucket
+	for _, b := range blocks {
+		idx, err := d.bucketIndex(ctx, b, groupBy, size)
+		if err != nil {
+			return nil, err
+		}
+		quota, err := d.endorsementQuota(ctx, b)
+		if err != nil {
+			return nil, err
+		}
+		var bucket *BlockBucket
+		if len(buckets) != 0 && buckets[len(buckets)-1].Index == idx {
+			bucket = buckets[len(buckets)-1]
+		} else {
+			bucket = &BlockBucket{
+				Index:      idx,
+				StartTime:  b.Header.Timestamp,
+				StartLevel: b.Header.Level,
+			}
+			buckets = append(buckets, bucket)
+		}
+		bucket.EndLevel = b.Header.Level
+		bucket.Blocks++
+		bucket.delays = append(bucket.delays, b.Delay)
+		bucket.NumOps += b.Stat.NumOps
+		bucket.MissedPriorities += b.Round
+		bucket.slots += b.Stat.Slots
+		bucket.quota += quota
+	}
+
+	res := make([]*BlockBucketInfo, len(buckets))
+	for i, bucket := range buckets {
+		var sum int64
+		for _, v := range bucket.delays {
+			sum += v
+		}
+		bucket.DelayAvg = sum / int64(len(bucket.delays))
+		sort.Slice(bucket.delays, func(i, j int) bool { return bucket.delays[i] < bucket.delays[j] })
+		bucket.DelayP95 = percentile(bucket.delays, 0.95)
+		if bucket.quota != 0 {
+			bucket.EndorsementCoverage = float64(bucket.slots) / float64(bucket.quota)
+		}
+		res[i] = &BlockBucketInfo{Bucket: bucket}
+	}
+	return res, nil
+}
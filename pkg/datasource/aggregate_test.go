@@ -0,0 +1,81 @@
+package datasource
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ecadlabs/tezos-grafana-datasource/pkg/client"
+	"github.com/ecadlabs/tezos-grafana-datasource/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPercentile(t *testing.T) {
+	values := make([]int64, 100)
+	for i := range values {
+		values[i] = int64(i + 1)
+	}
+	assert.Equal(t, int64(95), percentile(values, 0.95))
+	assert.Equal(t, int64(50), percentile(values, 0.5))
+	assert.Equal(t, int64(7), percentile([]int64{7}, 0.95))
+	assert.Equal(t, int64(0), percentile(nil, 0.95))
+}
+
+func TestGetBlockBuckets(t *testing.T) {
+	node := newMockNode(40)
+	node.constants = &model.ProtocolConstants{BlocksPerCycle: 8, BlocksPerVotingPeriod: 16, EndorsersPerBlock: 32}
+	// level 12 is baked at priority 2 and delayed by 80s
+	for _, b := range node.blocks[12:] {
+		b.Header.Timestamp = b.Header.Timestamp.Add(80 * time.Second)
+	}
+	node.blocks[12].Header.Priority = 2
+	// blocks up to level 20 have metadata, the rest is requested from the node
+	for _, b := range node.blocks[1:21] {
+		pos := b.Header.Level - 1
+		b.Metadata = &model.BlockMetadata{
+			LevelInfo:        &model.LevelInfo{Level: b.Header.Level, LevelPosition: pos, Cycle: pos / 8},
+			VotingPeriodInfo: &model.VotingPeriodInfo{VotingPeriod: model.VotingPeriod{Index: pos / 16}},
+		}
+	}
+	srv := httptest.NewServer(node)
+	defer srv.Close()
+
+	d := newTestDatasource(t)
+	d.Client = &client.Client{URL: srv.URL}
+
+	ctx := context.Background()
+	// levels 1 to 32
+	start, end := testT0.Add(testBlockInterval), testT0.Add(33*testBlockInterval+80*time.Second)
+
+	buckets, err := d.GetBlockBuckets(ctx, start, end, GroupByCycle, 0)
+	require.NoError(t, err)
+	require.Len(t, buckets, 4)
+	for i, b := range buckets {
+		assert.Equal(t, int64(i), b.Bucket.Index)
+		assert.Equal(t, int64(i*8+1), b.Bucket.StartLevel)
+		assert.Equal(t, int64(i*8+8), b.Bucket.EndLevel)
+		assert.Equal(t, int64(8), b.Bucket.Blocks)
+	}
+	assert.Equal(t, testT0.Add(9*testBlockInterval), buckets[1].Bucket.StartTime)
+	assert.Equal(t, int64(2), buckets[1].Bucket.MissedPriorities)
+	assert.Equal(t, int64(testBlockInterval+10*time.Second), buckets[1].Bucket.DelayAvg)
+	assert.Equal(t, int64(testBlockInterval+80*time.Second), buckets[1].Bucket.DelayP95)
+	assert.Equal(t, int64(testBlockInterval), buckets[0].Bucket.DelayP95)
+
+	buckets, err = d.GetBlockBuckets(ctx, start, end, GroupByVotingPeriod, 0)
+	require.NoError(t, err)
+	require.Len(t, buckets, 2)
+	assert.Equal(t, int64(16), buckets[0].Bucket.Blocks)
+
+	buckets, err = d.GetBlockBuckets(ctx, start, end, GroupByLevels, 10)
+	require.NoError(t, err)
+	require.Len(t, buckets, 4)
+	assert.Equal(t, int64(9), buckets[0].Bucket.Blocks)
+	assert.Equal(t, int64(10), buckets[1].Bucket.StartLevel)
+	assert.Equal(t, int64(3), buckets[3].Bucket.Blocks)
+
+	_, err = d.GetBlockBuckets(ctx, start, end, GroupByLevels, 0)
+	assert.Error(t, err)
+}
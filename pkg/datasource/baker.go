@@ -0,0 +1,241 @@
+package datasource
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ecadlabs/tezos-grafana-datasource/pkg/client"
+	"github.com/ecadlabs/tezos-grafana-datasource/pkg/model"
+)
+
+// BakerPerformance summarizes the delegate's activity at a single level
+type BakerPerformance struct {
+	Delegate model.Base58 `json:"delegate" tz:"address"`
+	// Baked is 1 if the block was baked by the delegate
+	Baked int64 `json:"baked"`
+	// Priority is the priority (or round) of the block baked by the delegate or -1
+	Priority int64 `json:"priority"`
+	// MissedBlocks is the number of the delegate's baking rights with a priority (or round) lower than the block's one
+	MissedBlocks  int64 `json:"missed_blocks"`
+	ExpectedSlots int64 `json:"expected_slots"`
+	EndorsedSlots int64 `json:"endorsed_slots"`
+	MissedSlots   int64 `json:"missed_slots"`
+}
+
+// BakerPerformanceInfo is the delegate's performance along with the block
+type BakerPerformanceInfo struct {
+	Block *BlockInfo        `json:"block"`
+	Baker *BakerPerformance `json:"baker"`
+}
+
+// getSuccessor returns the canonical block following the given one or nil if it's the head
+func (d *Datasource) getSuccessor(ctx context.Context, b *BlockInfo) (*model.BlockInfo, error) {
+	hdr, err := d.Client.GetBlockHeader(ctx, strconv.FormatInt(b.Header.Level+1, 10))
+	if err != nil {
+		var e *client.HTTPError
+		if errors.As(err, &e) && e.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return d.getCanonicalBlockInfo(ctx, hdr.Hash)
+}
+
+type cycleRightsKey struct {
+	cycle    int64
+	delegate string
+}
+
+// getCyclesRights reads the listed delegates' rights through the cache for every cycle the blocks belong to.
+// Blocks without metadata are skipped
+func (d *Datasource) getCyclesRights(ctx context.Context, blocks []*BlockInfo, delegates []model.Base58) (map[cycleRightsKey]*model.DelegateRights, error) {
+	var (
+		keys     []cycleRightsKey
+		blockIDs []string
+		seen     = make(map[int64]bool)
+	)
+	for _, b := range blocks {
+		if b.Metadata == nil || b.Metadata.LevelInfo == nil || seen[b.Metadata.Cycle()] {
+			continue
+		}
+		seen[b.Metadata.Cycle()] = true
+		for _, delegate := range delegates {
+			keys = append(keys, cycleRightsKey{cycle: b.Metadata.Cycle(), delegate: string(delegate)})
+			// the cycle's own block is able to return its rights even if the cycle is long gone
+			blockIDs = append(blockIDs, b.Header.Hash.String())
+		}
+	}
+	rights := make([]*model.DelegateRights, len(keys))
+	err := d.forEach(ctx, len(keys), func(ctx context.Context, i int) error {
+		var err error
+		rights[i], err = d.getDelegateRights(ctx, blockIDs[i], keys[i].cycle, model.Base58(keys[i].delegate))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[cycleRightsKey]*model.DelegateRights, len(keys))
+	for i, k := range keys {
+		res[k] = rights[i]
+	}
+	return res, nil
+}
+
+// getLevelRights returns rights at the block's level taken from the cached cycle rights if available
+func (d *Datasource) getLevelRights(ctx context.Context, b *BlockInfo, delegates []model.Base58, cycleRights map[cycleRightsKey]*model.DelegateRights) ([]*model.BakingRight, []*model.EndorsingRight, error) {
+	level := b.Header.Level
+	if cycleRights != nil && b.Metadata != nil && b.Metadata.LevelInfo != nil {
+		var (
+			baking    []*model.BakingRight
+			endorsing []*model.EndorsingRight
+		)
+		for _, delegate := range delegates {
+			rights, ok := cycleRights[cycleRightsKey{cycle: b.Metadata.Cycle(), delegate: string(delegate)}]
+			if !ok {
+				continue
+			}
+			for _, r := range rights.Baking {
+				if r.Level == level {
+					baking = append(baking, r)
+				}
+			}
+			for _, r := range rights.Endorsing {
+				if r.Level == level {
+					endorsing = append(endorsing, r)
+				}
+			}
+		}
+		return baking, endorsing, nil
+	}
+
+	// all delegates having rights at the level are unknown in advance so rights are requested per level
+	params := client.RightsParams{
+		Level:    []int64{level},
+		Delegate: delegates,
+	}
+	if b.Header.IsTenderbake() {
+		params.MaxRound = int(b.Round) + 1
+	} else {
+		params.MaxPriority = int(b.Round) + 1
+	}
+	baking, err := d.Client.GetBakingRights(ctx, b.Header.Hash.String(), &params)
+	if err != nil {
+		return nil, nil, err
+	}
+	endorsing, err := d.Client.GetEndorsingRights(ctx, b.Header.Hash.String(), &client.RightsParams{
+		Level:    []int64{level},
+		Delegate: delegates,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return baking, endorsing, nil
+}
+
+func (d *Datasource) getBakerPerformance(ctx context.Context, b *BlockInfo, next *model.BlockInfo, delegates []model.Base58, cycleRights map[cycleRightsKey]*model.DelegateRights) ([]*BakerPerformanceInfo, error) {
+	priority := b.Round
+	bakingRights, endorsingRights, err := d.getLevelRights(ctx, b, delegates, cycleRights)
+	if err != nil {
+		return nil, err
+	}
+	// endorsements of the block are included into its successor
+	var endorsements []*model.OperationInfo
+	if next != nil {
+		if endorsements, err = d.getOperationsInfo(ctx, next.Header.Hash); err != nil {
+			return nil, err
+		}
+	}
+
+	perf := make(map[string]*BakerPerformance)
+	get := func(delegate model.Base58) *BakerPerformance {
+		p, ok := perf[string(delegate)]
+		if !ok {
+			p = &BakerPerformance{Delegate: delegate, Priority: -1}
+			perf[string(delegate)] = p
+		}
+		return p
+	}
+
+	for _, r := range bakingRights {
+		if r.Priority > priority {
+			continue
+		}
+		p := get(r.Delegate)
+		if r.Priority == priority {
+			p.Baked = 1
+			p.Priority = priority
+		} else {
+			p.MissedBlocks++
+		}
+	}
+	// endorsements are unknown until the successor is baked
+	if next != nil {
+		for _, r := range endorsingRights {
+			get(r.Delegate).ExpectedSlots += r.EndorsingPower()
+		}
+		for _, op := range endorsements {
+			if op.Slots == 0 {
+				continue
+			}
+			if p, ok := perf[string(op.Source)]; ok {
+				p.EndorsedSlots += op.Slots
+			}
+		}
+	}
+
+	res := make([]*BakerPerformanceInfo, 0, len(perf))
+	for _, p := range perf {
+		if p.MissedSlots = p.ExpectedSlots - p.EndorsedSlots; p.MissedSlots < 0 {
+			p.MissedSlots = 0
+		}
+		res = append(res, &BakerPerformanceInfo{Block: b, Baker: p})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Baker.Delegate.String() < res[j].Baker.Delegate.String()
+	})
+	return res, nil
+}
+
+// GetBakerPerformance returns per level performance of delegates having baking or endorsing rights within the time range.
+// If delegates isn't empty only the listed delegates are returned
+func (d *Datasource) GetBakerPerformance(ctx context.Context, start, end time.Time, delegates []model.Base58) ([]*BakerPerformanceInfo, error) {
+	blocks, err := d.GetBlocksInfo(ctx, start, end)
+	if err != nil || len(blocks) == 0 {
+		return nil, err
+	}
+	next, err := d.getSuccessor(ctx, blocks[len(blocks)-1])
+	if err != nil {
+		return nil, err
+	}
+	// rights of the listed delegates are read per cycle instead of two RPCs per block
+	var cycleRights map[cycleRightsKey]*model.DelegateRights
+	if len(delegates) != 0 {
+		if cycleRights, err = d.getCyclesRights(ctx, blocks, delegates); err != nil {
+			return nil, err
+		}
+	}
+
+	perf := make([][]*BakerPerformanceInfo, len(blocks))
+	err = d.forEach(ctx, len(blocks), func(ctx context.Context, i int) error {
+		n := next
+		if i < len(blocks)-1 {
+			n = blocks[i+1].BlockInfo
+		}
+		var err error
+		perf[i], err = d.getBakerPerformance(ctx, blocks[i], n, delegates, cycleRights)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*BakerPerformanceInfo
+	for _, p := range perf {
+		res = append(res, p...)
+	}
+	return res, nil
+}
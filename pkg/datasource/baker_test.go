@@ -0,0 +1,196 @@
+package datasource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ecadlabs/tezos-grafana-datasource/pkg/client"
+	"github.com/ecadlabs/tezos-grafana-datasource/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testDelegateA = model.Base58{6, 161, 159, 1}
+	testDelegateB = model.Base58{6, 161, 159, 2}
+)
+
+const testBlocksPerCycle = 8
+
+// rightsNode adds rights and endorsements to the mock chain. Delegate A has the first priority at even levels
+// and B at odd ones. A has two endorsement slots per level and B has one. B doesn't endorse level 6
+type rightsNode struct {
+	*mockNode
+	rightsCalls int
+}
+
+// levels returns levels requested either directly or by cycle
+func (n *rightsNode) levels(r *http.Request) []int64 {
+	if c := r.URL.Query().Get("cycle"); c != "" {
+		cycle, _ := strconv.ParseInt(c, 10, 64)
+		levels := make([]int64, testBlocksPerCycle)
+		for i := range levels {
+			levels[i] = cycle*testBlocksPerCycle + int64(i)
+		}
+		return levels
+	}
+	level, _ := strconv.ParseInt(r.URL.Query().Get("level"), 10, 64)
+	return []int64{level}
+}
+
+func delegateFilter(r *http.Request) func(model.Base58) bool {
+	filter := r.URL.Query()["delegate"]
+	return func(d model.Base58) bool {
+		if len(filter) == 0 {
+			return true
+		}
+		for _, f := range filter {
+			if f == d.String() {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func (n *rightsNode) delegates(level int64) (first, second model.Base58) {
+	if level%2 == 0 {
+		return testDelegateA, testDelegateB
+	}
+	return testDelegateB, testDelegateA
+}
+
+func (n *rightsNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Split(strings.TrimPrefix(r.URL.Path, "/chains/main/blocks"), "/")
+	if len(path) < 3 || (path[2] != "helpers" && path[2] != "operations") {
+		n.mockNode.ServeHTTP(w, r)
+		return
+	}
+	var res interface{}
+	switch {
+	case path[2] == "operations":
+		b := n.block(path[1])
+		endorsement := func(delegate model.Base58, slots string) string {
+			return fmt.Sprintf(`{"protocol": "%[5]s", "chain_id": "%[1]s", "hash": "%[1]s", "branch": "%[1]s", "signature": "%[1]s",
+				"contents": [{"kind": "endorsement", "level": %[2]d, "metadata": {"balance_updates": [], "delegate": "%[3]s", "slots": %[4]s}}]}`,
+				model.Base58{0}, b.Header.Level-1, delegate, slots, model.ProtoGranada)
+		}
+		ops := []string{endorsement(testDelegateA, "[0, 1]")}
+		if b.Header.Level-1 != 6 {
+			ops = append(ops, endorsement(testDelegateB, "[2]"))
+		}
+		res = json.RawMessage(fmt.Sprintf("[[%s], [], [], []]", strings.Join(ops, ",")))
+	case path[3] == "current_level":
+		b := n.block(path[1])
+		res = &model.LevelInfo{Level: b.Header.Level, Cycle: b.Header.Level / testBlocksPerCycle}
+	case path[3] == "baking_rights":
+		n.mtx.Lock()
+		n.rightsCalls++
+		n.mtx.Unlock()
+		max, err := strconv.Atoi(r.URL.Query().Get("max_priority"))
+		if err != nil {
+			max = 64
+		}
+		match := delegateFilter(r)
+		rights := []*model.BakingRight{}
+		for _, level := range n.levels(r) {
+			first, second := n.delegates(level)
+			for p, d := range []model.Base58{first, second} {
+				if p < max && match(d) {
+					rights = append(rights, &model.BakingRight{Level: level, Delegate: d, Priority: int64(p), EstimatedTime: testT0.Add(time.Duration(level) * testBlockInterval)})
+				}
+			}
+		}
+		res = rights
+	case path[3] == "endorsing_rights":
+		n.mtx.Lock()
+		n.rightsCalls++
+		n.mtx.Unlock()
+		match := delegateFilter(r)
+		rights := []*model.EndorsingRight{}
+		for _, level := range n.levels(r) {
+			if match(testDelegateA) {
+				rights = append(rights, &model.EndorsingRight{Level: level, Delegate: testDelegateA, Slots: []uint64{0, 1}})
+			}
+			if match(testDelegateB) {
+				rights = append(rights, &model.EndorsingRight{Level: level, Delegate: testDelegateB, Slots: []uint64{2}})
+			}
+		}
+		res = rights
+	}
+	if res == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+func TestGetBakerPerformance(t *testing.T) {
+	node := newMockNode(20)
+	// level 5 is baked by A at priority 1
+	node.blocks[5].Header.Priority = 1
+	srv := httptest.NewServer(&rightsNode{mockNode: node})
+	defer srv.Close()
+
+	d := newTestDatasource(t)
+	d.Client = &client.Client{URL: srv.URL}
+
+	perf, err := d.GetBakerPerformance(context.Background(), testT0.Add(4*testBlockInterval), testT0.Add(20*testBlockInterval), nil)
+	require.NoError(t, err)
+
+	type key struct {
+		level    int64
+		delegate string
+	}
+	res := make(map[key]*BakerPerformance)
+	for _, p := range perf {
+		res[key{p.Block.Header.Level, p.Baker.Delegate.String()}] = p.Baker
+	}
+	// A has no applicable rights at the head
+	require.Len(t, res, 2*16-1)
+
+	assert.Equal(t, &BakerPerformance{Delegate: testDelegateA, Baked: 1, Priority: 0, ExpectedSlots: 2, EndorsedSlots: 2}, res[key{4, testDelegateA.String()}])
+	assert.Equal(t, &BakerPerformance{Delegate: testDelegateB, Priority: -1, ExpectedSlots: 1, EndorsedSlots: 1}, res[key{4, testDelegateB.String()}])
+	// priority 1 block
+	assert.Equal(t, &BakerPerformance{Delegate: testDelegateA, Baked: 1, Priority: 1, ExpectedSlots: 2, EndorsedSlots: 2}, res[key{5, testDelegateA.String()}])
+	assert.Equal(t, &BakerPerformance{Delegate: testDelegateB, Priority: -1, MissedBlocks: 1, ExpectedSlots: 1, EndorsedSlots: 1}, res[key{5, testDelegateB.String()}])
+	// missed endorsement
+	assert.Equal(t, &BakerPerformance{Delegate: testDelegateB, Priority: -1, ExpectedSlots: 1, MissedSlots: 1}, res[key{6, testDelegateB.String()}])
+	// the head's endorsements are unknown yet
+	assert.Equal(t, &BakerPerformance{Delegate: testDelegateB, Baked: 1, Priority: 0}, res[key{19, testDelegateB.String()}])
+}
+
+func TestGetBakerPerformanceDelegates(t *testing.T) {
+	node := newMockNode(20)
+	for _, b := range node.blocks {
+		b.Metadata = &model.BlockMetadata{LevelInfo: &model.LevelInfo{Level: b.Header.Level, Cycle: b.Header.Level / testBlocksPerCycle}}
+	}
+	rn := &rightsNode{mockNode: node}
+	srv := httptest.NewServer(rn)
+	defer srv.Close()
+
+	d := newTestDatasource(t)
+	d.Client = &client.Client{URL: srv.URL}
+
+	perf, err := d.GetBakerPerformance(context.Background(), testT0.Add(4*testBlockInterval), testT0.Add(20*testBlockInterval), []model.Base58{testDelegateB})
+	require.NoError(t, err)
+	require.Len(t, perf, 16)
+	for _, p := range perf {
+		assert.Equal(t, testDelegateB, p.Baker.Delegate)
+	}
+	assert.Equal(t, &BakerPerformance{Delegate: testDelegateB, Priority: -1, ExpectedSlots: 1, MissedSlots: 1}, perf[2].Baker)
+	assert.Equal(t, &BakerPerformance{Delegate: testDelegateB, Baked: 1, Priority: 0}, perf[15].Baker)
+	// rights are requested once per cycle, not per block
+	assert.Equal(t, 3*2, rn.rightsCalls)
+
+	_, err = d.GetBakerPerformance(context.Background(), testT0.Add(4*testBlockInterval), testT0.Add(20*testBlockInterval), []model.Base58{testDelegateB})
+	require.NoError(t, err)
+	assert.Equal(t, 3*2, rn.rightsCalls)
+}
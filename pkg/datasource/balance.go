@@ -0,0 +1,72 @@
+package datasource
+
+import (
+	"context"
+	"time"
+
+	"github.com/ecadlabs/tezos-grafana-datasource/pkg/model"
+)
+
+// BalanceUpdateInfo is the delegate's balance change of a single category along with the block
+type BalanceUpdateInfo struct {
+	Block  *BlockInfo               `json:"block"`
+	Update *model.BalanceUpdateInfo `json:"update"`
+}
+
+// getBalanceUpdates returns the block's balance updates. They are computed by getBlockInfo when the block is fetched,
+// blocks cached before are fetched again
+func (d *Datasource) getBalanceUpdates(ctx context.Context, blockID model.Base58) ([]*model.BalanceUpdateInfo, error) {
+	updates, ok, err := d.DB.GetBalanceUpdates(ctx, blockID)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return updates, nil
+	}
+	block, err := d.Client.GetBlock(ctx, blockID.String())
+	if err != nil {
+		return nil, err
+	}
+	updates = block.BalanceUpdatesInfo()
+	if err = d.DB.UpdateBalanceUpdates(ctx, blockID, updates); err != nil {
+		return nil, err
+	}
+	return updates, nil
+}
+
+// GetBalanceUpdates returns balance updates of delegates within the time range summed per block by delegate, category
+// and cycle. If delegates isn't empty only the listed delegates are returned
+func (d *Datasource) GetBalanceUpdates(ctx context.Context, start, end time.Time, delegates []model.Base58) ([]*BalanceUpdateInfo, error) {
+	blocks, err := d.GetBlocksInfo(ctx, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	blockUpdates := make([][]*model.BalanceUpdateInfo, len(blocks))
+	err = d.forEach(ctx, len(blocks), func(ctx context.Context, i int) error {
+		var err error
+		blockUpdates[i], err = d.getBalanceUpdates(ctx, blocks[i].Header.Hash)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	filter := make(map[string]bool, len(delegates))
+	for _, d := range delegates {
+		filter[string(d)] = true
+	}
+	var res []*BalanceUpdateInfo
+	for i, updates := range blockUpdates {
+		for _, u := range updates {
+			if len(filter) != 0 && !filter[string(u.Delegate)] {
+				continue
+			}
+			res = append(res, &BalanceUpdateInfo{
+				Block:  blocks[i],
+				Update: u,
+			})
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,45 @@
+package datasource
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ecadlabs/tezos-grafana-datasource/pkg/client"
+	"github.com/ecadlabs/tezos-grafana-datasource/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetBalanceUpdates(t *testing.T) {
+	node := newMockNode(20)
+	for _, b := range node.blocks {
+		b.Metadata = &model.BlockMetadata{
+			LevelInfo: &model.LevelInfo{Level: b.Header.Level, Cycle: b.Header.Level / testBlocksPerCycle},
+			BalanceUpdates: model.BalanceUpdates{
+				&model.NonContractBalanceUpdate{Kind: "freezer", Category: "rewards", Delegate: testDelegateA, Cycle: b.Header.Level / testBlocksPerCycle, Change: 100},
+			},
+		}
+	}
+	srv := httptest.NewServer(node)
+	defer srv.Close()
+
+	d := newTestDatasource(t)
+	d.Client = &client.Client{URL: srv.URL}
+
+	ctx := context.Background()
+	updates, err := d.GetBalanceUpdates(ctx, testT0.Add(4*testBlockInterval), testT0.Add(12*testBlockInterval), []model.Base58{testDelegateA})
+	require.NoError(t, err)
+	require.Len(t, updates, 8)
+	for i, u := range updates {
+		assert.Equal(t, int64(4+i), u.Block.Header.Level)
+		assert.Equal(t, &model.BalanceUpdateInfo{Delegate: testDelegateA, Category: model.BalanceRewards, Cycle: u.Block.Header.Level / testBlocksPerCycle, Change: 100, Count: 1}, u.Update)
+	}
+	// balance updates are computed along with the block info
+	waitFetcherIdle(t, d)
+	node.mtx.Lock()
+	defer node.mtx.Unlock()
+	for h, n := range node.calls {
+		assert.Equal(t, 1, n, h)
+	}
+}
@@ -1,24 +1,106 @@
 package datasource
 
 import (
+	"bytes"
 	"context"
+	"io"
+	"sync"
 	"time"
 
 	"github.com/ecadlabs/tezos-grafana-datasource/pkg/client"
 	"github.com/ecadlabs/tezos-grafana-datasource/pkg/model"
 	"github.com/ecadlabs/tezos-grafana-datasource/pkg/storage"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
 )
 
 type Datasource struct {
-	DB     storage.BlockInfoStorage
+	DB     storage.Storage
 	Client *client.Client
+	// Parallelism limits the number of blocks fetched concurrently
+	Parallelism int
+
+	fetcherOnce sync.Once
+	f           *fetcher
+
+	constMtx  sync.Mutex
+	constants map[string]*model.ProtocolConstants
+}
+
+func (d *Datasource) fetcher() *fetcher {
+	d.fetcherOnce.Do(func() {
+		d.f = newFetcher(d, d.Parallelism)
+	})
+	return d.f
 }
 
 type BlockInfo struct {
 	*model.BlockInfo
+	// Round is the block's round or priority for Emmy* based protocols
+	Round                int64     `json:"round"`
 	PredecessorTimestamp time.Time `json:"predecessor_timestamp"`
-	MinDelay             int64     `json:"minimal_delay"`
-	Delay                int64     `json:"delay"`
+	MinDelay             int64     `json:"minimal_delay" tz:"ns" title:"Minimal delay"`
+	Delay                int64     `json:"delay" tz:"ns" title:"Block delay"`
+}
+
+func newBlockInfo(info *model.BlockInfo) *BlockInfo {
+	return &BlockInfo{
+		BlockInfo: info,
+		Round:     info.Header.Round(),
+	}
+}
+
+// getProtocolConstants returns constants of the block's protocol. Constants are read from the predecessor's
+// context which is the one the block is validated against
+func (d *Datasource) getProtocolConstants(ctx context.Context, header *model.BlockHeader) (*model.ProtocolConstants, error) {
+	key := header.Protocol.String()
+	d.constMtx.Lock()
+	c, ok := d.constants[key]
+	d.constMtx.Unlock()
+	if ok {
+		return c, nil
+	}
+	c, err := d.Client.GetProtocolConstants(ctx, header.Predecessor.String())
+	if err != nil {
+		return nil, err
+	}
+	d.constMtx.Lock()
+	if d.constants == nil {
+		d.constants = make(map[string]*model.ProtocolConstants)
+	}
+	d.constants[key] = c
+	d.constMtx.Unlock()
+	return c, nil
+}
+
+func (d *Datasource) getTimestamp(ctx context.Context, blockID model.Base58) (time.Time, error) {
+	info, err := d.DB.GetBlockInfo(ctx, blockID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if info != nil {
+		return info.Header.Timestamp, nil
+	}
+	header, err := d.Client.GetBlockHeader(ctx, blockID.String())
+	if err != nil {
+		return time.Time{}, err
+	}
+	return header.Timestamp, nil
+}
+
+// getMinValidTime returns the earliest time the block could be produced at
+func (d *Datasource) getMinValidTime(ctx context.Context, block *model.Block, stat *model.BlockStatistics) (time.Time, error) {
+	if !block.Header.IsTenderbake() {
+		return d.Client.GetMinimalValidTime(ctx, block.Header.Predecessor.String(), int(block.Header.Priority), int(stat.Slots))
+	}
+	c, err := d.getProtocolConstants(ctx, block.GetHeader())
+	if err != nil {
+		return time.Time{}, err
+	}
+	predTs, err := d.getTimestamp(ctx, block.Header.Predecessor)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return c.RoundStart(predTs, block.Header.PredecessorRound(), block.Header.Round()), nil
 }
 
 func (d *Datasource) getBlockInfo(ctx context.Context, blockID model.Base58) (*model.BlockInfo, error) {
@@ -26,15 +108,17 @@ func (d *Datasource) getBlockInfo(ctx context.Context, blockID model.Base58) (*m
 	if err != nil {
 		return nil, err
 	}
-	if info != nil {
+	if isComplete(info) {
 		return info, nil
 	}
+	// blocks cached by older versions lack metadata and are fetched again
+	orphaned := info != nil && info.Orphaned
 	block, err := d.Client.GetBlock(ctx, blockID.String())
 	if err != nil {
 		return nil, err
 	}
 	stat := block.Stat()
-	ts, err := d.Client.GetMinimalValidTime(ctx, block.Header.Predecessor.String(), int(block.Header.Priority), int(stat.Slots))
+	ts, err := d.getMinValidTime(ctx, block, stat)
 	if err != nil {
 		return nil, err
 	}
@@ -42,6 +126,12 @@ func (d *Datasource) getBlockInfo(ctx context.Context, blockID model.Base58) (*m
 		Header:       block.GetHeader(),
 		Stat:         stat,
 		MinValidTime: ts,
+		Orphaned:     orphaned,
+		Metadata:     block.Metadata.Info(),
+	}
+	// balance updates are computed while the full block is at hand
+	if err = d.DB.UpdateBalanceUpdates(ctx, info.Header.Hash, block.BalanceUpdatesInfo()); err != nil {
+		return nil, err
 	}
 	if err = d.DB.UpdateBlockInfo(ctx, info); err != nil {
 		return nil, err
@@ -49,26 +139,84 @@ func (d *Datasource) getBlockInfo(ctx context.Context, blockID model.Base58) (*m
 	return info, nil
 }
 
+// isComplete reports whether the cached block info can be used as is
+func isComplete(info *model.BlockInfo) bool {
+	return info != nil && info.Metadata != nil
+}
+
+// getCanonicalBlockInfo is getBlockInfo for blocks known to belong to the canonical chain
+func (d *Datasource) getCanonicalBlockInfo(ctx context.Context, blockID model.Base58) (*model.BlockInfo, error) {
+	info, err := d.fetcher().get(ctx, blockID)
+	if err != nil || !info.Orphaned {
+		return info, err
+	}
+	// the chain has switched back to the previously orphaned branch
+	tmp := *info
+	tmp.Orphaned = false
+	if err = d.DB.UpdateBlockInfo(ctx, &tmp); err != nil {
+		return nil, err
+	}
+	return &tmp, nil
+}
+
 func (d *Datasource) GetBlocksInfo(ctx context.Context, start, end time.Time) ([]*BlockInfo, error) {
 	// get head first
 	h, err := d.Client.GetBlockHeader(ctx, "head")
 	if err != nil {
 		return nil, err
 	}
-	nextBlock := h.Hash
+
+	// narrow the walk down using the cache indexes
+	fromLevel, ok, err := d.DB.GetLevelBefore(ctx, start)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		fromLevel = 0
+	}
+	toLevel, ok, err := d.DB.GetLevelAfter(ctx, end)
+	if err != nil {
+		return nil, err
+	}
+	if !ok || toLevel > h.Level {
+		toLevel = h.Level
+	}
+	cached, err := d.DB.GetBlocksInfoByLevel(ctx, fromLevel, toLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	// seek straight to the end of the range
+	nextBlock, nextLevel := h.Hash, h.Level
+	fromHead := true
+	if c, ok := cached[toLevel]; ok && toLevel != h.Level {
+		nextBlock, nextLevel = c.Header.Hash, toLevel
+		fromHead = false
+	}
 
 	var (
-		blocks    []*BlockInfo
-		prevBlock *BlockInfo
+		blocks     []*BlockInfo
+		prevBlock  *BlockInfo
+		prefetched = nextLevel + 1
 	)
 	for {
-		i, err := d.getBlockInfo(ctx, nextBlock)
-		if err != nil {
-			return nil, err
-		}
-		info := &BlockInfo{
-			BlockInfo: i,
+		// only the missing segments are walked through getBlockInfo
+		i, ok := cached[nextLevel]
+		if !ok || !bytes.Equal(i.Header.Hash, nextBlock) || !isComplete(i) {
+			if ok && fromHead && !bytes.Equal(i.Header.Hash, nextBlock) {
+				// the cached block doesn't belong to the branch reachable from the head
+				if err = d.DB.MarkOrphaned(ctx, i.Header.Hash); err != nil {
+					return nil, err
+				}
+			}
+			if nextLevel < prefetched {
+				prefetched = d.fetcher().prefetch(ctx, nextBlock, nextLevel, fromLevel, cached)
+			}
+			if i, err = d.getCanonicalBlockInfo(ctx, nextBlock); err != nil {
+				return nil, err
+			}
 		}
+		info := newBlockInfo(i)
 
 		if prevBlock != nil {
 			prevBlock.PredecessorTimestamp = info.Header.Timestamp
@@ -81,7 +229,7 @@ func (d *Datasource) GetBlocksInfo(ctx context.Context, start, end time.Time) ([
 		}
 
 		prevBlock = info
-		nextBlock = info.Header.Predecessor
+		nextBlock, nextLevel = info.Header.Predecessor, info.Header.Level-1
 
 		if !info.Header.Timestamp.Before(end) {
 			continue
@@ -97,54 +245,234 @@ func (d *Datasource) GetBlocksInfo(ctx context.Context, start, end time.Time) ([
 	return res, nil
 }
 
-func (d *Datasource) MonitorBlockInfo(ctx context.Context) (blockInfo <-chan *BlockInfo, errors <-chan error, err error) {
+// GetOrphanedBlocksInfo returns cached blocks within the time range which were found to be off the canonical chain
+func (d *Datasource) GetOrphanedBlocksInfo(ctx context.Context, start, end time.Time) ([]*BlockInfo, error) {
+	orphans, err := d.DB.GetOrphanedBlocksInfo(ctx, start, end)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*BlockInfo, len(orphans))
+	for i, o := range orphans {
+		info := newBlockInfo(o)
+		// the predecessor may be orphaned as well so it's taken from the cache only
+		pred, err := d.DB.GetBlockInfo(ctx, o.Header.Predecessor)
+		if err != nil {
+			return nil, err
+		}
+		if pred != nil {
+			info.PredecessorTimestamp = pred.Header.Timestamp
+			info.Delay = int64(o.Header.Timestamp.Sub(pred.Header.Timestamp))
+			info.MinDelay = int64(o.MinValidTime.Sub(pred.Header.Timestamp))
+		}
+		res[i] = info
+	}
+	return res, nil
+}
+
+// ChainUpdate describes the change of the canonical chain caused by a new head
+type ChainUpdate struct {
+	// Orphaned blocks left the canonical chain, highest first
+	Orphaned []*BlockInfo
+	// Blocks joined the canonical chain, lowest first
+	Blocks []*BlockInfo
+}
+
+// Reorg returns true if the update switches the chain to a different branch
+func (u *ChainUpdate) Reorg() bool {
+	return len(u.Orphaned) != 0
+}
+
+// number of recently emitted levels to look for a common ancestor in
+const reorgWindow = 128
+
+type chainTracker struct {
+	ds     *Datasource
+	recent []*BlockInfo // emitted canonical blocks, lowest first
+}
+
+func (t *chainTracker) update(ctx context.Context, head model.Base58) (*ChainUpdate, error) {
+	bi, err := t.ds.getCanonicalBlockInfo(ctx, head)
+	if err != nil {
+		return nil, err
+	}
+	branch := []*model.BlockInfo{bi}
+	var orphaned []*BlockInfo
+	prefetched := bi.Header.Level
+
+	// detect branch switches by comparing levels and predecessors with the emitted blocks
+	for len(t.recent) != 0 {
+		top := t.recent[len(t.recent)-1]
+		bottom := branch[0]
+		if top.Header.Level == bottom.Header.Level && bytes.Equal(top.Header.Hash, bottom.Header.Hash) {
+			// already emitted
+			branch = branch[1:]
+			break
+		}
+		if top.Header.Level >= bottom.Header.Level-1 {
+			if bytes.Equal(top.Header.Hash, bottom.Header.Predecessor) {
+				break
+			}
+			orphaned = append(orphaned, top)
+			t.recent = t.recent[:len(t.recent)-1]
+			continue
+		}
+		// gap between the emitted blocks and the new branch
+		if len(branch) >= reorgWindow {
+			// too far behind to look for the common ancestor, start over from the recent part of the new branch
+			t.recent = nil
+			break
+		}
+		if bottom.Header.Level-1 < prefetched {
+			limit := top.Header.Level + 1
+			if l := bi.Header.Level - reorgWindow + 1; limit < l {
+				limit = l
+			}
+			cached, err := t.ds.DB.GetBlocksInfoByLevel(ctx, limit, bottom.Header.Level-1)
+			if err != nil {
+				return nil, err
+			}
+			complete := 0
+			for _, c := range cached {
+				if isComplete(c) {
+					complete++
+				}
+			}
+			if int64(complete) < bottom.Header.Level-limit {
+				prefetched = t.ds.fetcher().prefetch(ctx, bottom.Header.Hash, bottom.Header.Level, limit, cached)
+			} else {
+				prefetched = limit
+			}
+		}
+		pred, err := t.ds.getCanonicalBlockInfo(ctx, bottom.Header.Predecessor)
+		if err != nil {
+			return nil, err
+		}
+		branch = append([]*model.BlockInfo{pred}, branch...)
+	}
+
+	// emitted blocks may be read by the subscribers so the orphaned ones are copied
+	for i, o := range orphaned {
+		if err := t.ds.DB.MarkOrphaned(ctx, o.Header.Hash); err != nil {
+			return nil, err
+		}
+		tmp := *o.BlockInfo
+		tmp.Orphaned = true
+		info := *o
+		info.BlockInfo = &tmp
+		orphaned[i] = &info
+	}
+
+	update := ChainUpdate{
+		Orphaned: orphaned,
+		Blocks:   make([]*BlockInfo, len(branch)),
+	}
+	for i, b := range branch {
+		var pred *model.BlockInfo
+		if i != 0 {
+			pred = branch[i-1]
+		} else if pred, err = t.ds.getCanonicalBlockInfo(ctx, b.Header.Predecessor); err != nil {
+			return nil, err
+		}
+		info := newBlockInfo(b)
+		info.PredecessorTimestamp = pred.Header.Timestamp
+		info.Delay = int64(b.Header.Timestamp.Sub(pred.Header.Timestamp))
+		info.MinDelay = int64(b.MinValidTime.Sub(pred.Header.Timestamp))
+		update.Blocks[i] = info
+	}
+
+	t.recent = append(t.recent, update.Blocks...)
+	if len(t.recent) > reorgWindow {
+		t.recent = t.recent[len(t.recent)-reorgWindow:]
+	}
+	return &update, nil
+}
+
+// delays between reconnection attempts of the head monitor
+var (
+	monitorMinBackoff = time.Second
+	monitorMaxBackoff = 30 * time.Second
+)
+
+// MonitorBlockInfo follows the chain head. When the monitoring stream ends it reconnects with backoff
+// and backfills up to reorgWindow most recent blocks produced while it was disconnected. It stops only when the context is cancelled
+func (d *Datasource) MonitorBlockInfo(ctx context.Context) (updates <-chan *ChainUpdate, errors <-chan error, err error) {
 	var cancelFunc context.CancelFunc
 	ctx, cancelFunc = context.WithCancel(ctx)
-	headerCh, clientErrCh, err := d.Client.GetMonitorHeads(ctx)
+	// every connection has its own context to release the stream abandoned on error
+	connCtx, connCancel := context.WithCancel(ctx)
+	headerCh, clientErrCh, err := d.Client.GetMonitorHeads(connCtx)
 	if err != nil {
+		connCancel()
 		cancelFunc()
 		return nil, nil, err
 	}
-	blockinfoCh := make(chan *BlockInfo, 100)
+	updatesCh := make(chan *ChainUpdate, 100)
 	errorsCh := make(chan error, 1)
 	go (func() {
 		defer (func() {
-			close(blockinfoCh)
+			close(updatesCh)
 			close(errorsCh)
 			cancelFunc()
 		})()
 
-		var err error
-	headerLoop:
-		for h := range headerCh {
-			var bi, pred *model.BlockInfo
-			if bi, err = d.getBlockInfo(ctx, h.Hash); err != nil {
-				break
+		// the tracker survives reconnections so the first head received afterwards fills the gap
+		tracker := chainTracker{ds: d}
+		backoff := monitorMinBackoff
+		var connErr error
+		for {
+			var received bool
+			err := connErr
+			if err == nil {
+				received, err = d.followHeads(ctx, &tracker, headerCh, clientErrCh, updatesCh)
 			}
-			if pred, err = d.getBlockInfo(ctx, h.Predecessor); err != nil {
-				break
+			connCancel()
+			if ctx.Err() != nil {
+				errorsCh <- ctx.Err()
+				return
 			}
-
-			blockinfo := &BlockInfo{
-				BlockInfo:            bi,
-				PredecessorTimestamp: pred.Header.Timestamp,
-				Delay:                int64(bi.Header.Timestamp.Sub(pred.Header.Timestamp)),
-				MinDelay:             int64(bi.MinValidTime.Sub(pred.Header.Timestamp)),
+			if received {
+				backoff = monitorMinBackoff
+			}
+			if err == nil {
+				err = io.EOF
 			}
+			log.DefaultLogger.Warn("Head monitor disconnected", "error", err, "retry_in", backoff)
 
+			t := time.NewTimer(backoff)
 			select {
-			case blockinfoCh <- blockinfo:
+			case <-t.C:
 			case <-ctx.Done():
-				err = ctx.Err()
-				break headerLoop
+				t.Stop()
+				errorsCh <- ctx.Err()
+				return
+			}
+			if backoff *= 2; backoff > monitorMaxBackoff {
+				backoff = monitorMaxBackoff
 			}
-		}
 
-		if err != nil {
-			errorsCh <- err
-		} else if err, ok := <-clientErrCh; ok {
-			errorsCh <- err
+			connCtx, connCancel = context.WithCancel(ctx)
+			headerCh, clientErrCh, connErr = d.Client.GetMonitorHeads(connCtx)
 		}
 	})()
-	return blockinfoCh, errorsCh, nil
+	return updatesCh, errorsCh, nil
+}
+
+// followHeads sends updates until the monitoring stream ends. received is true if at least one head was processed
+func (d *Datasource) followHeads(ctx context.Context, tracker *chainTracker, headerCh <-chan *model.ShellBlockHeader, errCh <-chan error, updatesCh chan<- *ChainUpdate) (received bool, err error) {
+	for h := range headerCh {
+		var update *ChainUpdate
+		if update, err = tracker.update(ctx, h.Hash); err != nil {
+			return received, err
+		}
+		received = true
+		if len(update.Blocks) == 0 && !update.Reorg() {
+			continue
+		}
+		select {
+		case updatesCh <- update:
+		case <-ctx.Done():
+			return received, ctx.Err()
+		}
+	}
+	return received, <-errCh
 }
@@ -0,0 +1,274 @@
+package datasource
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ecadlabs/tezos-grafana-datasource/pkg/client"
+	"github.com/ecadlabs/tezos-grafana-datasource/pkg/model"
+	"github.com/ecadlabs/tezos-grafana-datasource/pkg/storage/bolt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testChainID = model.Base58{0x7a, 0x06, 0xa7, 0x70}
+	testT0      = time.Unix(1633000000, 0).UTC()
+)
+
+func newTestDatasource(t *testing.T) *Datasource {
+	db, err := bolt.NewBoltStorage(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	s, err := db.Chain(testChainID)
+	require.NoError(t, err)
+	return &Datasource{DB: s}
+}
+
+func putTestBlock(t *testing.T, d *Datasource, level int64, hash, pred byte) *model.BlockInfo {
+	info := &model.BlockInfo{
+		Header: &model.BlockHeader{
+			ChainID: testChainID,
+			Hash:    model.Base58{hash},
+			RawBlockHeader: model.RawBlockHeader{
+				Level:       level,
+				Predecessor: model.Base58{pred},
+				Timestamp:   testT0.Add(time.Duration(level)*time.Minute + time.Duration(hash)*time.Second),
+			},
+		},
+		Stat:     &model.BlockStatistics{Ops: &model.NumOps{}},
+		Metadata: &model.BlockMetadataInfo{},
+	}
+	require.NoError(t, d.DB.UpdateBlockInfo(context.Background(), info))
+	return info
+}
+
+func hashes(blocks []*BlockInfo) []model.Base58 {
+	res := make([]model.Base58, len(blocks))
+	for i, b := range blocks {
+		res[i] = b.Header.Hash
+	}
+	return res
+}
+
+func TestChainTracker(t *testing.T) {
+	d := newTestDatasource(t)
+	ctx := context.Background()
+	for l := int64(0); l <= 5; l++ {
+		putTestBlock(t, d, l, byte(l), byte(l-1))
+	}
+
+	tracker := chainTracker{ds: d}
+	for l := byte(1); l <= 5; l++ {
+		u, err := tracker.update(ctx, model.Base58{l})
+		require.NoError(t, err)
+		assert.False(t, u.Reorg())
+		assert.Equal(t, []model.Base58{{l}}, hashes(u.Blocks))
+	}
+
+	// the same head announced twice
+	u, err := tracker.update(ctx, model.Base58{5})
+	require.NoError(t, err)
+	assert.False(t, u.Reorg())
+	assert.Empty(t, u.Blocks)
+
+	// competing branch forked after level 3
+	putTestBlock(t, d, 4, 14, 3)
+	putTestBlock(t, d, 5, 15, 14)
+	putTestBlock(t, d, 6, 16, 15)
+	u, err = tracker.update(ctx, model.Base58{16})
+	require.NoError(t, err)
+	assert.True(t, u.Reorg())
+	assert.Equal(t, []model.Base58{{5}, {4}}, hashes(u.Orphaned))
+	assert.Equal(t, []model.Base58{{14}, {15}, {16}}, hashes(u.Blocks))
+	for _, o := range u.Orphaned {
+		assert.True(t, o.Orphaned)
+	}
+	assert.Equal(t, int64(time.Minute+11*time.Second), u.Blocks[0].Delay)
+
+	orphaned, err := d.GetOrphanedBlocksInfo(ctx, testT0, testT0.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []model.Base58{{4}, {5}}, hashes(orphaned))
+
+	blocks, err := d.DB.GetBlocksInfoByLevel(ctx, 4, 5)
+	require.NoError(t, err)
+	assert.Equal(t, model.Base58{14}, blocks[4].Header.Hash)
+	assert.Equal(t, model.Base58{15}, blocks[5].Header.Hash)
+
+	// switch back to the original branch
+	putTestBlock(t, d, 6, 6, 5)
+	putTestBlock(t, d, 7, 7, 6)
+	u, err = tracker.update(ctx, model.Base58{7})
+	require.NoError(t, err)
+	assert.Equal(t, []model.Base58{{16}, {15}, {14}}, hashes(u.Orphaned))
+	assert.Equal(t, []model.Base58{{4}, {5}, {6}, {7}}, hashes(u.Blocks))
+	for _, b := range u.Blocks {
+		assert.False(t, b.Orphaned)
+	}
+
+	orphaned, err = d.GetOrphanedBlocksInfo(ctx, testT0, testT0.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []model.Base58{{14}, {15}, {16}}, hashes(orphaned))
+}
+
+// monitorNode announces a single head per monitoring connection and closes it unless hold is set
+type monitorNode struct {
+	*mockNode
+	heads []int
+	hold  bool
+	// next heads are sent over the held connection
+	next chan int
+	conn int32
+}
+
+func (n *monitorNode) writeHead(w http.ResponseWriter, level int) {
+	b := n.blocks[level]
+	json.NewEncoder(w).Encode(&model.ShellBlockHeader{
+		Hash:        b.Hash,
+		Level:       b.Header.Level,
+		Predecessor: b.Header.Predecessor,
+		Timestamp:   b.Header.Timestamp,
+	})
+	w.(http.Flusher).Flush()
+}
+
+func (n *monitorNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, "/monitor/heads/") {
+		n.mockNode.ServeHTTP(w, r)
+		return
+	}
+	i := int(atomic.AddInt32(&n.conn, 1)) - 1
+	if i >= len(n.heads) {
+		// keep the last connection open
+		<-r.Context().Done()
+		return
+	}
+	n.writeHead(w, n.heads[i])
+	if n.hold {
+		for {
+			select {
+			case level := <-n.next:
+				n.writeHead(w, level)
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}
+}
+
+func TestChainTrackerEmittedBlocks(t *testing.T) {
+	d := newTestDatasource(t)
+	ctx := context.Background()
+	for l := int64(0); l <= 5; l++ {
+		putTestBlock(t, d, l, byte(l), byte(l-1))
+	}
+	tracker := chainTracker{ds: d}
+	u, err := tracker.update(ctx, model.Base58{5})
+	require.NoError(t, err)
+	emitted := u.Blocks[len(u.Blocks)-1]
+
+	// a subscriber reads the emitted block during the branch switch
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			assert.False(t, emitted.BlockInfo.Orphaned)
+		}
+	}()
+	putTestBlock(t, d, 5, 15, 4)
+	putTestBlock(t, d, 6, 16, 15)
+	u, err = tracker.update(ctx, model.Base58{16})
+	require.NoError(t, err)
+	<-done
+
+	require.Len(t, u.Orphaned, 1)
+	assert.True(t, u.Orphaned[0].Orphaned)
+	assert.NotSame(t, emitted, u.Orphaned[0])
+	assert.False(t, emitted.Orphaned)
+}
+
+func TestMonitorReconnect(t *testing.T) {
+	monitorMinBackoff = time.Millisecond
+	defer func() { monitorMinBackoff = time.Second }()
+
+	node := &monitorNode{
+		mockNode: newMockNode(20),
+		heads:    []int{5, 9, 12},
+	}
+	srv := httptest.NewServer(node)
+	defer srv.Close()
+
+	d := newTestDatasource(t)
+	d.Client = &client.Client{URL: srv.URL}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates, errCh, err := d.MonitorBlockInfo(ctx)
+	require.NoError(t, err)
+
+	// blocks produced while disconnected are backfilled
+	var levels []int64
+	for len(levels) < 8 {
+		select {
+		case u := <-updates:
+			require.NotNil(t, u)
+			for _, b := range u.Blocks {
+				levels = append(levels, b.Header.Level)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout")
+		}
+	}
+	assert.Equal(t, []int64{5, 6, 7, 8, 9, 10, 11, 12}, levels)
+
+	cancel()
+	for range updates {
+	}
+	assert.ErrorIs(t, <-errCh, context.Canceled)
+}
+
+func TestMonitorLongGap(t *testing.T) {
+	monitorMinBackoff = time.Millisecond
+	defer func() { monitorMinBackoff = time.Second }()
+
+	node := &monitorNode{
+		mockNode: newMockNode(400),
+		heads:    []int{5, 399},
+	}
+	srv := httptest.NewServer(node)
+	defer srv.Close()
+
+	d := newTestDatasource(t)
+	d.Client = &client.Client{URL: srv.URL}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates, errCh, err := d.MonitorBlockInfo(ctx)
+	require.NoError(t, err)
+
+	u := recvUpdate(t, updates)
+	require.Len(t, u.Blocks, 1)
+	assert.Equal(t, int64(5), u.Blocks[0].Header.Level)
+
+	// the backfill is capped by the reorganization window
+	u = recvUpdate(t, updates)
+	require.Len(t, u.Blocks, reorgWindow)
+	assert.Equal(t, int64(400-reorgWindow), u.Blocks[0].Header.Level)
+	assert.Equal(t, int64(399), u.Blocks[reorgWindow-1].Header.Level)
+	assert.False(t, u.Reorg())
+	node.mtx.Lock()
+	assert.Equal(t, 0, node.calls[node.blocks[100].Hash.String()])
+	node.mtx.Unlock()
+
+	cancel()
+	for range updates {
+	}
+	assert.ErrorIs(t, <-errCh, context.Canceled)
+}
@@ -0,0 +1,166 @@
+package datasource
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ecadlabs/tezos-grafana-datasource/pkg/client"
+	"github.com/ecadlabs/tezos-grafana-datasource/pkg/model"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+const (
+	DefaultParallelism = 8
+	fetchTimeout       = time.Minute
+	// number of ancestors to prefetch per worker
+	prefetchFactor = 4
+)
+
+type fetchCall struct {
+	done chan struct{}
+	info *model.BlockInfo
+	err  error
+	// stats collects retries of the call to be reported to every caller which started or awaited it
+	stats    *client.RetryStats
+	watchers map[*client.RetryStats]struct{}
+}
+
+// watch registers the caller's retry stats. Must be called with the fetcher's lock held
+func (c *fetchCall) watch(ctx context.Context) {
+	if s := client.RetryStatsFromContext(ctx); s != nil {
+		c.watchers[s] = struct{}{}
+	}
+}
+
+// fetcher resolves blocks using a bounded number of workers and collapses duplicate in-flight requests
+type fetcher struct {
+	ds    *Datasource
+	sem   chan struct{}
+	mtx   sync.Mutex
+	calls map[string]*fetchCall
+}
+
+func newFetcher(ds *Datasource, parallelism int) *fetcher {
+	if parallelism <= 0 {
+		parallelism = DefaultParallelism
+	}
+	return &fetcher{
+		ds:    ds,
+		sem:   make(chan struct{}, parallelism),
+		calls: make(map[string]*fetchCall),
+	}
+}
+
+func (f *fetcher) window() int {
+	return cap(f.sem) * prefetchFactor
+}
+
+// start returns the in-flight call for the block starting a new one if needed. Retries of the call are added
+// to the retry stats of ctx
+func (f *fetcher) start(ctx context.Context, blockID model.Base58) *fetchCall {
+	key := string(blockID)
+	f.mtx.Lock()
+	if c, ok := f.calls[key]; ok {
+		c.watch(ctx)
+		f.mtx.Unlock()
+		return c
+	}
+	c := &fetchCall{
+		done:     make(chan struct{}),
+		watchers: make(map[*client.RetryStats]struct{}),
+	}
+	c.watch(ctx)
+	f.calls[key] = c
+	f.mtx.Unlock()
+
+	go (func() {
+		// the call is shared between the callers so it doesn't depend on the context of any of them
+		ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+		defer cancel()
+		ctx, c.stats = client.WithRetryStats(ctx)
+
+		f.sem <- struct{}{}
+		c.info, c.err = f.ds.getBlockInfo(ctx, blockID)
+		<-f.sem
+
+		f.mtx.Lock()
+		delete(f.calls, key)
+		f.mtx.Unlock()
+		// no watchers are added after the call is removed
+		for s := range c.watchers {
+			s.Add(c.stats.Retries())
+		}
+		close(c.done)
+	})()
+	return c
+}
+
+func (f *fetcher) get(ctx context.Context, blockID model.Base58) (*model.BlockInfo, error) {
+	c := f.start(ctx, blockID)
+	select {
+	case <-c.done:
+		return c.info, c.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// prefetch starts fetching ancestors of the block at the given level down to the bottom level which are missing in cached.
+// It returns the lowest level covered
+func (f *fetcher) prefetch(ctx context.Context, blockID model.Base58, level, bottom int64, cached map[int64]*model.BlockInfo) int64 {
+	n := int64(f.window())
+	if level-bottom+1 < n {
+		n = level - bottom + 1
+	}
+	if n <= 1 {
+		return level
+	}
+	hashes, err := f.ds.Client.GetBlockHashes(ctx, blockID.String(), int(n))
+	if err != nil {
+		// prefetching is optional
+		log.DefaultLogger.Debug("Prefetch", "error", err)
+		return level
+	}
+	for i, h := range hashes {
+		if i == 0 {
+			continue
+		}
+		if c, ok := cached[level-int64(i)]; ok && bytes.Equal(c.Header.Hash, h) && isComplete(c) {
+			continue
+		}
+		f.start(ctx, h)
+	}
+	return level - int64(len(hashes)) + 1
+}
+
+// forEach calls fn for each index in range [0, n) using the fetcher's degree of parallelism. The first error cancels the remaining calls
+func (d *Datasource) forEach(ctx context.Context, n int, fn func(ctx context.Context, i int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg      sync.WaitGroup
+		errOnce sync.Once
+		err     error
+	)
+	sem := make(chan struct{}, cap(d.fetcher().sem))
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go (func(i int) {
+			defer (func() {
+				<-sem
+				wg.Done()
+			})()
+			if e := fn(ctx, i); e != nil {
+				errOnce.Do(func() {
+					err = e
+					cancel()
+				})
+			}
+		})(i)
+	}
+	wg.Wait()
+	return err
+}
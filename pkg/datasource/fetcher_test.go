@@ -0,0 +1,271 @@
+package datasource
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ecadlabs/tezos-grafana-datasource/pkg/client"
+	"github.com/ecadlabs/tezos-grafana-datasource/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testBlockInterval = 30 * time.Second
+
+// mockNode serves a linear chain of blocks
+type mockNode struct {
+	blocks    []*model.Block
+	byHash    map[string]*model.Block
+	constants *model.ProtocolConstants
+
+	mtx   sync.Mutex
+	calls map[string]int
+}
+
+func newMockNode(n int) *mockNode {
+	node := mockNode{
+		byHash: make(map[string]*model.Block),
+		calls:  make(map[string]int),
+	}
+	for i := 0; i < n; i++ {
+		b := &model.Block{
+			ChainID: testChainID,
+			Hash:    model.Base58{0, byte(i >> 8), byte(i)},
+			Header: model.RawBlockHeader{
+				Level:     int64(i),
+				Timestamp: testT0.Add(time.Duration(i) * testBlockInterval),
+			},
+		}
+		if i != 0 {
+			b.Header.Predecessor = node.blocks[i-1].Hash
+		} else {
+			b.Header.Predecessor = b.Hash
+		}
+		node.blocks = append(node.blocks, b)
+		node.byHash[b.Hash.String()] = b
+	}
+	return &node
+}
+
+func (n *mockNode) block(id string) *model.Block {
+	if id == "head" {
+		return n.blocks[len(n.blocks)-1]
+	}
+	if level, err := strconv.Atoi(id); err == nil {
+		if level < len(n.blocks) {
+			return n.blocks[level]
+		}
+		return nil
+	}
+	return n.byHash[id]
+}
+
+func (n *mockNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Split(strings.TrimPrefix(r.URL.Path, "/chains/main/blocks"), "/")
+	var res interface{}
+	switch {
+	case len(path) == 1:
+		b := n.block(r.URL.Query().Get("head"))
+		length, _ := strconv.Atoi(r.URL.Query().Get("length"))
+		var hashes []model.Base58
+		for l := b.Header.Level; l >= 0 && len(hashes) < length; l-- {
+			hashes = append(hashes, n.blocks[l].Hash)
+		}
+		res = [][]model.Base58{hashes}
+	case len(path) == 2:
+		b := n.block(path[1])
+		n.mtx.Lock()
+		n.calls[path[1]]++
+		n.mtx.Unlock()
+		time.Sleep(time.Millisecond)
+		res = b
+	case path[2] == "header":
+		if b := n.block(path[1]); b != nil {
+			res = b.GetHeader()
+		}
+	case path[2] == "context" && n.constants != nil:
+		res = n.constants
+	case path[2] == "helpers" && n.constants != nil:
+		pos := n.block(path[1]).Header.Level - 1
+		res = &model.LevelInfo{Level: pos + 1, LevelPosition: pos, Cycle: pos / n.constants.BlocksPerCycle, CyclePosition: pos % n.constants.BlocksPerCycle}
+	case path[2] == "votes" && n.constants != nil:
+		pos := n.block(path[1]).Header.Level - 1
+		res = &model.VotingPeriodInfo{VotingPeriod: model.VotingPeriod{Index: pos / n.constants.BlocksPerVotingPeriod}, Position: pos % n.constants.BlocksPerVotingPeriod}
+	case path[2] == "minimal_valid_time":
+		res = n.block(path[1]).Header.Timestamp.Add(testBlockInterval)
+	}
+	if res == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+// waitFetcherIdle waits for prefetched blocks still in flight after the query has returned
+func waitFetcherIdle(t *testing.T, d *Datasource) {
+	f := d.fetcher()
+	require.Eventually(t, func() bool {
+		f.mtx.Lock()
+		defer f.mtx.Unlock()
+		return len(f.calls) == 0
+	}, time.Second, time.Millisecond)
+}
+
+func TestGetBlocksInfo(t *testing.T) {
+	node := newMockNode(200)
+	srv := httptest.NewServer(node)
+	defer srv.Close()
+
+	d := newTestDatasource(t)
+	d.Client = &client.Client{URL: srv.URL}
+	d.Parallelism = 4
+
+	ctx := context.Background()
+	blocks, err := d.GetBlocksInfo(ctx, testT0.Add(10*testBlockInterval), testT0.Add(150*testBlockInterval))
+	require.NoError(t, err)
+	require.Len(t, blocks, 140)
+	for i, b := range blocks {
+		assert.Equal(t, int64(10+i), b.Header.Level)
+		assert.Equal(t, int64(testBlockInterval), b.Delay)
+		assert.Equal(t, int64(testBlockInterval), b.MinDelay)
+	}
+	for h, n := range node.calls {
+		assert.Equal(t, 1, n, h)
+	}
+
+	// cached
+	waitFetcherIdle(t, d)
+	node.calls = make(map[string]int)
+	blocks, err = d.GetBlocksInfo(ctx, testT0.Add(20*testBlockInterval), testT0.Add(100*testBlockInterval))
+	require.NoError(t, err)
+	require.Len(t, blocks, 80)
+	assert.Equal(t, int64(20), blocks[0].Header.Level)
+	assert.Empty(t, node.calls)
+}
+
+func TestStaleBlockInfo(t *testing.T) {
+	node := newMockNode(20)
+	srv := httptest.NewServer(node)
+	defer srv.Close()
+
+	d := newTestDatasource(t)
+	d.Client = &client.Client{URL: srv.URL}
+
+	ctx := context.Background()
+	_, err := d.GetBlocksInfo(ctx, testT0.Add(5*testBlockInterval), testT0.Add(15*testBlockInterval))
+	require.NoError(t, err)
+	waitFetcherIdle(t, d)
+
+	// as cached by older versions
+	stale := node.blocks[10]
+	info, err := d.DB.GetBlockInfo(ctx, stale.Hash)
+	require.NoError(t, err)
+	tmp := *info
+	tmp.Metadata = nil
+	require.NoError(t, d.DB.UpdateBlockInfo(ctx, &tmp))
+
+	node.calls = make(map[string]int)
+	blocks, err := d.GetBlocksInfo(ctx, testT0.Add(5*testBlockInterval), testT0.Add(15*testBlockInterval))
+	require.NoError(t, err)
+	require.Len(t, blocks, 10)
+	assert.Equal(t, map[string]int{stale.Hash.String(): 1}, node.calls)
+	assert.NotNil(t, blocks[5].Metadata)
+
+	info, err = d.DB.GetBlockInfo(ctx, stale.Hash)
+	require.NoError(t, err)
+	assert.NotNil(t, info.Metadata)
+}
+
+func TestFetcherRetryStats(t *testing.T) {
+	node := newMockNode(20)
+	// every block fetch fails once
+	var (
+		mtx    sync.Mutex
+		failed = make(map[string]bool)
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.Split(strings.TrimPrefix(r.URL.Path, "/chains/main/blocks/"), "/")
+		if len(path) == 1 && path[0] != "" {
+			mtx.Lock()
+			first := !failed[path[0]]
+			failed[path[0]] = true
+			mtx.Unlock()
+			if first {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		}
+		node.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	d := newTestDatasource(t)
+	d.Client = &client.Client{
+		URL: srv.URL,
+		Retry: &client.RetryPolicy{
+			MaxRetries:      3,
+			MinBackoff:      time.Millisecond,
+			MaxBackoff:      time.Millisecond,
+			RetryableStatus: client.DefaultRetryPolicy.RetryableStatus,
+		},
+	}
+
+	// retries of the shared fetches are reported to the query
+	ctx, stats := client.WithRetryStats(context.Background())
+	blocks, err := d.GetBlocksInfo(ctx, testT0.Add(5*testBlockInterval), testT0.Add(15*testBlockInterval))
+	require.NoError(t, err)
+	require.Len(t, blocks, 10)
+	assert.GreaterOrEqual(t, stats.Retries(), int64(10))
+}
+
+func TestTenderbakeBlocksInfo(t *testing.T) {
+	node := newMockNode(20)
+	node.constants = &model.ProtocolConstants{MinimalBlockDelay: 30, DelayIncrementPerRound: 15}
+	for i, b := range node.blocks {
+		// level 10 is produced at round 1
+		var round, predRound int32
+		if i == 10 {
+			round = 1
+			b.Header.Timestamp = b.Header.Timestamp.Add(30 * time.Second)
+		} else if i == 11 {
+			predRound = 1
+		}
+		b.Header.PayloadHash = model.Base58{1, byte(i)}
+		b.Header.Fitness = []model.Bytes{{2}, {0, 0, 0, byte(i)}, {}, int32Bytes(-predRound - 1), int32Bytes(round)}
+	}
+	srv := httptest.NewServer(node)
+	defer srv.Close()
+
+	d := newTestDatasource(t)
+	d.Client = &client.Client{URL: srv.URL}
+
+	blocks, err := d.GetBlocksInfo(context.Background(), testT0.Add(5*testBlockInterval), testT0.Add(15*testBlockInterval))
+	require.NoError(t, err)
+	require.Len(t, blocks, 10)
+	for _, b := range blocks {
+		switch b.Header.Level {
+		case 10:
+			assert.Equal(t, int64(1), b.Round)
+			// the predecessor's round 0 followed by round 0
+			assert.Equal(t, int64(60*time.Second), b.MinDelay)
+			assert.Equal(t, int64(60*time.Second), b.Delay)
+		case 11:
+			// the predecessor's round 1 lasts 45s
+			assert.Equal(t, int64(45*time.Second), b.MinDelay)
+		default:
+			assert.Equal(t, int64(0), b.Round)
+			assert.Equal(t, int64(30*time.Second), b.MinDelay)
+		}
+	}
+}
+
+func int32Bytes(v int32) model.Bytes {
+	return model.Bytes{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+}
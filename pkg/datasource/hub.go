@@ -0,0 +1,168 @@
+package datasource
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// number of updates buffered per subscriber
+const hubBuffer = 100
+
+// ErrSlowSubscriber is returned to a subscriber not keeping up with the updates
+var ErrSlowSubscriber = errors.New("subscriber is too slow")
+
+// Hub shares a single head monitor between all live subscribers.
+// The monitor is started with the first subscriber and stopped after the last one leaves
+type Hub struct {
+	ds  *Datasource
+	mtx sync.Mutex
+	run *hubRun
+	// starting is closed when the monitor being connected is installed or has failed
+	starting chan struct{}
+}
+
+type hubRun struct {
+	cancel context.CancelFunc
+	subs   map[*hubSub]struct{}
+	// the latest canonical block to be sent to new subscribers
+	last *BlockInfo
+}
+
+type hubSub struct {
+	updates chan *ChainUpdate
+	errors  chan error
+	// done is closed when the subscriber is removed
+	done chan struct{}
+}
+
+func NewHub(ds *Datasource) *Hub {
+	return &Hub{ds: ds}
+}
+
+// Subscribe returns chain updates until the context is cancelled. The first update holds the current head
+func (h *Hub) Subscribe(ctx context.Context) (updates <-chan *ChainUpdate, errors <-chan error, err error) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	// the monitor is connected outside the lock, concurrent subscribers wait for it
+	for h.run == nil {
+		if starting := h.starting; starting != nil {
+			h.mtx.Unlock()
+			select {
+			case <-starting:
+			case <-ctx.Done():
+				h.mtx.Lock()
+				return nil, nil, ctx.Err()
+			}
+			h.mtx.Lock()
+			continue
+		}
+		starting := make(chan struct{})
+		h.starting = starting
+		h.mtx.Unlock()
+
+		monCtx, cancel := context.WithCancel(context.Background())
+		updatesCh, errCh, err := h.ds.MonitorBlockInfo(monCtx)
+
+		h.mtx.Lock()
+		h.starting = nil
+		close(starting)
+		if err != nil {
+			cancel()
+			return nil, nil, err
+		}
+		h.run = &hubRun{
+			cancel: cancel,
+			subs:   make(map[*hubSub]struct{}),
+		}
+		go h.loop(h.run, updatesCh, errCh)
+	}
+
+	run := h.run
+	sub := &hubSub{
+		updates: make(chan *ChainUpdate, hubBuffer),
+		errors:  make(chan error, 1),
+		done:    make(chan struct{}),
+	}
+	if run.last != nil {
+		sub.updates <- &ChainUpdate{Blocks: []*BlockInfo{run.last}}
+	}
+	run.subs[sub] = struct{}{}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			h.mtx.Lock()
+			h.remove(run, sub, ctx.Err())
+			h.mtx.Unlock()
+		case <-sub.done:
+			// dropped by the hub
+		}
+	}()
+	return sub.updates, sub.errors, nil
+}
+
+// remove detaches the subscriber and stops the monitor if it was the last one. Must be called with the lock held
+func (h *Hub) remove(run *hubRun, sub *hubSub, err error) {
+	if _, ok := run.subs[sub]; !ok {
+		return
+	}
+	delete(run.subs, sub)
+	close(sub.done)
+	sub.errors <- err
+	close(sub.errors)
+	close(sub.updates)
+	if len(run.subs) == 0 && h.run == run {
+		h.run = nil
+		run.cancel()
+	}
+}
+
+func (h *Hub) loop(run *hubRun, updates <-chan *ChainUpdate, errCh <-chan error) {
+	for u := range updates {
+		h.mtx.Lock()
+		if len(u.Blocks) != 0 {
+			run.last = u.Blocks[len(u.Blocks)-1]
+		}
+		for sub := range run.subs {
+			select {
+			case sub.updates <- u:
+			default:
+				h.remove(run, sub, ErrSlowSubscriber)
+			}
+		}
+		h.mtx.Unlock()
+	}
+
+	err := <-errCh
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if h.run == run {
+		h.run = nil
+	}
+	for sub := range run.subs {
+		h.remove(run, sub, err)
+	}
+}
+
+// Subscribers returns the number of active subscribers
+func (h *Hub) Subscribers() int {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if h.run == nil {
+		return 0
+	}
+	return len(h.run.subs)
+}
+
+// Close disconnects all subscribers
+func (h *Hub) Close() {
+	h.mtx.Lock()
+	run := h.run
+	h.run = nil
+	h.mtx.Unlock()
+	if run != nil {
+		run.cancel()
+	}
+}
@@ -0,0 +1,193 @@
+package datasource
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ecadlabs/tezos-grafana-datasource/pkg/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func recvUpdate(t *testing.T, ch <-chan *ChainUpdate) *ChainUpdate {
+	select {
+	case u, ok := <-ch:
+		require.True(t, ok)
+		return u
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+	return nil
+}
+
+func TestHub(t *testing.T) {
+	node := &monitorNode{
+		mockNode: newMockNode(10),
+		heads:    []int{5, 7},
+		hold:     true,
+	}
+	srv := httptest.NewServer(node)
+	defer srv.Close()
+
+	d := newTestDatasource(t)
+	d.Client = &client.Client{URL: srv.URL}
+	hub := NewHub(d)
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	defer cancel1()
+	updates1, errCh1, err := hub.Subscribe(ctx1)
+	require.NoError(t, err)
+	u := recvUpdate(t, updates1)
+	assert.Equal(t, int64(5), u.Blocks[0].Header.Level)
+
+	// the second subscriber shares the connection and gets the current head
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	updates2, _, err := hub.Subscribe(ctx2)
+	require.NoError(t, err)
+	u = recvUpdate(t, updates2)
+	assert.Equal(t, int64(5), u.Blocks[0].Header.Level)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&node.conn))
+	assert.Equal(t, 2, hub.Subscribers())
+
+	cancel1()
+	for range updates1 {
+	}
+	assert.ErrorIs(t, <-errCh1, context.Canceled)
+	assert.Equal(t, 1, hub.Subscribers())
+
+	// the monitor is stopped after the last subscriber leaves and restarted on demand
+	cancel2()
+	for range updates2 {
+	}
+	assert.Equal(t, 0, hub.Subscribers())
+
+	ctx3, cancel3 := context.WithCancel(context.Background())
+	defer cancel3()
+	updates3, _, err := hub.Subscribe(ctx3)
+	require.NoError(t, err)
+	u = recvUpdate(t, updates3)
+	assert.Equal(t, int64(7), u.Blocks[len(u.Blocks)-1].Header.Level)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&node.conn))
+	hub.Close()
+	for range updates3 {
+	}
+}
+
+func TestHubConnectUnlocked(t *testing.T) {
+	node := &monitorNode{
+		mockNode: newMockNode(10),
+		heads:    []int{5},
+		hold:     true,
+	}
+	gate := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/monitor/heads/") {
+			<-gate
+		}
+		node.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	d := newTestDatasource(t)
+	d.Client = &client.Client{URL: srv.URL}
+	hub := NewHub(d)
+	defer hub.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	type result struct {
+		updates <-chan *ChainUpdate
+		err     error
+	}
+	results := make(chan result, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			updates, _, err := hub.Subscribe(ctx)
+			results <- result{updates, err}
+		}()
+	}
+
+	// the hub isn't locked while connecting
+	require.Eventually(t, func() bool {
+		hub.mtx.Lock()
+		defer hub.mtx.Unlock()
+		return hub.starting != nil
+	}, 5*time.Second, time.Millisecond)
+	assert.Equal(t, 0, hub.Subscribers())
+
+	close(gate)
+	for i := 0; i < 2; i++ {
+		r := <-results
+		require.NoError(t, r.err)
+		u := recvUpdate(t, r.updates)
+		assert.Equal(t, int64(5), u.Blocks[0].Header.Level)
+	}
+	// concurrent subscribers share the connection
+	assert.Equal(t, int32(1), atomic.LoadInt32(&node.conn))
+	assert.Equal(t, 2, hub.Subscribers())
+}
+
+func TestHubSlowSubscriberLeak(t *testing.T) {
+	const rounds = 5
+	node := &monitorNode{
+		mockNode: newMockNode(hubBuffer*(rounds+1) + 10),
+		heads:    []int{5},
+		hold:     true,
+		next:     make(chan int),
+	}
+	srv := httptest.NewServer(node)
+	defer srv.Close()
+
+	d := newTestDatasource(t)
+	d.Client = &client.Client{URL: srv.URL}
+	hub := NewHub(d)
+	defer hub.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// keeps the monitor running and reports the levels received
+	keeper, _, err := hub.Subscribe(ctx)
+	require.NoError(t, err)
+	levels := make(chan int64, hubBuffer)
+	go func() {
+		for u := range keeper {
+			for _, b := range u.Blocks {
+				levels <- b.Header.Level
+			}
+		}
+	}()
+	<-levels
+
+	level := 5
+	base := runtime.NumGoroutine()
+	for i := 0; i < rounds; i++ {
+		// the same long lived context is used to subscribe again
+		_, errCh, err := hub.Subscribe(ctx)
+		require.NoError(t, err)
+	push:
+		for {
+			level++
+			node.next <- level
+			for l := <-levels; l != int64(level); l = <-levels {
+			}
+			select {
+			case err := <-errCh:
+				assert.ErrorIs(t, err, ErrSlowSubscriber)
+				break push
+			default:
+			}
+		}
+	}
+	// Eventually would add its own goroutines
+	for i := 0; i < 100 && runtime.NumGoroutine() > base; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), base)
+}
@@ -0,0 +1,240 @@
+package datasource
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ecadlabs/tezos-grafana-datasource/pkg/model"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+const (
+	indexerRetryDelay = 10 * time.Second
+	indexerChunkSize  = 1000
+)
+
+// Indexer follows the chain head and backfills the block cache in background
+type Indexer struct {
+	ds     *Datasource
+	hub    *Hub
+	depth  int64
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mtx         sync.Mutex
+	lo, hi      int64
+	gen         int
+	backfilling bool
+	err         error
+}
+
+// IndexerStatus holds the range of levels indexed contiguously down from the latest head
+type IndexerStatus struct {
+	Lowest  int64 `json:"lowest_level"`
+	Highest int64 `json:"highest_level"`
+	Depth   int64 `json:"depth"`
+	Error   error `json:"-"`
+}
+
+// NewIndexer starts an indexer which keeps up to depth blocks below the head in the cache.
+// The head is followed through the shared hub
+func NewIndexer(ds *Datasource, hub *Hub, depth int64) *Indexer {
+	ctx, cancel := context.WithCancel(context.Background())
+	ix := &Indexer{
+		ds:     ds,
+		hub:    hub,
+		depth:  depth,
+		cancel: cancel,
+		done:   make(chan struct{}),
+		lo:     -1,
+		hi:     -1,
+	}
+	go ix.run(ctx)
+	return ix
+}
+
+// Stop stops the indexer and waits for it to finish
+func (ix *Indexer) Stop() {
+	ix.cancel()
+	<-ix.done
+}
+
+func (ix *Indexer) Status() *IndexerStatus {
+	ix.mtx.Lock()
+	defer ix.mtx.Unlock()
+	return &IndexerStatus{
+		Lowest:  ix.lo,
+		Highest: ix.hi,
+		Depth:   ix.depth,
+		Error:   ix.err,
+	}
+}
+
+// Reset forgets the indexing progress, e.g. after the cache was purged
+func (ix *Indexer) Reset() {
+	ix.mtx.Lock()
+	ix.lo, ix.hi = -1, -1
+	ix.gen++
+	ix.mtx.Unlock()
+}
+
+func (ix *Indexer) setError(err error) {
+	ix.mtx.Lock()
+	ix.err = err
+	ix.mtx.Unlock()
+}
+
+func (ix *Indexer) run(ctx context.Context) {
+	var wg sync.WaitGroup
+	defer (func() {
+		wg.Wait()
+		close(ix.done)
+	})()
+
+	for {
+		err := ix.follow(ctx, &wg)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			err = errors.New("head monitor stopped")
+		}
+		log.DefaultLogger.Warn("Indexer", "error", err)
+		ix.setError(err)
+
+		t := time.NewTimer(indexerRetryDelay)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return
+		}
+	}
+}
+
+func (ix *Indexer) follow(ctx context.Context, wg *sync.WaitGroup) error {
+	updates, errCh, err := ix.hub.Subscribe(ctx)
+	if err != nil {
+		return err
+	}
+	for u := range updates {
+		if len(u.Blocks) == 0 {
+			continue
+		}
+		info, err := ix.indexHead(ctx, u.Blocks[len(u.Blocks)-1].BlockInfo)
+		if err != nil {
+			return err
+		}
+
+		ix.mtx.Lock()
+		ix.err = nil
+		if ix.lo < 0 {
+			ix.lo = info.Header.Level
+		}
+		startBackfill := !ix.backfilling && ix.lo > info.Header.Level-ix.depth+1
+		if startBackfill {
+			ix.backfilling = true
+		}
+		ix.mtx.Unlock()
+
+		if startBackfill {
+			wg.Add(1)
+			go (func() {
+				defer wg.Done()
+				if err := ix.backfill(ctx); err != nil && ctx.Err() == nil {
+					log.DefaultLogger.Warn("Indexer backfill", "error", err)
+					ix.setError(err)
+				}
+				ix.mtx.Lock()
+				ix.backfilling = false
+				ix.mtx.Unlock()
+			})()
+		}
+	}
+	return <-errCh
+}
+
+// indexHead stores the blocks missed since the previous head, e.g. after the hub was restarted
+func (ix *Indexer) indexHead(ctx context.Context, head *model.BlockInfo) (*model.BlockInfo, error) {
+	ix.mtx.Lock()
+	hi := ix.hi
+	ix.mtx.Unlock()
+
+	info := head
+	var err error
+	for hi >= 0 && info.Header.Level-1 > hi {
+		if info, err = ix.ds.getBlockInfo(ctx, info.Header.Predecessor); err != nil {
+			return nil, err
+		}
+	}
+
+	ix.mtx.Lock()
+	ix.hi = head.Header.Level
+	ix.mtx.Unlock()
+	return head, nil
+}
+
+// backfill walks down from the lowest indexed level until the configured depth is reached
+func (ix *Indexer) backfill(ctx context.Context) error {
+	ix.mtx.Lock()
+	lo, gen := ix.lo, ix.gen
+	ix.mtx.Unlock()
+
+	bottom, err := ix.ds.DB.GetBlocksInfoByLevel(ctx, lo, lo)
+	if err != nil {
+		return err
+	}
+	b, ok := bottom[lo]
+	if !ok {
+		return nil
+	}
+	next, level := b.Header.Predecessor, lo-1
+
+	for level >= 0 {
+		ix.mtx.Lock()
+		limit := ix.hi - ix.depth + 1
+		ix.mtx.Unlock()
+		if limit < 0 {
+			limit = 0
+		}
+		if level < limit {
+			return nil
+		}
+
+		from := level - indexerChunkSize + 1
+		if from < limit {
+			from = limit
+		}
+		cached, err := ix.ds.DB.GetBlocksInfoByLevel(ctx, from, level)
+		if err != nil {
+			return err
+		}
+		prefetched := level + 1
+		for ; level >= from; level-- {
+			i, ok := cached[level]
+			if !ok || !bytes.Equal(i.Header.Hash, next) || !isComplete(i) {
+				if level < prefetched {
+					prefetched = ix.ds.fetcher().prefetch(ctx, next, level, from, cached)
+				}
+				if i, err = ix.ds.getCanonicalBlockInfo(ctx, next); err != nil {
+					return err
+				}
+			}
+			next = i.Header.Predecessor
+
+			ix.mtx.Lock()
+			reset := ix.gen != gen
+			if !reset {
+				ix.lo = level
+			}
+			ix.mtx.Unlock()
+			if reset {
+				return nil
+			}
+		}
+	}
+	return nil
+}
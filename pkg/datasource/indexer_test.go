@@ -0,0 +1,57 @@
+package datasource
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ecadlabs/tezos-grafana-datasource/pkg/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func waitIndexed(t *testing.T, ix *Indexer, lo, hi int64) {
+	require.Eventually(t, func() bool {
+		st := ix.Status()
+		return st.Lowest == lo && st.Highest == hi
+	}, 5*time.Second, time.Millisecond, "%+v", ix.Status())
+}
+
+func TestIndexer(t *testing.T) {
+	node := &monitorNode{
+		mockNode: newMockNode(30),
+		heads:    []int{20},
+		hold:     true,
+		next:     make(chan int),
+	}
+	srv := httptest.NewServer(node)
+	defer srv.Close()
+
+	d := newTestDatasource(t)
+	d.Client = &client.Client{URL: srv.URL}
+	hub := NewHub(d)
+	defer hub.Close()
+	ix := NewIndexer(d, hub, 10)
+	defer ix.Stop()
+
+	// the cache is backfilled down to the configured depth
+	waitIndexed(t, ix, 11, 20)
+	waitFetcherIdle(t, d)
+	blocks, err := d.DB.GetBlocksInfoByLevel(context.Background(), 0, 29)
+	require.NoError(t, err)
+	var levels []int64
+	for l := range blocks {
+		levels = append(levels, l)
+	}
+	assert.ElementsMatch(t, []int64{11, 12, 13, 14, 15, 16, 17, 18, 19, 20}, levels)
+
+	// new heads are followed through the hub along with the skipped levels
+	node.next <- 24
+	waitIndexed(t, ix, 11, 24)
+	blocks, err = d.DB.GetBlocksInfoByLevel(context.Background(), 21, 24)
+	require.NoError(t, err)
+	assert.Len(t, blocks, 4)
+	assert.Equal(t, 1, hub.Subscribers())
+	assert.NoError(t, ix.Status().Error)
+}
@@ -0,0 +1,405 @@
+package datasource
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ecadlabs/tezos-grafana-datasource/pkg/model"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+const (
+	DefaultMempoolInterval = 5 * time.Second
+	// number of snapshots kept in memory, 12 hours at the default interval
+	mempoolHistorySize = 8640
+	// operations left the mempool without being included are forgotten after this period
+	mempoolSeenTTL = time.Hour
+	// tracking stops after this period without queries and subscribers
+	DefaultMempoolIdleTimeout = 10 * time.Minute
+)
+
+// MempoolSnapshot summarizes the mempool content at a moment
+type MempoolSnapshot struct {
+	Timestamp time.Time `json:"timestamp"`
+	// Level is the latest head level seen
+	Level int64 `json:"level"`
+	// Total is the number of pending operations of all classes
+	Total         int `json:"total"`
+	Applied       int `json:"applied"`
+	Refused       int `json:"refused"`
+	Outdated      int `json:"outdated"`
+	BranchRefused int `json:"branch_refused"`
+	BranchDelayed int `json:"branch_delayed"`
+	Unprocessed   int `json:"unprocessed"`
+	// Ops counts pending operation contents by kind
+	Ops *model.NumOps `json:"n_ops"`
+	// Included is a number of operations seen in the mempool and included into blocks since the previous snapshot
+	Included int `json:"included"`
+	// LatencyAvg and LatencyMax are times in seconds from the first sight of the included operations to the inclusion
+	LatencyAvg float64 `json:"latency_avg" tz:"s" title:"Average inclusion latency"`
+	LatencyMax float64 `json:"latency_max" tz:"s" title:"Max inclusion latency"`
+}
+
+type MempoolSnapshotInfo struct {
+	Mempool *MempoolSnapshot `json:"mempool"`
+}
+
+type PendingOperationInfo struct {
+	Operation *model.MempoolOperationInfo `json:"operation"`
+}
+
+type mempoolSub struct {
+	snapshots chan *MempoolSnapshot
+	errors    chan error
+}
+
+// Mempool polls the node's mempool keeping a history of snapshots. Operation hashes seen in the mempool
+// are matched against the operations of new blocks to measure the inclusion latency
+type Mempool struct {
+	ds       *Datasource
+	hub      *Hub
+	interval time.Duration
+	idle     time.Duration
+
+	startMtx sync.Mutex
+	cancel   context.CancelFunc
+	done     chan struct{}
+
+	mtx       sync.Mutex
+	firstSeen map[string]time.Time
+	pending   []*model.MempoolOperationInfo
+	history   []*MempoolSnapshot
+	level     int64
+	latencies []time.Duration
+	subs      map[*mempoolSub]struct{}
+	// lastUsed is the time of the latest query
+	lastUsed time.Time
+}
+
+// NewMempool returns a stopped mempool tracker. New blocks are received from the hub
+func NewMempool(ds *Datasource, hub *Hub, interval time.Duration) *Mempool {
+	if interval <= 0 {
+		interval = DefaultMempoolInterval
+	}
+	return &Mempool{
+		ds:        ds,
+		hub:       hub,
+		interval:  interval,
+		idle:      DefaultMempoolIdleTimeout,
+		firstSeen: make(map[string]time.Time),
+		subs:      make(map[*mempoolSub]struct{}),
+	}
+}
+
+// Start takes the first snapshot and starts tracking the mempool in background if it's not running yet.
+// Tracking stops by itself after the idle timeout without Start calls and subscribers
+func (m *Mempool) Start(ctx context.Context) error {
+	m.startMtx.Lock()
+	defer m.startMtx.Unlock()
+	m.mtx.Lock()
+	m.lastUsed = time.Now()
+	m.mtx.Unlock()
+	if m.cancel != nil {
+		select {
+		case <-m.done:
+			// stopped after the idle timeout
+			m.cancel()
+			m.cancel = nil
+		default:
+			return nil
+		}
+	}
+	if err := m.refresh(ctx); err != nil {
+		return err
+	}
+	var runCtx context.Context
+	runCtx, m.cancel = context.WithCancel(context.Background())
+	m.done = make(chan struct{})
+	go m.run(runCtx)
+	return nil
+}
+
+// Stop stops tracking and disconnects the subscribers
+func (m *Mempool) Stop() {
+	m.startMtx.Lock()
+	defer m.startMtx.Unlock()
+	if m.cancel == nil {
+		return
+	}
+	m.cancel()
+	<-m.done
+	m.cancel = nil
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	for sub := range m.subs {
+		m.remove(sub, context.Canceled)
+	}
+}
+
+func (m *Mempool) run(ctx context.Context) {
+	defer close(m.done)
+
+	seenCh := m.watch(ctx)
+	updates, _, err := m.hub.Subscribe(ctx)
+	if err != nil {
+		log.DefaultLogger.Warn("Mempool", "error", err)
+	}
+
+	t := time.NewTicker(m.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if m.isIdle(time.Now()) {
+				log.DefaultLogger.Info("Mempool tracking stopped, no queries or subscribers")
+				return
+			}
+			if err := m.refresh(ctx); err != nil && ctx.Err() == nil {
+				log.DefaultLogger.Warn("Mempool", "error", err)
+			}
+			if updates == nil {
+				if updates, _, err = m.hub.Subscribe(ctx); err != nil {
+					log.DefaultLogger.Warn("Mempool", "error", err)
+				}
+			}
+
+		case hashes := <-seenCh:
+			m.see(hashes, time.Now())
+
+		case u, ok := <-updates:
+			if !ok {
+				updates = nil
+				continue
+			}
+			if err := m.include(ctx, u); err != nil && ctx.Err() == nil {
+				log.DefaultLogger.Warn("Mempool", "error", err)
+			}
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (m *Mempool) isIdle(now time.Time) bool {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return len(m.subs) == 0 && now.Sub(m.lastUsed) > m.idle
+}
+
+// watch follows the operations entering the mempool. The node ends the stream on every new head so it's reopened immediately
+func (m *Mempool) watch(ctx context.Context) <-chan []model.Base58 {
+	ch := make(chan []model.Base58, 100)
+	go func() {
+		backoff := monitorMinBackoff
+		for {
+			var received bool
+			opsCh, errCh, err := m.ds.Client.GetMonitorOperations(ctx)
+			if err == nil {
+				for ops := range opsCh {
+					received = true
+					hashes := make([]model.Base58, len(ops))
+					for i, op := range ops {
+						hashes[i] = op.Hash
+					}
+					select {
+					case ch <- hashes:
+					case <-ctx.Done():
+					}
+				}
+				err = <-errCh
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			if err == nil && received {
+				backoff = monitorMinBackoff
+				continue
+			}
+			if err != nil {
+				log.DefaultLogger.Warn("Mempool monitor", "error", err, "retry_in", backoff)
+			}
+			t := time.NewTimer(backoff)
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+				return
+			}
+			if backoff *= 2; backoff > monitorMaxBackoff {
+				backoff = monitorMaxBackoff
+			}
+		}
+	}()
+	return ch
+}
+
+func (m *Mempool) see(hashes []model.Base58, now time.Time) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	for _, h := range hashes {
+		if _, ok := m.firstSeen[string(h)]; !ok {
+			m.firstSeen[string(h)] = now
+		}
+	}
+}
+
+// include matches operations of the new blocks against the ones seen in the mempool
+func (m *Mempool) include(ctx context.Context, u *ChainUpdate) error {
+	for _, b := range u.Blocks {
+		ops, err := m.ds.getOperationsInfo(ctx, b.Header.Hash)
+		if err != nil {
+			return err
+		}
+		m.mtx.Lock()
+		if b.Header.Level > m.level {
+			m.level = b.Header.Level
+		}
+		for _, op := range ops {
+			seen, ok := m.firstSeen[string(op.Hash)]
+			if !ok {
+				continue
+			}
+			latency := b.Header.Timestamp.Sub(seen)
+			if latency < 0 {
+				latency = 0
+			}
+			m.latencies = append(m.latencies, latency)
+			delete(m.firstSeen, string(op.Hash))
+		}
+		m.mtx.Unlock()
+	}
+	return nil
+}
+
+// refresh takes a new snapshot of the mempool and sends it to the subscribers
+func (m *Mempool) refresh(ctx context.Context) error {
+	pending, err := m.ds.Client.GetPendingOperations(ctx)
+	if err != nil {
+		return err
+	}
+	ops := pending.OperationsInfo()
+	now := time.Now()
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	snapshot := MempoolSnapshot{
+		Timestamp:     now,
+		Level:         m.level,
+		Total:         len(pending.Applied) + len(pending.Refused) + len(pending.Outdated) + len(pending.BranchRefused) + len(pending.BranchDelayed) + len(pending.Unprocessed),
+		Applied:       len(pending.Applied),
+		Refused:       len(pending.Refused),
+		Outdated:      len(pending.Outdated),
+		BranchRefused: len(pending.BranchRefused),
+		BranchDelayed: len(pending.BranchDelayed),
+		Unprocessed:   len(pending.Unprocessed),
+		Ops:           &model.NumOps{},
+		Included:      len(m.latencies),
+	}
+	current := make(map[string]bool, len(ops))
+	for _, op := range ops {
+		key := string(op.Hash)
+		current[key] = true
+		seen, ok := m.firstSeen[key]
+		if !ok {
+			seen = now
+			m.firstSeen[key] = seen
+		}
+		op.FirstSeen = seen
+		if k, ok := model.DefaultOperationKinds[op.Kind]; ok {
+			*k.Counter(snapshot.Ops)++
+		} else {
+			snapshot.Ops.Other++
+		}
+	}
+	for key, seen := range m.firstSeen {
+		if !current[key] && now.Sub(seen) > mempoolSeenTTL {
+			delete(m.firstSeen, key)
+		}
+	}
+
+	if len(m.latencies) != 0 {
+		var sum, max time.Duration
+		for _, l := range m.latencies {
+			sum += l
+			if l > max {
+				max = l
+			}
+		}
+		snapshot.LatencyAvg = (sum / time.Duration(len(m.latencies))).Seconds()
+		snapshot.LatencyMax = max.Seconds()
+		m.latencies = m.latencies[:0]
+	}
+
+	m.pending = ops
+	m.history = append(m.history, &snapshot)
+	if len(m.history) > mempoolHistorySize {
+		m.history = m.history[len(m.history)-mempoolHistorySize:]
+	}
+	for sub := range m.subs {
+		select {
+		case sub.snapshots <- &snapshot:
+		default:
+			m.remove(sub, ErrSlowSubscriber)
+		}
+	}
+	return nil
+}
+
+// History returns the snapshots taken within [start, end) time range
+func (m *Mempool) History(start, end time.Time) []*MempoolSnapshot {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	var res []*MempoolSnapshot
+	for _, s := range m.history {
+		if !s.Timestamp.Before(start) && s.Timestamp.Before(end) {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// Pending returns the operations found in the mempool by the latest snapshot
+func (m *Mempool) Pending() []*model.MempoolOperationInfo {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	res := make([]*model.MempoolOperationInfo, len(m.pending))
+	copy(res, m.pending)
+	return res
+}
+
+// Subscribe returns new snapshots until the context is cancelled. The mempool tracker must be started
+func (m *Mempool) Subscribe(ctx context.Context) (snapshots <-chan *MempoolSnapshot, errors <-chan error) {
+	sub := &mempoolSub{
+		snapshots: make(chan *MempoolSnapshot, hubBuffer),
+		errors:    make(chan error, 1),
+	}
+	m.mtx.Lock()
+	m.subs[sub] = struct{}{}
+	m.lastUsed = time.Now()
+	m.mtx.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		m.mtx.Lock()
+		m.remove(sub, ctx.Err())
+		// the idle period starts when the last subscriber leaves
+		m.lastUsed = time.Now()
+		m.mtx.Unlock()
+	}()
+	return sub.snapshots, sub.errors
+}
+
+// remove detaches the subscriber. Must be called with the lock held
+func (m *Mempool) remove(sub *mempoolSub, err error) {
+	if _, ok := m.subs[sub]; !ok {
+		return
+	}
+	delete(m.subs, sub)
+	sub.errors <- err
+	close(sub.errors)
+	close(sub.snapshots)
+}
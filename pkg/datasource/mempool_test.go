@@ -0,0 +1,142 @@
+package datasource
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ecadlabs/tezos-grafana-datasource/pkg/client"
+	"github.com/ecadlabs/tezos-grafana-datasource/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testOpHashA = model.Base58{1, 2, 3}
+	testOpHashB = model.Base58{1, 2, 4}
+	testBlockX  = model.Base58{9, 9, 9}
+)
+
+func testTransaction(hash model.Base58) string {
+	return fmt.Sprintf(`{"hash": "%[1]s", "branch": "%[1]s", "signature": "%[1]s", "contents": [{
+		"kind": "transaction", "source": "%[2]s", "fee": "1420", "counter": "2", "gas_limit": "10600",
+		"storage_limit": "300", "amount": "1000000", "destination": "%[2]s"}]}`, hash, testDelegateA)
+}
+
+func testBatch(hash model.Base58) string {
+	tx := fmt.Sprintf(`{"kind": "transaction", "source": "%[1]s", "fee": "1420", "counter": "2", "gas_limit": "10600",
+		"storage_limit": "300", "amount": "1000000", "destination": "%[1]s"}`, testDelegateA)
+	return fmt.Sprintf(`{"hash": "%[1]s", "branch": "%[1]s", "signature": "%[1]s", "contents": [%[2]s, %[2]s]}`, hash, tx)
+}
+
+var testOpHashC = model.Base58{1, 2, 5}
+
+func mempoolNode(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/chains/main/mempool/pending_operations":
+		fmt.Fprintf(w, `{"applied": [%s, %s], "refused": [], "outdated": [], "branch_refused": [], "branch_delayed": [["%s", %s]], "unprocessed": []}`,
+			testTransaction(testOpHashA), testTransaction(testOpHashB), testOpHashC, testBatch(testOpHashC))
+	case fmt.Sprintf("/chains/main/blocks/%s/operations", testBlockX):
+		fmt.Fprintf(w, `[[], [], [], [%s]]`, testTransaction(testOpHashA))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestMempool(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(mempoolNode))
+	defer srv.Close()
+
+	d := newTestDatasource(t)
+	d.Client = &client.Client{URL: srv.URL}
+	m := NewMempool(d, nil, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	snapshots, errCh := m.Subscribe(ctx)
+
+	// the operation was seen by the monitor before the snapshot
+	t0 := time.Now().Add(-time.Minute)
+	m.see([]model.Base58{testOpHashA}, t0)
+	require.NoError(t, m.refresh(ctx))
+
+	s := <-snapshots
+	// operations are counted, not their contents
+	assert.Equal(t, 3, s.Total)
+	assert.Equal(t, 2, s.Applied)
+	assert.Equal(t, 1, s.BranchDelayed)
+	assert.Equal(t, uint64(4), s.Ops.Transaction)
+	assert.Equal(t, 0, s.Included)
+
+	pending := m.Pending()
+	require.Len(t, pending, 4)
+	assert.Equal(t, testOpHashA, pending[0].Hash)
+	assert.Equal(t, t0, pending[0].FirstSeen)
+	assert.Equal(t, model.MempoolApplied, pending[0].Class)
+
+	// the operation is included 20 seconds after it was seen
+	block := newBlockInfo(&model.BlockInfo{
+		Header: &model.BlockHeader{
+			Hash:           testBlockX,
+			RawBlockHeader: model.RawBlockHeader{Level: 10, Timestamp: t0.Add(20 * time.Second)},
+		},
+	})
+	require.NoError(t, m.include(ctx, &ChainUpdate{Blocks: []*BlockInfo{block}}))
+	require.NoError(t, m.refresh(ctx))
+
+	s = <-snapshots
+	assert.Equal(t, int64(10), s.Level)
+	assert.Equal(t, 1, s.Included)
+	assert.Equal(t, float64(20), s.LatencyAvg)
+	assert.Equal(t, float64(20), s.LatencyMax)
+
+	history := m.History(t0, time.Now().Add(time.Second))
+	assert.Len(t, history, 2)
+
+	cancel()
+	for range snapshots {
+	}
+	assert.ErrorIs(t, <-errCh, context.Canceled)
+}
+
+func mempoolStopped(m *Mempool) bool {
+	m.startMtx.Lock()
+	defer m.startMtx.Unlock()
+	select {
+	case <-m.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestMempoolIdle(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(mempoolNode))
+	defer srv.Close()
+
+	d := newTestDatasource(t)
+	d.Client = &client.Client{URL: srv.URL}
+	m := NewMempool(d, NewHub(d), time.Millisecond)
+	m.idle = 20 * time.Millisecond
+	defer m.Stop()
+
+	ctx := context.Background()
+	require.NoError(t, m.Start(ctx))
+	require.Eventually(t, func() bool { return mempoolStopped(m) }, 5*time.Second, time.Millisecond)
+	history := len(m.History(time.Time{}, time.Now().Add(time.Second)))
+
+	// restarted by the next query and kept running while subscribed
+	require.NoError(t, m.Start(ctx))
+	assert.False(t, mempoolStopped(m))
+	subCtx, cancel := context.WithCancel(ctx)
+	snapshots, _ := m.Subscribe(subCtx)
+	time.Sleep(3 * m.idle)
+	assert.False(t, mempoolStopped(m))
+	<-snapshots
+	assert.Greater(t, len(m.History(time.Time{}, time.Now().Add(time.Second))), history)
+
+	cancel()
+	require.Eventually(t, func() bool { return mempoolStopped(m) }, 5*time.Second, time.Millisecond)
+}
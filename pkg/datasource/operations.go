@@ -0,0 +1,73 @@
+package datasource
+
+import (
+	"context"
+	"time"
+
+	"github.com/ecadlabs/tezos-grafana-datasource/pkg/model"
+)
+
+// OperationInfo is a single operation contents entry along with its block
+type OperationInfo struct {
+	Block     *BlockInfo           `json:"block"`
+	Operation *model.OperationInfo `json:"operation"`
+}
+
+func (d *Datasource) getOperationsInfo(ctx context.Context, blockID model.Base58) ([]*model.OperationInfo, error) {
+	ops, ok, err := d.DB.GetOperationsInfo(ctx, blockID)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return ops, nil
+	}
+	blockOps, err := d.Client.GetBlockOperations(ctx, blockID.String())
+	if err != nil {
+		return nil, err
+	}
+	ops = blockOps.OperationsInfo()
+	if ops == nil {
+		ops = []*model.OperationInfo{}
+	}
+	if err = d.DB.UpdateOperationsInfo(ctx, blockID, ops); err != nil {
+		return nil, err
+	}
+	return ops, nil
+}
+
+// GetOperationsInfo returns operations included within the time range. If kinds isn't empty only the listed kinds are returned
+func (d *Datasource) GetOperationsInfo(ctx context.Context, start, end time.Time, kinds []string) ([]*OperationInfo, error) {
+	blocks, err := d.GetBlocksInfo(ctx, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	// fetch operations in parallel preserving the block order
+	blockOps := make([][]*model.OperationInfo, len(blocks))
+	err = d.forEach(ctx, len(blocks), func(ctx context.Context, i int) error {
+		var err error
+		blockOps[i], err = d.getOperationsInfo(ctx, blocks[i].Header.Hash)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	filter := make(map[string]bool, len(kinds))
+	for _, k := range kinds {
+		filter[k] = true
+	}
+	var res []*OperationInfo
+	for i, ops := range blockOps {
+		for _, op := range ops {
+			if len(filter) != 0 && !filter[op.Kind] {
+				continue
+			}
+			res = append(res, &OperationInfo{
+				Block:     blocks[i],
+				Operation: op,
+			})
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,169 @@
+package datasource
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/ecadlabs/tezos-grafana-datasource/pkg/client"
+	"github.com/ecadlabs/tezos-grafana-datasource/pkg/model"
+)
+
+const (
+	RightBaking    = "baking"
+	RightEndorsing = "endorsing"
+)
+
+// UpcomingCycles is the number of cycles starting from the current one returned by GetUpcomingRights
+const UpcomingCycles = 2
+
+// Right is a single baking or endorsing right
+type Right struct {
+	Kind     string       `json:"kind"`
+	Delegate model.Base58 `json:"delegate" tz:"address"`
+	Level    int64        `json:"level"`
+	Cycle    int64        `json:"cycle"`
+	// Priority is set for baking rights only. It's the round for Tenderbake based protocols
+	Priority int64 `json:"priority"`
+	// Slots is set for endorsing rights only. It's the endorsing power for Tenderbake based protocols
+	Slots         int64     `json:"slots"`
+	EstimatedTime time.Time `json:"estimated_time"`
+	// TimeUntil is the number of seconds left until EstimatedTime at the moment of the query
+	TimeUntil int64 `json:"time_until" tz:"s" title:"Time until"`
+}
+
+type RightInfo struct {
+	Right *Right `json:"right"`
+}
+
+// getDelegateRights returns the delegate's rights within the cycle requested at the given block. Rights are final once
+// the RPC is able to return them so levels, priorities and slots are cached. Estimated times depend on the head at
+// the moment of the request and are left out
+func (d *Datasource) getDelegateRights(ctx context.Context, blockID string, cycle int64, delegate model.Base58) (*model.DelegateRights, error) {
+	rights, ok, err := d.DB.GetDelegateRights(ctx, cycle, delegate)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return rights, nil
+	}
+	params := client.RightsParams{
+		Cycle:    []int64{cycle},
+		Delegate: []model.Base58{delegate},
+	}
+	rights = new(model.DelegateRights)
+	if rights.Baking, err = d.Client.GetBakingRights(ctx, blockID, &params); err != nil {
+		return nil, err
+	}
+	if rights.Endorsing, err = d.Client.GetEndorsingRights(ctx, blockID, &params); err != nil {
+		return nil, err
+	}
+	for _, r := range rights.Baking {
+		r.Round = nil
+		r.EstimatedTime = time.Time{}
+	}
+	for _, r := range rights.Endorsing {
+		r.EstimatedTime = time.Time{}
+	}
+	if err = d.DB.UpdateDelegateRights(ctx, cycle, delegate, rights); err != nil {
+		return nil, err
+	}
+	return rights, nil
+}
+
+// estimateTime returns the earliest time the block at the level can be produced at the round (or priority) assuming
+// all blocks between the head and the level are produced at round 0
+func estimateTime(c *model.ProtocolConstants, head *model.BlockHeader, level, round int64) time.Time {
+	if head.IsTenderbake() {
+		predTs, predRound := head.Timestamp, head.Round()
+		if level > head.Level+1 {
+			predTs = c.RoundStart(predTs, predRound, 0).Add(time.Duration(level-head.Level-2) * c.RoundDuration(0))
+			predRound = 0
+		}
+		return c.RoundStart(predTs, predRound, round)
+	}
+	// Emmy*: the minimal delay applies to fully endorsed blocks at priority 0
+	var base, perPriority time.Duration
+	if len(c.TimeBetweenBlocks) != 0 {
+		base = time.Duration(c.TimeBetweenBlocks[0]) * time.Second
+	}
+	if len(c.TimeBetweenBlocks) > 1 {
+		perPriority = time.Duration(c.TimeBetweenBlocks[1]) * time.Second
+	}
+	minimal := base
+	if c.MinimalBlockDelay != 0 {
+		minimal = time.Duration(c.MinimalBlockDelay) * time.Second
+	}
+	t := head.Timestamp.Add(time.Duration(level-head.Level-1) * minimal)
+	if round == 0 {
+		return t.Add(minimal)
+	}
+	return t.Add(base + time.Duration(round)*perPriority)
+}
+
+// GetUpcomingRights returns rights of the delegates at levels above the current head within UpcomingCycles cycles ordered by level
+func (d *Datasource) GetUpcomingRights(ctx context.Context, delegates []model.Base58) ([]*RightInfo, error) {
+	if len(delegates) == 0 {
+		return nil, errors.New("at least one delegate is required")
+	}
+	header, err := d.Client.GetBlockHeader(ctx, "head")
+	if err != nil {
+		return nil, err
+	}
+	head, err := d.Client.GetCurrentLevel(ctx, header.Hash.String())
+	if err != nil {
+		return nil, err
+	}
+	constants, err := d.getProtocolConstants(ctx, header)
+	if err != nil {
+		return nil, err
+	}
+
+	rights := make([]*model.DelegateRights, UpcomingCycles*len(delegates))
+	err = d.forEach(ctx, len(rights), func(ctx context.Context, i int) error {
+		var err error
+		rights[i], err = d.getDelegateRights(ctx, header.Hash.String(), head.Cycle+int64(i/len(delegates)), delegates[i%len(delegates)])
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var res []*RightInfo
+	add := func(r *Right) {
+		if r.Level <= head.Level {
+			return
+		}
+		// endorsements are expected along with the round 0 block
+		r.EstimatedTime = estimateTime(constants, header, r.Level, r.Priority)
+		r.TimeUntil = int64(r.EstimatedTime.Sub(now) / time.Second)
+		res = append(res, &RightInfo{Right: r})
+	}
+	for i, dr := range rights {
+		cycle := head.Cycle + int64(i/len(delegates))
+		for _, r := range dr.Baking {
+			add(&Right{
+				Kind:     RightBaking,
+				Delegate: r.Delegate,
+				Level:    r.Level,
+				Cycle:    cycle,
+				Priority: r.Priority,
+			})
+		}
+		for _, r := range dr.Endorsing {
+			add(&Right{
+				Kind:     RightEndorsing,
+				Delegate: r.Delegate,
+				Level:    r.Level,
+				Cycle:    cycle,
+				Slots:    r.EndorsingPower(),
+			})
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Right.Level < res[j].Right.Level
+	})
+	return res, nil
+}
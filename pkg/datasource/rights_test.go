@@ -0,0 +1,67 @@
+package datasource
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ecadlabs/tezos-grafana-datasource/pkg/client"
+	"github.com/ecadlabs/tezos-grafana-datasource/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetUpcomingRights(t *testing.T) {
+	// the head is at level 19 of cycle 2
+	node := &rightsNode{mockNode: newMockNode(20)}
+	node.constants = &model.ProtocolConstants{
+		TimeBetweenBlocks: []model.Int64{60, 40},
+		MinimalBlockDelay: 30,
+	}
+	srv := httptest.NewServer(node)
+	defer srv.Close()
+
+	d := newTestDatasource(t)
+	d.Client = &client.Client{URL: srv.URL}
+
+	ctx := context.Background()
+	_, err := d.GetUpcomingRights(ctx, nil)
+	assert.Error(t, err)
+
+	rights, err := d.GetUpcomingRights(ctx, []model.Base58{testDelegateA})
+	require.NoError(t, err)
+	// levels 20 to 31, baking at both priorities and endorsing at each level
+	require.Len(t, rights, 12*2)
+	for i, r := range rights {
+		assert.Equal(t, int64(20+i/2), r.Right.Level)
+		assert.Equal(t, testDelegateA, r.Right.Delegate)
+		assert.Equal(t, r.Right.Level/testBlocksPerCycle, r.Right.Cycle)
+		// estimated from the head timestamp and the block delays
+		delay := time.Duration(r.Right.Level-19) * 30 * time.Second
+		if i%2 == 0 {
+			assert.Equal(t, RightBaking, r.Right.Kind)
+			assert.Equal(t, r.Right.Level%2, r.Right.Priority)
+			if r.Right.Priority != 0 {
+				delay += 70 * time.Second
+			}
+		} else {
+			assert.Equal(t, RightEndorsing, r.Right.Kind)
+			assert.Equal(t, int64(2), r.Right.Slots)
+		}
+		assert.Equal(t, testT0.Add(19*testBlockInterval+delay), r.Right.EstimatedTime)
+	}
+	// two cycles, two RPCs each
+	assert.Equal(t, 4, node.rightsCalls)
+
+	// cached
+	_, err = d.GetUpcomingRights(ctx, []model.Base58{testDelegateA})
+	require.NoError(t, err)
+	assert.Equal(t, 4, node.rightsCalls)
+
+	// only the final part of the rights is cached
+	cached, ok, err := d.DB.GetDelegateRights(ctx, 2, testDelegateA)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.True(t, cached.Baking[0].EstimatedTime.IsZero())
+}
@@ -0,0 +1,217 @@
+package model
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+)
+
+// Balance update categories reported by BalanceUpdateInfo. Other categories are passed through with spaces replaced by underscores
+const (
+	BalanceRewards     = "rewards"
+	BalanceFees        = "fees"
+	BalanceDeposits    = "deposits"
+	BalanceLostRewards = "lost_rewards"
+	// BalanceUnfrozen is the Emmy* cycle end release of frozen rewards, fees and deposits to the delegate's contract
+	BalanceUnfrozen = "unfrozen"
+)
+
+// BalanceUpdateInfo is the sum of the delegate's balance updates of the same category and cycle within a block
+type BalanceUpdateInfo struct {
+	Delegate Base58 `json:"delegate" tz:"address"`
+	Category string `json:"category"`
+	Cycle    int64  `json:"cycle"`
+	Change   int64  `json:"change" tz:"mutez"`
+	// Count is the number of aggregated updates
+	Count int64 `json:"count"`
+}
+
+// balanceCategory maps both Emmy* freezer categories and Tenderbake ones to a common set
+func balanceCategory(category string) string {
+	switch category {
+	case "rewards", "baking rewards", "baking bonuses", "endorsing rewards":
+		return BalanceRewards
+	case "fees", "block fees":
+		return BalanceFees
+	case "deposits":
+		return BalanceDeposits
+	case "lost endorsing rewards":
+		return BalanceLostRewards
+	}
+	return strings.ReplaceAll(category, " ", "_")
+}
+
+// pairedUpdate returns the counterpart of the Tenderbake contract update, i.e. the adjacent non contract update
+// moving the same amount in the opposite direction
+func pairedUpdate(updates BalanceUpdates, i int, change Int64) *NonContractBalanceUpdate {
+	for _, j := range [...]int{i - 1, i + 1} {
+		if j < 0 || j >= len(updates) {
+			continue
+		}
+		if u, ok := updates[j].(*NonContractBalanceUpdate); ok && u.Change == -change {
+			return u
+		}
+	}
+	return nil
+}
+
+// isUnfreeze reports whether the Emmy* freezer update is released to the delegate's own contract at the cycle end,
+// i.e. the adjacent contract update credits the delegate with the debited amount
+func isUnfreeze(updates BalanceUpdates, i int, u *NonContractBalanceUpdate) bool {
+	if u.Change >= 0 || u.Kind != "freezer" {
+		return false
+	}
+	for _, j := range [...]int{i - 1, i + 1} {
+		if j < 0 || j >= len(updates) {
+			continue
+		}
+		if c, ok := updates[j].(*ContractBalanceUpdate); ok && c.Change == -u.Change && bytes.Equal(c.Contract, u.Delegate) {
+			return true
+		}
+	}
+	return false
+}
+
+type balanceKey struct {
+	delegate string
+	category string
+	cycle    int64
+}
+
+type balanceAccumulator map[balanceKey]*BalanceUpdateInfo
+
+func (a balanceAccumulator) add(delegate Base58, category string, cycle int64, change Int64) {
+	k := balanceKey{delegate: string(delegate), category: category, cycle: cycle}
+	info, ok := a[k]
+	if !ok {
+		info = &BalanceUpdateInfo{Delegate: delegate, Category: category, Cycle: cycle}
+		a[k] = info
+	}
+	info.Change += int64(change)
+	info.Count++
+}
+
+// collect attributes updates to delegates. Frozen balance updates (Emmy* rewards, fees and deposits and Tenderbake
+// deposits) belong to their delegate. Emmy* cycle end releases of the frozen balances are reported as unfrozen
+// with the released amount so they don't cancel out the earned rewards. Tenderbake rewards and fees are credited to
+// the baker's contract from minted or accumulated funds and take the category of that counterpart. Other moves
+// between the delegate's own balances and transfers between contracts are skipped. Updates without a cycle get blockCycle
+func (a balanceAccumulator) collect(updates BalanceUpdates, blockCycle int64) {
+	for i, u := range updates {
+		switch u := u.(type) {
+		case *NonContractBalanceUpdate:
+			if len(u.Delegate) == 0 {
+				continue
+			}
+			cycle := u.Cycle
+			if cycle == 0 {
+				cycle = blockCycle
+			}
+			if isUnfreeze(updates, i, u) {
+				a.add(u.Delegate, BalanceUnfrozen, cycle, -u.Change)
+				continue
+			}
+			a.add(u.Delegate, balanceCategory(u.Category), cycle, u.Change)
+		case *ContractBalanceUpdate:
+			if u.Change <= 0 {
+				continue
+			}
+			p := pairedUpdate(updates, i, u.Change)
+			if p == nil || len(p.Delegate) != 0 || p.Category == "" {
+				continue
+			}
+			a.add(u.Contract, balanceCategory(p.Category), blockCycle, u.Change)
+		}
+	}
+}
+
+func (a balanceAccumulator) list() []*BalanceUpdateInfo {
+	res := make([]*BalanceUpdateInfo, 0, len(a))
+	for _, info := range a {
+		res = append(res, info)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if d := strings.Compare(res[i].Delegate.String(), res[j].Delegate.String()); d != 0 {
+			return d < 0
+		}
+		if res[i].Category != res[j].Category {
+			return res[i].Category < res[j].Category
+		}
+		return res[i].Cycle < res[j].Cycle
+	})
+	return res
+}
+
+// operationBalanceUpdates returns lists of balance updates found in the operation metadata and its result
+func operationBalanceUpdates(contents Operation) []BalanceUpdates {
+	switch op := contents.(type) {
+	case ManagerOperation:
+		meta := op.ManagerMetadata()
+		if meta == nil {
+			return nil
+		}
+		res := []BalanceUpdates{meta.BalanceUpdates}
+		if meta.OperationResult != nil {
+			res = append(res, meta.OperationResult.BalanceUpdates)
+		}
+		return res
+	case *Endorsement:
+		if op.Metadata != nil {
+			return []BalanceUpdates{op.Metadata.BalanceUpdates}
+		}
+	case *EndorsementWithSlot:
+		if op.Metadata != nil {
+			return []BalanceUpdates{op.Metadata.BalanceUpdates}
+		}
+	case *TenderbakeEndorsement:
+		if op.Metadata != nil {
+			return []BalanceUpdates{op.Metadata.BalanceUpdates}
+		}
+	case *Preendorsement:
+		if op.Metadata != nil {
+			return []BalanceUpdates{op.Metadata.BalanceUpdates}
+		}
+	case *SeedNonceRevelation:
+		if op.Metadata != nil {
+			return []BalanceUpdates{op.Metadata.BalanceUpdates}
+		}
+	case *DoubleEndorsementEvidence:
+		if op.Metadata != nil {
+			return []BalanceUpdates{op.Metadata.BalanceUpdates}
+		}
+	case *DoublePreendorsementEvidence:
+		if op.Metadata != nil {
+			return []BalanceUpdates{op.Metadata.BalanceUpdates}
+		}
+	case *DoubleBakingEvidence:
+		if op.Metadata != nil {
+			return []BalanceUpdates{op.Metadata.BalanceUpdates}
+		}
+	case *ActivateAccount:
+		if op.Metadata != nil {
+			return []BalanceUpdates{op.Metadata.BalanceUpdates}
+		}
+	}
+	return nil
+}
+
+// BalanceUpdatesInfo returns the block's balance updates attributed to delegates from both the block metadata and
+// the operations metadata, summed by delegate, category and cycle
+func (b *Block) BalanceUpdatesInfo() []*BalanceUpdateInfo {
+	acc := make(balanceAccumulator)
+	var cycle int64
+	if b.Metadata != nil {
+		cycle = b.Metadata.Cycle()
+		acc.collect(b.Metadata.BalanceUpdates, cycle)
+	}
+	for _, list := range b.Operations {
+		for _, operation := range list {
+			for _, contents := range operation.Contents {
+				for _, updates := range operationBalanceUpdates(contents) {
+					acc.collect(updates, cycle)
+				}
+			}
+		}
+	}
+	return acc.list()
+}
@@ -0,0 +1,152 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBalanceUpdatesInfo(t *testing.T) {
+	var (
+		baker    = Base58{6, 161, 159, 1}
+		endorser = Base58{6, 161, 159, 2}
+		source   = Base58{6, 161, 159, 3}
+		hash     = Base58{1, 2, 3}
+	)
+
+	t.Run("Emmy", func(t *testing.T) {
+		src := fmt.Sprintf(`{
+	"protocol": "%[5]s",
+	"chain_id": "%[4]s",
+	"hash": "%[4]s",
+	"header": {},
+	"metadata": {
+		"level_info": {"level": 100, "cycle": 12},
+		"balance_updates": [
+			{"kind": "contract", "contract": "%[1]s", "change": "-640000000", "origin": "block"},
+			{"kind": "freezer", "category": "deposits", "delegate": "%[1]s", "cycle": 12, "change": "640000000", "origin": "block"},
+			{"kind": "freezer", "category": "rewards", "delegate": "%[1]s", "cycle": 12, "change": "16093750", "origin": "block"}
+		]
+	},
+	"operations": [[{
+		"protocol": "%[5]s",
+		"chain_id": "%[4]s",
+		"hash": "%[4]s",
+		"branch": "%[4]s",
+		"contents": [{
+			"kind": "endorsement_with_slot",
+			"endorsement": {"branch": "%[4]s", "operations": {"kind": "endorsement", "level": 99}},
+			"slot": 1,
+			"metadata": {
+				"balance_updates": [
+					{"kind": "freezer", "category": "rewards", "delegate": "%[2]s", "cycle": 12, "change": "1250000", "origin": "block"},
+					{"kind": "freezer", "category": "rewards", "delegate": "%[2]s", "cycle": 12, "change": "1250000", "origin": "block"}
+				],
+				"delegate": "%[2]s",
+				"slots": [1, 2]
+			}
+		}]
+	}], [], [], [{
+		"protocol": "%[5]s",
+		"chain_id": "%[4]s",
+		"hash": "%[4]s",
+		"branch": "%[4]s",
+		"contents": [{
+			"kind": "reveal",
+			"source": "%[3]s",
+			"fee": "374",
+			"counter": "1",
+			"gas_limit": "1100",
+			"storage_limit": "0",
+			"public_key": "edpk",
+			"metadata": {
+				"balance_updates": [
+					{"kind": "contract", "contract": "%[3]s", "change": "-374", "origin": "block"},
+					{"kind": "freezer", "category": "fees", "delegate": "%[1]s", "cycle": 12, "change": "374", "origin": "block"}
+				],
+				"operation_result": {"status": "applied", "consumed_gas": "1000"}
+			}
+		}]
+	}]]
+}`, baker, endorser, source, hash, ProtoGranada)
+		var b Block
+		require.NoError(t, json.Unmarshal([]byte(src), &b))
+		info := b.BalanceUpdatesInfo()
+		assert.Equal(t, []*BalanceUpdateInfo{
+			{Delegate: baker, Category: BalanceDeposits, Cycle: 12, Change: 640000000, Count: 1},
+			{Delegate: baker, Category: BalanceFees, Cycle: 12, Change: 374, Count: 1},
+			{Delegate: baker, Category: BalanceRewards, Cycle: 12, Change: 16093750, Count: 1},
+			{Delegate: endorser, Category: BalanceRewards, Cycle: 12, Change: 2500000, Count: 2},
+		}, info)
+	})
+
+	t.Run("Emmy cycle end", func(t *testing.T) {
+		src := fmt.Sprintf(`{
+	"protocol": "%[4]s",
+	"chain_id": "%[3]s",
+	"hash": "%[3]s",
+	"header": {},
+	"metadata": {
+		"level_info": {"level": 4096, "cycle": 13},
+		"balance_updates": [
+			{"kind": "contract", "contract": "%[1]s", "change": "-640000000", "origin": "block"},
+			{"kind": "freezer", "category": "deposits", "delegate": "%[1]s", "cycle": 13, "change": "640000000", "origin": "block"},
+			{"kind": "freezer", "category": "rewards", "delegate": "%[1]s", "cycle": 13, "change": "16093750", "origin": "block"},
+			{"kind": "freezer", "category": "deposits", "delegate": "%[2]s", "cycle": 7, "change": "-5120000000", "origin": "block"},
+			{"kind": "contract", "contract": "%[2]s", "change": "5120000000", "origin": "block"},
+			{"kind": "freezer", "category": "fees", "delegate": "%[2]s", "cycle": 7, "change": "-1000", "origin": "block"},
+			{"kind": "contract", "contract": "%[2]s", "change": "1000", "origin": "block"},
+			{"kind": "freezer", "category": "rewards", "delegate": "%[2]s", "cycle": 7, "change": "-80000000", "origin": "block"},
+			{"kind": "contract", "contract": "%[2]s", "change": "80000000", "origin": "block"}
+		]
+	},
+	"operations": [[], [], [], []]
+}`, baker, endorser, hash, ProtoGranada)
+		var b Block
+		require.NoError(t, json.Unmarshal([]byte(src), &b))
+		info := b.BalanceUpdatesInfo()
+		// releases of cycle 7 don't cancel out the rewards earned then
+		assert.Equal(t, []*BalanceUpdateInfo{
+			{Delegate: baker, Category: BalanceDeposits, Cycle: 13, Change: 640000000, Count: 1},
+			{Delegate: baker, Category: BalanceRewards, Cycle: 13, Change: 16093750, Count: 1},
+			{Delegate: endorser, Category: BalanceUnfrozen, Cycle: 7, Change: 5200001000, Count: 3},
+		}, info)
+	})
+
+	t.Run("Tenderbake", func(t *testing.T) {
+		src := fmt.Sprintf(`{
+	"protocol": "%[4]s",
+	"chain_id": "%[3]s",
+	"hash": "%[3]s",
+	"header": {},
+	"metadata": {
+		"level_info": {"level": 2244609, "cycle": 468},
+		"balance_updates": [
+			{"kind": "accumulator", "category": "block fees", "change": "-1500", "origin": "block"},
+			{"kind": "contract", "contract": "%[1]s", "change": "1500", "origin": "block"},
+			{"kind": "minted", "category": "baking rewards", "change": "-10000000", "origin": "block"},
+			{"kind": "contract", "contract": "%[1]s", "change": "10000000", "origin": "block"},
+			{"kind": "minted", "category": "baking bonuses", "change": "-9000000", "origin": "block"},
+			{"kind": "contract", "contract": "%[1]s", "change": "9000000", "origin": "block"},
+			{"kind": "contract", "contract": "%[2]s", "change": "-6000000000", "origin": "block"},
+			{"kind": "freezer", "category": "deposits", "delegate": "%[2]s", "change": "6000000000", "origin": "block"},
+			{"kind": "minted", "category": "endorsing rewards", "change": "-2000000", "origin": "block"},
+			{"kind": "burned", "category": "lost endorsing rewards", "delegate": "%[2]s", "participation": false, "revelation": true, "change": "2000000", "origin": "block"}
+		]
+	},
+	"operations": [[], [], [], []]
+}`, baker, endorser, hash, ProtoIthaca)
+		var b Block
+		require.NoError(t, json.Unmarshal([]byte(src), &b))
+		info := b.BalanceUpdatesInfo()
+		assert.Equal(t, []*BalanceUpdateInfo{
+			{Delegate: baker, Category: BalanceFees, Cycle: 468, Change: 1500, Count: 1},
+			{Delegate: baker, Category: BalanceRewards, Cycle: 468, Change: 19000000, Count: 2},
+			{Delegate: endorser, Category: BalanceDeposits, Cycle: 468, Change: 6000000000, Count: 1},
+			{Delegate: endorser, Category: BalanceLostRewards, Cycle: 468, Change: 2000000, Count: 1},
+		}, info)
+	})
+}
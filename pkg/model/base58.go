@@ -133,5 +133,8 @@ func DecodeBase58Check(text string) ([]byte, error) {
 func EncodeBase58Check(data []byte) string {
 	s0 := sha256.Sum256(data)
 	s1 := sha256.Sum256(s0[:])
-	return EncodeBase58(append(data, s1[:4]...))
+	// don't append to the caller's slice which may have spare capacity
+	buf := make([]byte, len(data), len(data)+4)
+	copy(buf, data)
+	return EncodeBase58(append(buf, s1[:4]...))
 }
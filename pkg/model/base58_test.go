@@ -57,6 +57,11 @@ func TestEncodeBase58Check(t *testing.T) {
 		v, _ := hex.DecodeString(tt.vec)
 		assert.Equal(t, tt.s, EncodeBase58Check(v))
 	}
+
+	// spare capacity of the input is left untouched
+	buf := make([]byte, 1, 8)
+	EncodeBase58Check(buf)
+	assert.Equal(t, make([]byte, 8), buf[:8])
 }
 
 func TestDecodeBase58Check(t *testing.T) {
@@ -0,0 +1,137 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Mempool operation classes
+const (
+	MempoolApplied       = "applied"
+	MempoolRefused       = "refused"
+	MempoolOutdated      = "outdated"
+	MempoolBranchRefused = "branch_refused"
+	MempoolBranchDelayed = "branch_delayed"
+	MempoolUnprocessed   = "unprocessed"
+)
+
+// MempoolOperation is an operation not included into a block yet
+type MempoolOperation struct {
+	Protocol  Base58                 `json:"protocol,omitempty"`
+	Hash      Base58                 `json:"hash"`
+	Branch    Base58                 `json:"branch"`
+	Contents  BlockOperationContents `json:"contents"`
+	Signature Base58                 `json:"signature,omitempty"`
+	// Error is set for operations rejected by the node
+	Error    json.RawMessage `json:"error,omitempty"`
+	Overflow Overflow        `json:"-"`
+}
+
+// UnmarshalJSON decodes contents according to the operation's protocol if it's present, see BlockOperation
+func (op *MempoolOperation) UnmarshalJSON(text []byte) error {
+	var tmp struct {
+		Protocol  Base58          `json:"protocol"`
+		Hash      Base58          `json:"hash"`
+		Branch    Base58          `json:"branch"`
+		Contents  json.RawMessage `json:"contents"`
+		Signature Base58          `json:"signature,omitempty"`
+		Error     json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(text, &tmp); err != nil {
+		return err
+	}
+	contents, err := decodeOperationContents(tmp.Contents, ProtocolOperationKinds(tmp.Protocol))
+	if err != nil {
+		return err
+	}
+	*op = MempoolOperation{
+		Protocol:  tmp.Protocol,
+		Hash:      tmp.Hash,
+		Branch:    tmp.Branch,
+		Contents:  contents,
+		Signature: tmp.Signature,
+		Error:     tmp.Error,
+	}
+	return nil
+}
+
+// MempoolOperationList is encoded as a list of [hash, operation] pairs
+type MempoolOperationList []*MempoolOperation
+
+func (l *MempoolOperationList) UnmarshalJSON(text []byte) error {
+	var tmp [][]json.RawMessage
+	if err := json.Unmarshal(text, &tmp); err != nil {
+		return err
+	}
+	res := make(MempoolOperationList, len(tmp))
+	for i, pair := range tmp {
+		if len(pair) != 2 {
+			return fmt.Errorf("mempool operation: pair expected, got %d element(s)", len(pair))
+		}
+		var (
+			hash Base58
+			op   MempoolOperation
+		)
+		if err := json.Unmarshal(pair[0], &hash); err != nil {
+			return err
+		}
+		if err := json.Unmarshal(pair[1], &op); err != nil {
+			return err
+		}
+		op.Hash = hash
+		res[i] = &op
+	}
+	*l = res
+	return nil
+}
+
+// PendingOperations is the node's mempool content
+type PendingOperations struct {
+	Applied       []*MempoolOperation  `json:"applied"`
+	Refused       MempoolOperationList `json:"refused"`
+	Outdated      MempoolOperationList `json:"outdated"`
+	BranchRefused MempoolOperationList `json:"branch_refused"`
+	BranchDelayed MempoolOperationList `json:"branch_delayed"`
+	Unprocessed   MempoolOperationList `json:"unprocessed"`
+	Overflow      Overflow             `json:"-"`
+}
+
+// MempoolOperationInfo is a flat summary of a single contents entry of a mempool operation
+type MempoolOperationInfo struct {
+	OperationInfo
+	Class string `json:"class"`
+	// FirstSeen is the time the operation was seen for the first time by the plugin
+	FirstSeen time.Time `json:"first_seen"`
+}
+
+// OperationsInfo returns the summary of each operation contents entry ordered by class
+func (p *PendingOperations) OperationsInfo() []*MempoolOperationInfo {
+	classes := []struct {
+		class string
+		ops   []*MempoolOperation
+	}{
+		{MempoolApplied, p.Applied},
+		{MempoolRefused, p.Refused},
+		{MempoolOutdated, p.Outdated},
+		{MempoolBranchRefused, p.BranchRefused},
+		{MempoolBranchDelayed, p.BranchDelayed},
+		{MempoolUnprocessed, p.Unprocessed},
+	}
+	var res []*MempoolOperationInfo
+	for _, c := range classes {
+		for i, operation := range c.ops {
+			for ci, contents := range operation.Contents {
+				info := MempoolOperationInfo{
+					OperationInfo: *newOperationInfo(contents),
+					Class:         c.class,
+				}
+				info.Hash = operation.Hash
+				info.Index = i
+				info.ContentIndex = ci
+				res = append(res, &info)
+			}
+		}
+	}
+	return res
+}
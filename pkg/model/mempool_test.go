@@ -0,0 +1,77 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPendingOperations(t *testing.T) {
+	var (
+		opHash1 = Base58{1, 2, 3}
+		opHash2 = Base58{1, 2, 4}
+		branch  = Base58{4, 5, 6}
+		source  = Base58{6, 161, 159, 2}
+		dest    = Base58{2, 90, 121, 3}
+	)
+	src := fmt.Sprintf(`{
+	"applied": [{
+		"hash": "%[1]s",
+		"branch": "%[3]s",
+		"contents": [{
+			"kind": "transaction",
+			"source": "%[4]s",
+			"fee": "1420",
+			"counter": "2",
+			"gas_limit": "10600",
+			"storage_limit": "300",
+			"amount": "1000000",
+			"destination": "%[5]s"
+		}],
+		"signature": "%[3]s"
+	}],
+	"refused": [["%[2]s", {
+		"protocol": "%[6]s",
+		"branch": "%[3]s",
+		"contents": [{
+			"kind": "delegation",
+			"source": "%[4]s",
+			"fee": "374",
+			"counter": "3",
+			"gas_limit": "1100",
+			"storage_limit": "0"
+		}],
+		"signature": "%[3]s",
+		"error": [{"kind": "temporary", "id": "proto.counter_in_the_past"}]
+	}]],
+	"outdated": [],
+	"branch_refused": [],
+	"branch_delayed": [],
+	"unprocessed": []
+}`, opHash1, opHash2, branch, source, dest, ProtoIthaca)
+
+	var p PendingOperations
+	require.NoError(t, json.Unmarshal([]byte(src), &p))
+	unknown, err := UnknownFields([]byte(src), &p)
+	require.NoError(t, err)
+	assert.Empty(t, unknown)
+
+	require.Len(t, p.Refused, 1)
+	assert.Equal(t, opHash2, p.Refused[0].Hash)
+	assert.NotEmpty(t, p.Refused[0].Error)
+
+	info := p.OperationsInfo()
+	require.Len(t, info, 2)
+	assert.Equal(t, "transaction", info[0].Kind)
+	assert.Equal(t, MempoolApplied, info[0].Class)
+	assert.Equal(t, opHash1, info[0].Hash)
+	assert.Equal(t, dest, info[0].Destination)
+	assert.Equal(t, int64(1000000), info[0].Amount)
+	assert.Equal(t, "delegation", info[1].Kind)
+	assert.Equal(t, MempoolRefused, info[1].Class)
+	assert.Equal(t, opHash2, info[1].Hash)
+	assert.Equal(t, int64(374), info[1].Fee)
+}
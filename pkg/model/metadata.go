@@ -0,0 +1,126 @@
+package model
+
+import (
+	"encoding/json"
+)
+
+// BlockMetadata is the block's metadata. Level and voting period data of the pre-Granada protocols is normalized
+// into LevelInfo and VotingPeriodInfo, and ConsumedGas is filled from ConsumedMilligas if missing
+type BlockMetadata struct {
+	Protocol               Base58          `json:"protocol"`
+	NextProtocol           Base58          `json:"next_protocol"`
+	TestChainStatus        json.RawMessage `json:"test_chain_status,omitempty"`
+	MaxOperationsTTL       int64           `json:"max_operations_ttl"`
+	MaxOperationDataLength int64           `json:"max_operation_data_length"`
+	MaxBlockHeaderLength   int64           `json:"max_block_header_length"`
+	MaxOperationListLength json.RawMessage `json:"max_operation_list_length,omitempty"`
+	Baker                  Base58          `json:"baker" tz:"address"`
+	// Proposer is the delegate who proposed the block's payload. It's set for Tenderbake based protocols only
+	Proposer         Base58            `json:"proposer,omitempty" tz:"address"`
+	LevelInfo        *LevelInfo        `json:"level_info,omitempty"`
+	VotingPeriodInfo *VotingPeriodInfo `json:"voting_period_info,omitempty"`
+	// Level and VotingPeriodKind are replaced by LevelInfo and VotingPeriodInfo in Granada
+	Level                     *LegacyLevelInfo `json:"level,omitempty"`
+	VotingPeriodKind          string           `json:"voting_period_kind,omitempty"`
+	NonceHash                 Base58           `json:"nonce_hash,omitempty"`
+	ConsumedGas               Int64            `json:"consumed_gas" tz:"gas"`
+	ConsumedMilligas          Int64            `json:"consumed_milligas,omitempty" tz:"milligas"`
+	Deactivated               []Base58         `json:"deactivated"`
+	BalanceUpdates            BalanceUpdates   `json:"balance_updates"`
+	LiquidityBakingEscapeEMA  int64            `json:"liquidity_baking_escape_ema"`
+	LiquidityBakingToggleEMA  int64            `json:"liquidity_baking_toggle_ema,omitempty"`
+	ImplicitOperationsResults json.RawMessage  `json:"implicit_operations_results,omitempty"`
+	Overflow                  Overflow         `json:"-"`
+}
+
+// LegacyLevelInfo is the level data of the pre-Granada block metadata
+type LegacyLevelInfo struct {
+	LevelInfo
+	VotingPeriod         int64 `json:"voting_period"`
+	VotingPeriodPosition int64 `json:"voting_period_position"`
+}
+
+type VotingPeriod struct {
+	Index         int64  `json:"index"`
+	Kind          string `json:"kind"`
+	StartPosition int64  `json:"start_position"`
+}
+
+type VotingPeriodInfo struct {
+	VotingPeriod VotingPeriod `json:"voting_period"`
+	Position     int64        `json:"position"`
+	Remaining    int64        `json:"remaining"`
+}
+
+func (m *BlockMetadata) UnmarshalJSON(text []byte) error {
+	type blockMetadata BlockMetadata
+	var tmp blockMetadata
+	if err := json.Unmarshal(text, &tmp); err != nil {
+		return err
+	}
+	*m = BlockMetadata(tmp)
+	if m.Level != nil {
+		if m.LevelInfo == nil {
+			li := m.Level.LevelInfo
+			m.LevelInfo = &li
+		}
+		if m.VotingPeriodInfo == nil {
+			m.VotingPeriodInfo = &VotingPeriodInfo{
+				VotingPeriod: VotingPeriod{
+					Index:         m.Level.VotingPeriod,
+					Kind:          m.VotingPeriodKind,
+					StartPosition: m.Level.LevelPosition - m.Level.VotingPeriodPosition,
+				},
+				Position: m.Level.VotingPeriodPosition,
+			}
+		}
+	}
+	if m.ConsumedGas == 0 && m.ConsumedMilligas != 0 {
+		m.ConsumedGas = (m.ConsumedMilligas + 999) / 1000
+	}
+	return nil
+}
+
+// Cycle returns the cycle the block belongs to
+func (m *BlockMetadata) Cycle() int64 {
+	if m.LevelInfo != nil {
+		return m.LevelInfo.Cycle
+	}
+	return 0
+}
+
+// Info returns the part of the metadata kept in the cached block info. Blocks without metadata, e.g. ones
+// below the savepoint of a pruned node, get an empty one
+func (m *BlockMetadata) Info() *BlockMetadataInfo {
+	if m == nil {
+		return &BlockMetadataInfo{}
+	}
+	return &BlockMetadataInfo{
+		Baker:            m.Baker,
+		Proposer:         m.Proposer,
+		LevelInfo:        m.LevelInfo,
+		VotingPeriodInfo: m.VotingPeriodInfo,
+		NonceHash:        m.NonceHash,
+		ConsumedGas:      m.ConsumedGas,
+		ConsumedMilligas: m.ConsumedMilligas,
+	}
+}
+
+// BlockMetadataInfo is the subset of the block metadata available to expressions
+type BlockMetadataInfo struct {
+	Baker            Base58            `json:"baker" tz:"address"`
+	Proposer         Base58            `json:"proposer,omitempty" tz:"address"`
+	LevelInfo        *LevelInfo        `json:"level_info,omitempty"`
+	VotingPeriodInfo *VotingPeriodInfo `json:"voting_period_info,omitempty"`
+	NonceHash        Base58            `json:"nonce_hash,omitempty"`
+	ConsumedGas      Int64             `json:"consumed_gas" tz:"gas"`
+	ConsumedMilligas Int64             `json:"consumed_milligas,omitempty" tz:"milligas"`
+}
+
+// Cycle returns the cycle the block belongs to
+func (m *BlockMetadataInfo) Cycle() int64 {
+	if m.LevelInfo != nil {
+		return m.LevelInfo.Cycle
+	}
+	return 0
+}
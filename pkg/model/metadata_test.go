@@ -0,0 +1,101 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockMetadata(t *testing.T) {
+	var (
+		baker = Base58{6, 161, 159, 1}
+		hash  = Base58{1, 2, 3}
+	)
+
+	t.Run("Florence", func(t *testing.T) {
+		src := fmt.Sprintf(`{
+	"protocol": "%[2]s",
+	"next_protocol": "%[2]s",
+	"test_chain_status": {"status": "not_running"},
+	"max_operations_ttl": 60,
+	"max_operation_data_length": 32768,
+	"max_block_header_length": 238,
+	"max_operation_list_length": [{"max_size": 4194304, "max_op": 2048}, {"max_size": 32768}],
+	"baker": "%[1]s",
+	"level": {
+		"level": 1466368,
+		"level_position": 1466367,
+		"cycle": 357,
+		"cycle_position": 4095,
+		"voting_period": 45,
+		"voting_period_position": 20479,
+		"expected_commitment": true
+	},
+	"voting_period_kind": "proposal",
+	"nonce_hash": null,
+	"consumed_gas": "0",
+	"deactivated": ["%[1]s"],
+	"balance_updates": [
+		{"kind": "freezer", "category": "rewards", "delegate": "%[1]s", "cycle": 357, "change": "16093750", "origin": "block"}
+	]
+}`, baker, hash)
+		var m BlockMetadata
+		require.NoError(t, json.Unmarshal([]byte(src), &m))
+		unknown, err := UnknownFields([]byte(src), &m)
+		require.NoError(t, err)
+		assert.Empty(t, unknown)
+
+		assert.Equal(t, baker, m.Baker)
+		assert.Equal(t, []Base58{baker}, m.Deactivated)
+		assert.Len(t, m.BalanceUpdates, 1)
+		assert.Equal(t, &LevelInfo{
+			Level:              1466368,
+			LevelPosition:      1466367,
+			Cycle:              357,
+			CyclePosition:      4095,
+			ExpectedCommitment: true,
+		}, m.LevelInfo)
+		assert.Equal(t, &VotingPeriodInfo{
+			VotingPeriod: VotingPeriod{Index: 45, Kind: "proposal", StartPosition: 1445888},
+			Position:     20479,
+		}, m.VotingPeriodInfo)
+		assert.Equal(t, int64(357), m.Cycle())
+	})
+
+	t.Run("Ithaca", func(t *testing.T) {
+		src := fmt.Sprintf(`{
+	"protocol": "%[2]s",
+	"next_protocol": "%[2]s",
+	"test_chain_status": {"status": "not_running"},
+	"max_operations_ttl": 120,
+	"max_operation_data_length": 32768,
+	"max_block_header_length": 289,
+	"max_operation_list_length": [{"max_size": 4194304, "max_op": 2048}],
+	"proposer": "%[1]s",
+	"baker": "%[1]s",
+	"level_info": {"level": 2244609, "level_position": 2244608, "cycle": 468, "cycle_position": 0, "expected_commitment": false},
+	"voting_period_info": {"voting_period": {"index": 68, "kind": "proposal", "start_position": 2236416}, "position": 8192, "remaining": 12287},
+	"nonce_hash": null,
+	"consumed_gas": "0",
+	"deactivated": [],
+	"balance_updates": [],
+	"liquidity_baking_escape_ema": 119138,
+	"implicit_operations_results": [{"kind": "transaction", "consumed_gas": "225", "consumed_milligas": "224023"}],
+	"consumed_milligas": "1234500"
+}`, baker, hash)
+		var m BlockMetadata
+		require.NoError(t, json.Unmarshal([]byte(src), &m))
+		unknown, err := UnknownFields([]byte(src), &m)
+		require.NoError(t, err)
+		assert.Empty(t, unknown)
+
+		assert.Equal(t, baker, m.Proposer)
+		assert.Equal(t, int64(468), m.Cycle())
+		assert.Equal(t, int64(8192), m.VotingPeriodInfo.Position)
+		assert.Equal(t, Int64(1235), m.ConsumedGas)
+		assert.Equal(t, int64(119138), m.LiquidityBakingEscapeEMA)
+	})
+}
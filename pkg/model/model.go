@@ -1,8 +1,9 @@
 package model
 
 import (
-	"bytes"
+	"encoding/binary"
 	"encoding/json"
+	"fmt"
 	"time"
 )
 
@@ -11,8 +12,9 @@ type Block struct {
 	ChainID    Base58          `json:"chain_id"`
 	Hash       Base58          `json:"hash"`
 	Header     RawBlockHeader  `json:"header"`
-	Metadata   json.RawMessage `json:"metadata,omitempty"`
+	Metadata   *BlockMetadata  `json:"metadata,omitempty"`
 	Operations BlockOperations `json:"operations"`
+	Overflow   Overflow        `json:"-"`
 }
 
 func (b *Block) GetHeader() *BlockHeader {
@@ -32,44 +34,16 @@ func (b *Block) Stat() *BlockStatistics {
 	)
 	for _, tmp := range b.Operations {
 		for _, operation := range tmp {
+			kinds := ProtocolOperationKinds(operation.Protocol)
 			for _, contents := range operation.Contents {
 				opCnt++
-				switch op := contents.(type) {
-				case *EndorsementWithSlot:
-					ops.Endorsement++
-					if op.Metadata != nil {
-						slots += len(op.Metadata.Slots)
-					}
-				case *Endorsement:
-					ops.Endorsement++
-					if op.Metadata != nil {
-						slots += len(op.Metadata.Slots)
-					}
-				case OpaqueOperation:
-					switch op.OperationKind() {
-					case "seed_nonce_revelation":
-						ops.SeedNonceRevelation++
-					case "double_endorsement_evidence":
-						ops.DoubleEndorsementEvidence++
-					case "double_baking_evidence":
-						ops.DoubleBakingEvidence++
-					case "activate_account":
-						ops.ActivateAccount++
-					case "proposals":
-						ops.Proposals++
-					case "ballot":
-						ops.Ballot++
-					case "reveal":
-						ops.Reveal++
-					case "transaction":
-						ops.Transaction++
-					case "origination":
-						ops.Origination++
-					case "delegation":
-						ops.Delegation++
-					case "failing_noop":
-						ops.FailingNoop++
-					}
+				if k, ok := kinds[contents.OperationKind()]; ok {
+					*k.Counter(&ops)++
+				} else {
+					ops.Other++
+				}
+				if e, ok := contents.(EndorsementOperation); ok {
+					slots += e.EndorsementSlots()
 				}
 			}
 		}
@@ -92,29 +66,64 @@ type ShellBlockHeader struct {
 	Fitness        []Bytes   `json:"fitness"`
 	Context        Base58    `json:"context"`
 	ProtocolData   Bytes     `json:"protocol_data"`
+	Overflow       Overflow  `json:"-"`
 }
 
 type BlockHeader struct {
 	Protocol Base58 `json:"protocol"`
 	ChainID  Base58 `json:"chain_id"`
-	Hash     Base58 `json:"hash"`
+	Hash     Base58 `json:"hash" tz:"block"`
 	RawBlockHeader
 }
 
 type RawBlockHeader struct {
 	Level                     int64     `json:"level"`
 	Proto                     uint64    `json:"proto"`
-	Predecessor               Base58    `json:"predecessor"`
+	Predecessor               Base58    `json:"predecessor" tz:"block"`
 	Timestamp                 time.Time `json:"timestamp"`
 	ValidationPass            uint64    `json:"validation_pass"`
 	OperationsHash            Base58    `json:"operations_hash"`
 	Fitness                   []Bytes   `json:"fitness"`
 	Context                   Base58    `json:"context"`
 	Priority                  uint64    `json:"priority"`
+	PayloadHash               Base58    `json:"payload_hash,omitempty"`
+	PayloadRound              int64     `json:"payload_round"`
 	ProofOfWorkNonce          Bytes     `json:"proof_of_work_nonce"`
 	SeedNonceHash             Base58    `json:"seed_nonce_hash,omitempty"`
 	LiquidityBakingEscapeVote bool      `json:"liquidity_baking_escape_vote"`
+	LiquidityBakingToggleVote string    `json:"liquidity_baking_toggle_vote,omitempty"`
 	Signature                 Base58    `json:"signature"`
+	Overflow                  Overflow  `json:"-"`
+}
+
+// IsTenderbake reports whether the header was produced by a Tenderbake based protocol
+func (h *RawBlockHeader) IsTenderbake() bool {
+	return len(h.PayloadHash) != 0
+}
+
+// Tenderbake fitness is [version, level, locked_round, -predecessor_round-1, round]
+func (h *RawBlockHeader) fitnessInt(i int) (int64, bool) {
+	if len(h.Fitness) != 5 || len(h.Fitness[i]) != 4 {
+		return 0, false
+	}
+	return int64(int32(binary.BigEndian.Uint32(h.Fitness[i]))), true
+}
+
+// Round returns the block's round. For Emmy* based protocols the priority is returned
+func (h *RawBlockHeader) Round() int64 {
+	if !h.IsTenderbake() {
+		return int64(h.Priority)
+	}
+	v, _ := h.fitnessInt(4)
+	return v
+}
+
+// PredecessorRound returns the predecessor's round encoded into the Tenderbake fitness
+func (h *RawBlockHeader) PredecessorRound() int64 {
+	if v, ok := h.fitnessInt(3); ok {
+		return -v - 1
+	}
+	return 0
 }
 
 type ProtocolConstants struct {
@@ -152,6 +161,45 @@ type ProtocolConstants struct {
 	LiquidityBakingSubsidy            *BigInt   `json:"liquidity_baking_subsidy"`
 	LiquidityBakingSunsetLevel        int64     `json:"liquidity_baking_sunset_level"`
 	LiquidityBakingEscapeEMAThreshold int64     `json:"liquidity_baking_escape_ema_threshold"`
+	DelayIncrementPerRound            int64     `json:"delay_increment_per_round,string"`
+	ConsensusCommitteeSize            int64     `json:"consensus_committee_size"`
+	ConsensusThreshold                int64     `json:"consensus_threshold"`
+	// Hangzhou and later
+	MaxMichelineNodeCount          int64   `json:"max_micheline_node_count"`
+	MaxMichelineBytesLimit         int64   `json:"max_micheline_bytes_limit"`
+	MaxAllowedGlobalConstantsDepth int64   `json:"max_allowed_global_constants_depth"`
+	CacheLayout                    []Int64 `json:"cache_layout"`
+	// Ithaca and later
+	BlocksPerStakeSnapshot                           int64   `json:"blocks_per_stake_snapshot"`
+	BakingRewardFixedPortion                         *BigInt `json:"baking_reward_fixed_portion"`
+	BakingRewardBonusPerSlot                         *BigInt `json:"baking_reward_bonus_per_slot"`
+	EndorsingRewardPerSlot                           *BigInt `json:"endorsing_reward_per_slot"`
+	MaxOperationsTimeToLive                          int64   `json:"max_operations_time_to_live"`
+	MinimalParticipationRatio                        *Ratio  `json:"minimal_participation_ratio"`
+	MaxSlashingPeriod                                int64   `json:"max_slashing_period"`
+	FrozenDepositsPercentage                         int64   `json:"frozen_deposits_percentage"`
+	DoubleBakingPunishment                           *BigInt `json:"double_baking_punishment"`
+	RatioOfFrozenDepositsSlashedPerDoubleEndorsement *Ratio  `json:"ratio_of_frozen_deposits_slashed_per_double_endorsement"`
+}
+
+type Ratio struct {
+	Numerator   int64 `json:"numerator"`
+	Denominator int64 `json:"denominator"`
+}
+
+// RoundDuration returns the duration of the Tenderbake round
+func (c *ProtocolConstants) RoundDuration(round int64) time.Duration {
+	return time.Duration(c.MinimalBlockDelay+round*c.DelayIncrementPerRound) * time.Second
+}
+
+// RoundStart returns the earliest time a Tenderbake block can be produced at the round. Round 0 starts
+// when the round the predecessor was produced at ends
+func (c *ProtocolConstants) RoundStart(predTimestamp time.Time, predRound, round int64) time.Time {
+	t := predTimestamp.Add(c.RoundDuration(predRound))
+	for r := int64(0); r < round; r++ {
+		t = t.Add(c.RoundDuration(r))
+	}
+	return t
 }
 
 type BlockOperations [][]*BlockOperation
@@ -163,43 +211,67 @@ type BlockOperation struct {
 	Branch    Base58                 `json:"branch"`
 	Contents  BlockOperationContents `json:"contents"`
 	Signature Base58                 `json:"signature,omitempty"`
+	Overflow  Overflow               `json:"-"`
+}
+
+// BlockOperation contents are decoded according to the operation kinds known to its protocol. Like other custom
+// unmarshalers in the package it accepts unknown fields, the decoded value is checked with UnknownFields instead
+func (op *BlockOperation) UnmarshalJSON(text []byte) error {
+	var tmp struct {
+		Protocol  Base58          `json:"protocol"`
+		ChainID   Base58          `json:"chain_id"`
+		Hash      Base58          `json:"hash"`
+		Branch    Base58          `json:"branch"`
+		Contents  json.RawMessage `json:"contents"`
+		Signature Base58          `json:"signature,omitempty"`
+	}
+	if err := json.Unmarshal(text, &tmp); err != nil {
+		return err
+	}
+	contents, err := decodeOperationContents(tmp.Contents, ProtocolOperationKinds(tmp.Protocol))
+	if err != nil {
+		return err
+	}
+	*op = BlockOperation{
+		Protocol:  tmp.Protocol,
+		ChainID:   tmp.ChainID,
+		Hash:      tmp.Hash,
+		Branch:    tmp.Branch,
+		Contents:  contents,
+		Signature: tmp.Signature,
+	}
+	return nil
 }
 
 type BlockOperationContents []Operation
 
-func (ops *BlockOperationContents) UnmarshalJSON(text []byte) error {
+// UnmarshalJSON decodes contents using DefaultOperationKinds as the protocol is unknown at this point
+func (ops *BlockOperationContents) UnmarshalJSON(text []byte) (err error) {
+	*ops, err = decodeOperationContents(text, DefaultOperationKinds)
+	return
+}
+
+func decodeOperationContents(text []byte, kinds OperationKinds) (BlockOperationContents, error) {
 	var tmp []json.RawMessage
 	if err := json.Unmarshal(text, &tmp); err != nil {
-		return err
+		return nil, err
 	}
-	res := make([]Operation, len(tmp))
+	res := make(BlockOperationContents, len(tmp))
 	for i, rawOp := range tmp {
 		var kind struct {
 			Kind string `json:"kind"`
 		}
 		if err := json.Unmarshal(rawOp, &kind); err != nil {
-			return err
+			return nil, err
 		}
 
-		var target Operation
-		switch kind.Kind {
-		case "endorsement_with_slot":
-			target = new(EndorsementWithSlot)
-		case "endorsement":
-			target = new(Endorsement)
-		default:
-			target = new(OpaqueOperation)
-		}
-
-		dec := json.NewDecoder(bytes.NewReader(rawOp))
-		dec.DisallowUnknownFields()
-		if err := dec.Decode(target); err != nil {
-			return err
+		target := kinds.New(kind.Kind)
+		if err := json.Unmarshal(rawOp, target); err != nil {
+			return nil, fmt.Errorf("%s: %w", kind.Kind, err)
 		}
 		res[i] = target
 	}
-	*ops = res
-	return nil
+	return res, nil
 }
 
 type Operation interface {
@@ -228,6 +300,7 @@ type EndorsementMetadata struct {
 	BalanceUpdates BalanceUpdates `json:"balance_updates"`
 	Delegate       Base58         `json:"delegate"`
 	Slots          []uint64       `json:"slots"`
+	Overflow       Overflow       `json:"-"`
 }
 
 func (*EndorsementWithSlot) OperationKind() string {
@@ -258,10 +331,11 @@ type BalanceUpdate interface {
 }
 
 type ContractBalanceUpdate struct {
-	Kind     string `json:"kind"`
-	Contract Base58 `json:"contract"`
-	Change   Int64  `json:"change"`
-	Origin   string `json:"origin"`
+	Kind     string   `json:"kind"`
+	Contract Base58   `json:"contract"`
+	Change   Int64    `json:"change"`
+	Origin   string   `json:"origin"`
+	Overflow Overflow `json:"-"`
 }
 
 func (*ContractBalanceUpdate) BalanceUpdateKind() string {
@@ -269,12 +343,16 @@ func (*ContractBalanceUpdate) BalanceUpdateKind() string {
 }
 
 type NonContractBalanceUpdate struct {
-	Kind     string `json:"kind"`
-	Category string `json:"category"`
-	Delegate Base58 `json:"delegate"`
-	Cycle    int64  `json:"cycle"`
-	Change   Int64  `json:"change"`
-	Origin   string `json:"origin"`
+	Kind          string   `json:"kind"`
+	Category      string   `json:"category"`
+	Delegate      Base58   `json:"delegate"`
+	Committer     Base58   `json:"committer,omitempty"`
+	Cycle         int64    `json:"cycle"`
+	Participation bool     `json:"participation,omitempty"`
+	Revelation    bool     `json:"revelation,omitempty"`
+	Change        Int64    `json:"change"`
+	Origin        string   `json:"origin"`
+	Overflow      Overflow `json:"-"`
 }
 
 func (u *NonContractBalanceUpdate) BalanceUpdateKind() string {
@@ -305,9 +383,7 @@ func (u *BalanceUpdates) UnmarshalJSON(text []byte) error {
 			target = new(NonContractBalanceUpdate)
 		}
 
-		dec := json.NewDecoder(bytes.NewReader(rawOp))
-		dec.DisallowUnknownFields()
-		if err := dec.Decode(target); err != nil {
+		if err := json.Unmarshal(rawOp, target); err != nil {
 			return err
 		}
 		res[i] = target
@@ -316,10 +392,23 @@ func (u *BalanceUpdates) UnmarshalJSON(text []byte) error {
 	return nil
 }
 
+// GobEncode encodes balance updates as JSON as Gob can't decode interface values of unregistered types
+func (u BalanceUpdates) GobEncode() ([]byte, error) {
+	return json.Marshal([]BalanceUpdate(u))
+}
+
+func (u *BalanceUpdates) GobDecode(data []byte) error {
+	return u.UnmarshalJSON(data)
+}
+
 type BlockInfo struct {
-	Header       *BlockHeader     `json:"header"`
+	Header *BlockHeader `json:"header"`
+	// MinValidTime is minimal_valid_time for Emmy* blocks and the round start time for Tenderbake ones
 	Stat         *BlockStatistics `json:"statistics"`
 	MinValidTime time.Time        `json:"minimal_valid_time"`
+	Orphaned     bool             `json:"orphaned" tz:"orphaned"`
+	// Metadata is missing in blocks cached by older versions, such blocks are fetched again
+	Metadata *BlockMetadataInfo `json:"metadata,omitempty"`
 }
 
 type BlockStatistics struct {
@@ -329,16 +418,22 @@ type BlockStatistics struct {
 }
 
 type NumOps struct {
-	Endorsement               uint64 `json:"endorsement"`
-	SeedNonceRevelation       uint64 `json:"seed_nonce_revelation"`
-	DoubleEndorsementEvidence uint64 `json:"double_endorsement_evidence"`
-	DoubleBakingEvidence      uint64 `json:"double_baking_evidence"`
-	ActivateAccount           uint64 `json:"activate_account"`
-	Proposals                 uint64 `json:"proposals"`
-	Ballot                    uint64 `json:"ballot"`
-	Reveal                    uint64 `json:"reveal"`
-	Transaction               uint64 `json:"transaction"`
-	Origination               uint64 `json:"origination"`
-	Delegation                uint64 `json:"delegation"`
-	FailingNoop               uint64 `json:"failing_noop"`
+	Endorsement                  uint64 `json:"endorsement"`
+	SeedNonceRevelation          uint64 `json:"seed_nonce_revelation"`
+	DoubleEndorsementEvidence    uint64 `json:"double_endorsement_evidence"`
+	DoubleBakingEvidence         uint64 `json:"double_baking_evidence"`
+	ActivateAccount              uint64 `json:"activate_account"`
+	Proposals                    uint64 `json:"proposals"`
+	Ballot                       uint64 `json:"ballot"`
+	Reveal                       uint64 `json:"reveal"`
+	Transaction                  uint64 `json:"transaction"`
+	Origination                  uint64 `json:"origination"`
+	Delegation                   uint64 `json:"delegation"`
+	FailingNoop                  uint64 `json:"failing_noop"`
+	Preendorsement               uint64 `json:"preendorsement"`
+	DoublePreendorsementEvidence uint64 `json:"double_preendorsement_evidence"`
+	RegisterGlobalConstant       uint64 `json:"register_global_constant"`
+	SetDepositsLimit             uint64 `json:"set_deposits_limit"`
+	// Other counts operations of kinds unknown to the block's protocol
+	Other uint64 `json:"other"`
 }
@@ -0,0 +1,175 @@
+package model
+
+import (
+	"strconv"
+)
+
+// OperationInfo is a flat summary of a single operation contents entry
+type OperationInfo struct {
+	Hash                Base58 `json:"hash" tz:"operation"`
+	Kind                string `json:"kind"`
+	ValidationPass      int    `json:"validation_pass"`
+	Index               int    `json:"index"`
+	ContentIndex        int    `json:"content_index"`
+	Source              Base58 `json:"source" tz:"address"`
+	Destination         Base58 `json:"destination" tz:"address"`
+	Amount              int64  `json:"amount" tz:"mutez"`
+	Fee                 int64  `json:"fee" tz:"mutez"`
+	GasLimit            int64  `json:"gas_limit" tz:"gas"`
+	StorageLimit        int64  `json:"storage_limit" tz:"bytes"`
+	ConsumedGas         int64  `json:"consumed_gas" tz:"gas"`
+	StorageSize         int64  `json:"storage_size" tz:"bytes"`
+	PaidStorageSizeDiff int64  `json:"paid_storage_size_diff" tz:"bytes"`
+	Status              string `json:"status" tz:"status"`
+	Slots               int64  `json:"slots"`
+}
+
+func opaqueString(m map[string]interface{}, key string) string {
+	if s, ok := m[key].(string); ok {
+		return s
+	}
+	return ""
+}
+
+func opaqueInt(m map[string]interface{}, key string) int64 {
+	v, _ := strconv.ParseInt(opaqueString(m, key), 10, 64)
+	return v
+}
+
+func opaqueAddress(m map[string]interface{}, key string) Base58 {
+	s := opaqueString(m, key)
+	if s == "" {
+		return nil
+	}
+	v, err := DecodeBase58Check(s)
+	if err != nil {
+		return nil
+	}
+	return v
+}
+
+func opaqueMap(m map[string]interface{}, key string) map[string]interface{} {
+	v, _ := m[key].(map[string]interface{})
+	return v
+}
+
+func newOpaqueOperationInfo(op OpaqueOperation) *OperationInfo {
+	info := OperationInfo{
+		Kind:         op.OperationKind(),
+		Source:       opaqueAddress(op, "source"),
+		Amount:       opaqueInt(op, "amount"),
+		Fee:          opaqueInt(op, "fee"),
+		GasLimit:     opaqueInt(op, "gas_limit"),
+		StorageLimit: opaqueInt(op, "storage_limit"),
+	}
+	switch info.Kind {
+	case "transaction":
+		info.Destination = opaqueAddress(op, "destination")
+	case "delegation":
+		info.Destination = opaqueAddress(op, "delegate")
+	case "origination":
+		info.Amount = opaqueInt(op, "balance")
+	case "activate_account":
+		info.Source = opaqueAddress(op, "pkh")
+	}
+
+	result := opaqueMap(opaqueMap(op, "metadata"), "operation_result")
+	if result != nil {
+		info.Status = opaqueString(result, "status")
+		if mgas := opaqueInt(result, "consumed_milligas"); mgas != 0 {
+			info.ConsumedGas = (mgas + 999) / 1000
+		} else {
+			info.ConsumedGas = opaqueInt(result, "consumed_gas")
+		}
+		info.StorageSize = opaqueInt(result, "storage_size")
+		info.PaidStorageSizeDiff = opaqueInt(result, "paid_storage_size_diff")
+		if info.Kind == "origination" {
+			if contracts, ok := result["originated_contracts"].([]interface{}); ok && len(contracts) != 0 {
+				if s, ok := contracts[0].(string); ok {
+					info.Destination, _ = DecodeBase58Check(s)
+				}
+			}
+		}
+	}
+	return &info
+}
+
+func newManagerOperationInfo(op ManagerOperation) *OperationInfo {
+	common := op.ManagerCommon()
+	info := OperationInfo{
+		Kind:         op.OperationKind(),
+		Source:       common.Source,
+		Fee:          int64(common.Fee),
+		GasLimit:     int64(common.GasLimit),
+		StorageLimit: int64(common.StorageLimit),
+	}
+	switch op := op.(type) {
+	case *Transaction:
+		info.Amount = int64(op.Amount)
+		info.Destination = op.Destination
+	case *Delegation:
+		info.Destination = op.Delegate
+	case *Origination:
+		info.Amount = int64(op.Balance)
+	}
+
+	if meta := op.ManagerMetadata(); meta != nil && meta.OperationResult != nil {
+		result := meta.OperationResult
+		info.Status = result.Status
+		info.ConsumedGas = result.ConsumedGasUnits()
+		info.StorageSize = int64(result.StorageSize)
+		info.PaidStorageSizeDiff = int64(result.PaidStorageSizeDiff)
+		if _, ok := op.(*Origination); ok && len(result.OriginatedContracts) != 0 {
+			info.Destination = result.OriginatedContracts[0]
+		}
+	}
+	return &info
+}
+
+// newOperationInfo returns the summary of an operation contents entry
+func newOperationInfo(contents Operation) *OperationInfo {
+	switch op := contents.(type) {
+	case EndorsementOperation:
+		return &OperationInfo{
+			Kind:   op.OperationKind(),
+			Source: op.EndorsementDelegate(),
+			Slots:  int64(op.EndorsementSlots()),
+		}
+	case *Preendorsement:
+		info := &OperationInfo{Kind: op.OperationKind()}
+		if op.Metadata != nil {
+			info.Source = op.Metadata.Delegate
+		}
+		return info
+	case ManagerOperation:
+		return newManagerOperationInfo(op)
+	case *ActivateAccount:
+		return &OperationInfo{Kind: op.OperationKind(), Source: op.PKH}
+	case *Proposals:
+		return &OperationInfo{Kind: op.OperationKind(), Source: op.Source}
+	case *Ballot:
+		return &OperationInfo{Kind: op.OperationKind(), Source: op.Source}
+	case *OpaqueOperation:
+		return newOpaqueOperationInfo(*op)
+	default:
+		return &OperationInfo{Kind: op.OperationKind()}
+	}
+}
+
+// OperationsInfo returns the summary of each operation contents entry in the block order
+func (ops BlockOperations) OperationsInfo() []*OperationInfo {
+	var res []*OperationInfo
+	for pass, list := range ops {
+		for i, operation := range list {
+			for ci, contents := range operation.Contents {
+				info := newOperationInfo(contents)
+				info.Hash = operation.Hash
+				info.ValidationPass = pass
+				info.Index = i
+				info.ContentIndex = ci
+				res = append(res, info)
+			}
+		}
+	}
+	return res
+}
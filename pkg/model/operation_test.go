@@ -0,0 +1,98 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOperationsInfo(t *testing.T) {
+	var (
+		opHash   = Base58{1, 2, 3}
+		branch   = Base58{4, 5, 6}
+		delegate = Base58{6, 161, 159, 1}
+		source   = Base58{6, 161, 159, 2}
+		dest     = Base58{2, 90, 121, 3}
+	)
+	p, err := DecodeBase58Check(ProtoGranada)
+	require.NoError(t, err)
+	protocol := Base58(p)
+	src := fmt.Sprintf(`[[{
+	"protocol": "%[7]s",
+	"chain_id": "%[1]s",
+	"hash": "%[2]s",
+	"branch": "%[3]s",
+	"contents": [{
+		"kind": "endorsement",
+		"level": 100,
+		"metadata": {"balance_updates": [], "delegate": "%[4]s", "slots": [1, 2]}
+	}],
+	"signature": "%[3]s"
+}], [], [], [{
+	"protocol": "%[7]s",
+	"chain_id": "%[1]s",
+	"hash": "%[2]s",
+	"branch": "%[3]s",
+	"contents": [{
+		"kind": "reveal",
+		"source": "%[5]s",
+		"fee": "374",
+		"counter": "1",
+		"gas_limit": "1100",
+		"storage_limit": "0",
+		"public_key": "edpk",
+		"metadata": {"operation_result": {"status": "applied", "consumed_gas": "1000", "consumed_milligas": "1000000"}}
+	}, {
+		"kind": "transaction",
+		"source": "%[5]s",
+		"fee": "1420",
+		"counter": "2",
+		"gas_limit": "10600",
+		"storage_limit": "300",
+		"amount": "1000000",
+		"destination": "%[6]s",
+		"metadata": {"operation_result": {"status": "applied", "consumed_milligas": "10206185", "storage_size": "62", "paid_storage_size_diff": "2"}}
+	}],
+	"signature": "%[3]s"
+}]]`, Base58{0}, opHash, branch, delegate, source, dest, protocol)
+
+	var ops BlockOperations
+	require.NoError(t, json.Unmarshal([]byte(src), &ops))
+	assert.Equal(t, []*OperationInfo{
+		{
+			Hash:   opHash,
+			Kind:   "endorsement",
+			Source: delegate,
+			Slots:  2,
+		},
+		{
+			Hash:           opHash,
+			Kind:           "reveal",
+			ValidationPass: 3,
+			Source:         source,
+			Fee:            374,
+			GasLimit:       1100,
+			ConsumedGas:    1000,
+			Status:         "applied",
+		},
+		{
+			Hash:                opHash,
+			Kind:                "transaction",
+			ValidationPass:      3,
+			ContentIndex:        1,
+			Source:              source,
+			Destination:         dest,
+			Amount:              1000000,
+			Fee:                 1420,
+			GasLimit:            10600,
+			StorageLimit:        300,
+			ConsumedGas:         10207,
+			StorageSize:         62,
+			PaidStorageSizeDiff: 2,
+			Status:              "applied",
+		},
+	}, ops.OperationsInfo())
+}
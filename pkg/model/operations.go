@@ -0,0 +1,337 @@
+package model
+
+import "encoding/json"
+
+// ManagerOperationCommon holds fields shared by all manager operations
+type ManagerOperationCommon struct {
+	Source       Base58   `json:"source"`
+	Fee          Int64    `json:"fee"`
+	Counter      Int64    `json:"counter"`
+	GasLimit     Int64    `json:"gas_limit"`
+	StorageLimit Int64    `json:"storage_limit"`
+	Overflow     Overflow `json:"-"`
+}
+
+func (m *ManagerOperationCommon) ManagerCommon() *ManagerOperationCommon {
+	return m
+}
+
+type ManagerOperationMetadata struct {
+	BalanceUpdates           BalanceUpdates   `json:"balance_updates"`
+	OperationResult          *OperationResult `json:"operation_result"`
+	InternalOperationResults json.RawMessage  `json:"internal_operation_results,omitempty"`
+	Overflow                 Overflow         `json:"-"`
+}
+
+type OperationResult struct {
+	Status                       string          `json:"status"`
+	ConsumedGas                  Int64           `json:"consumed_gas,omitempty"`
+	ConsumedMilligas             Int64           `json:"consumed_milligas,omitempty"`
+	StorageSize                  Int64           `json:"storage_size,omitempty"`
+	PaidStorageSizeDiff          Int64           `json:"paid_storage_size_diff,omitempty"`
+	BalanceUpdates               BalanceUpdates  `json:"balance_updates,omitempty"`
+	OriginatedContracts          []Base58        `json:"originated_contracts,omitempty"`
+	AllocatedDestinationContract bool            `json:"allocated_destination_contract,omitempty"`
+	GlobalAddress                string          `json:"global_address,omitempty"`
+	Storage                      json.RawMessage `json:"storage,omitempty"`
+	BigMapDiff                   json.RawMessage `json:"big_map_diff,omitempty"`
+	LazyStorageDiff              json.RawMessage `json:"lazy_storage_diff,omitempty"`
+	Errors                       json.RawMessage `json:"errors,omitempty"`
+	Overflow                     Overflow        `json:"-"`
+}
+
+// ConsumedGasUnits returns consumed gas rounded up to the whole units
+func (r *OperationResult) ConsumedGasUnits() int64 {
+	if r.ConsumedMilligas != 0 {
+		return (int64(r.ConsumedMilligas) + 999) / 1000
+	}
+	return int64(r.ConsumedGas)
+}
+
+// ManagerOperation is implemented by operations paying fees on behalf of a source account
+type ManagerOperation interface {
+	Operation
+	ManagerCommon() *ManagerOperationCommon
+	ManagerMetadata() *ManagerOperationMetadata
+}
+
+type Reveal struct {
+	Kind string `json:"kind"`
+	ManagerOperationCommon
+	PublicKey string                    `json:"public_key"`
+	Metadata  *ManagerOperationMetadata `json:"metadata,omitempty"`
+}
+
+func (*Reveal) OperationKind() string {
+	return "reveal"
+}
+
+func (o *Reveal) ManagerMetadata() *ManagerOperationMetadata {
+	return o.Metadata
+}
+
+type Transaction struct {
+	Kind string `json:"kind"`
+	ManagerOperationCommon
+	Amount      Int64                     `json:"amount"`
+	Destination Base58                    `json:"destination"`
+	Parameters  json.RawMessage           `json:"parameters,omitempty"`
+	Metadata    *ManagerOperationMetadata `json:"metadata,omitempty"`
+}
+
+func (*Transaction) OperationKind() string {
+	return "transaction"
+}
+
+func (o *Transaction) ManagerMetadata() *ManagerOperationMetadata {
+	return o.Metadata
+}
+
+type Origination struct {
+	Kind string `json:"kind"`
+	ManagerOperationCommon
+	Balance  Int64                     `json:"balance"`
+	Delegate Base58                    `json:"delegate,omitempty"`
+	Script   json.RawMessage           `json:"script"`
+	Metadata *ManagerOperationMetadata `json:"metadata,omitempty"`
+}
+
+func (*Origination) OperationKind() string {
+	return "origination"
+}
+
+func (o *Origination) ManagerMetadata() *ManagerOperationMetadata {
+	return o.Metadata
+}
+
+type Delegation struct {
+	Kind string `json:"kind"`
+	ManagerOperationCommon
+	Delegate Base58                    `json:"delegate,omitempty"`
+	Metadata *ManagerOperationMetadata `json:"metadata,omitempty"`
+}
+
+func (*Delegation) OperationKind() string {
+	return "delegation"
+}
+
+func (o *Delegation) ManagerMetadata() *ManagerOperationMetadata {
+	return o.Metadata
+}
+
+type RegisterGlobalConstant struct {
+	Kind string `json:"kind"`
+	ManagerOperationCommon
+	Value    json.RawMessage           `json:"value"`
+	Metadata *ManagerOperationMetadata `json:"metadata,omitempty"`
+}
+
+func (*RegisterGlobalConstant) OperationKind() string {
+	return "register_global_constant"
+}
+
+func (o *RegisterGlobalConstant) ManagerMetadata() *ManagerOperationMetadata {
+	return o.Metadata
+}
+
+type SetDepositsLimit struct {
+	Kind string `json:"kind"`
+	ManagerOperationCommon
+	Limit    *Int64                    `json:"limit,omitempty"`
+	Metadata *ManagerOperationMetadata `json:"metadata,omitempty"`
+}
+
+func (*SetDepositsLimit) OperationKind() string {
+	return "set_deposits_limit"
+}
+
+func (o *SetDepositsLimit) ManagerMetadata() *ManagerOperationMetadata {
+	return o.Metadata
+}
+
+// BalanceUpdatesMetadata is the metadata of operations carrying only balance updates
+type BalanceUpdatesMetadata struct {
+	BalanceUpdates BalanceUpdates `json:"balance_updates"`
+	Overflow       Overflow       `json:"-"`
+}
+
+type SeedNonceRevelation struct {
+	Kind     string                  `json:"kind"`
+	Level    int64                   `json:"level"`
+	Nonce    Bytes                   `json:"nonce"`
+	Metadata *BalanceUpdatesMetadata `json:"metadata,omitempty"`
+}
+
+func (*SeedNonceRevelation) OperationKind() string {
+	return "seed_nonce_revelation"
+}
+
+type DoubleEndorsementEvidence struct {
+	Kind string          `json:"kind"`
+	Op1  json.RawMessage `json:"op1"`
+	Op2  json.RawMessage `json:"op2"`
+	// Slot is present in protocols with endorsement_with_slot
+	Slot     *uint64                 `json:"slot,omitempty"`
+	Metadata *BalanceUpdatesMetadata `json:"metadata,omitempty"`
+}
+
+func (*DoubleEndorsementEvidence) OperationKind() string {
+	return "double_endorsement_evidence"
+}
+
+type DoublePreendorsementEvidence struct {
+	Kind     string                  `json:"kind"`
+	Op1      json.RawMessage         `json:"op1"`
+	Op2      json.RawMessage         `json:"op2"`
+	Metadata *BalanceUpdatesMetadata `json:"metadata,omitempty"`
+}
+
+func (*DoublePreendorsementEvidence) OperationKind() string {
+	return "double_preendorsement_evidence"
+}
+
+type DoubleBakingEvidence struct {
+	Kind     string                  `json:"kind"`
+	Bh1      json.RawMessage         `json:"bh1"`
+	Bh2      json.RawMessage         `json:"bh2"`
+	Metadata *BalanceUpdatesMetadata `json:"metadata,omitempty"`
+}
+
+func (*DoubleBakingEvidence) OperationKind() string {
+	return "double_baking_evidence"
+}
+
+type ActivateAccount struct {
+	Kind     string                  `json:"kind"`
+	PKH      Base58                  `json:"pkh"`
+	Secret   Bytes                   `json:"secret"`
+	Metadata *BalanceUpdatesMetadata `json:"metadata,omitempty"`
+}
+
+func (*ActivateAccount) OperationKind() string {
+	return "activate_account"
+}
+
+type Proposals struct {
+	Kind      string          `json:"kind"`
+	Source    Base58          `json:"source"`
+	Period    int64           `json:"period"`
+	Proposals []Base58        `json:"proposals"`
+	Metadata  json.RawMessage `json:"metadata,omitempty"`
+}
+
+func (*Proposals) OperationKind() string {
+	return "proposals"
+}
+
+type Ballot struct {
+	Kind     string          `json:"kind"`
+	Source   Base58          `json:"source"`
+	Period   int64           `json:"period"`
+	Proposal Base58          `json:"proposal"`
+	Ballot   string          `json:"ballot"`
+	Metadata json.RawMessage `json:"metadata,omitempty"`
+}
+
+func (*Ballot) OperationKind() string {
+	return "ballot"
+}
+
+type FailingNoop struct {
+	Kind      string `json:"kind"`
+	Arbitrary string `json:"arbitrary"`
+}
+
+func (*FailingNoop) OperationKind() string {
+	return "failing_noop"
+}
+
+// EndorsementOperation is implemented by operations contributing endorsement slots (or power) to the block
+type EndorsementOperation interface {
+	Operation
+	EndorsementDelegate() Base58
+	EndorsementSlots() int
+}
+
+func (e *Endorsement) EndorsementDelegate() Base58 {
+	if e.Metadata == nil {
+		return nil
+	}
+	return e.Metadata.Delegate
+}
+
+func (e *Endorsement) EndorsementSlots() int {
+	if e.Metadata == nil {
+		return 0
+	}
+	return len(e.Metadata.Slots)
+}
+
+func (e *EndorsementWithSlot) EndorsementDelegate() Base58 {
+	if e.Metadata == nil {
+		return nil
+	}
+	return e.Metadata.Delegate
+}
+
+func (e *EndorsementWithSlot) EndorsementSlots() int {
+	if e.Metadata == nil {
+		return 0
+	}
+	return len(e.Metadata.Slots)
+}
+
+type TenderbakeEndorsementMetadata struct {
+	BalanceUpdates   BalanceUpdates `json:"balance_updates"`
+	Delegate         Base58         `json:"delegate"`
+	EndorsementPower int            `json:"endorsement_power"`
+	Overflow         Overflow       `json:"-"`
+}
+
+// TenderbakeEndorsement is the consensus operation of Tenderbake based protocols
+type TenderbakeEndorsement struct {
+	Kind             string                         `json:"kind"`
+	Slot             uint64                         `json:"slot"`
+	Level            int64                          `json:"level"`
+	Round            int64                          `json:"round"`
+	BlockPayloadHash Base58                         `json:"block_payload_hash"`
+	Metadata         *TenderbakeEndorsementMetadata `json:"metadata,omitempty"`
+}
+
+func (*TenderbakeEndorsement) OperationKind() string {
+	return "endorsement"
+}
+
+func (e *TenderbakeEndorsement) EndorsementDelegate() Base58 {
+	if e.Metadata == nil {
+		return nil
+	}
+	return e.Metadata.Delegate
+}
+
+func (e *TenderbakeEndorsement) EndorsementSlots() int {
+	if e.Metadata == nil {
+		return 0
+	}
+	return e.Metadata.EndorsementPower
+}
+
+type PreendorsementMetadata struct {
+	BalanceUpdates      BalanceUpdates `json:"balance_updates"`
+	Delegate            Base58         `json:"delegate"`
+	PreendorsementPower int            `json:"preendorsement_power"`
+	Overflow            Overflow       `json:"-"`
+}
+
+type Preendorsement struct {
+	Kind             string                  `json:"kind"`
+	Slot             uint64                  `json:"slot"`
+	Level            int64                   `json:"level"`
+	Round            int64                   `json:"round"`
+	BlockPayloadHash Base58                  `json:"block_payload_hash"`
+	Metadata         *PreendorsementMetadata `json:"metadata,omitempty"`
+}
+
+func (*Preendorsement) OperationKind() string {
+	return "preendorsement"
+}
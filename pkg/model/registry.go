@@ -0,0 +1,144 @@
+package model
+
+const (
+	ProtoEdo      = "PtEdo2ZkT9oKpimTah6x2embF25oss54njMuPzkJTEi5RqfdZFA"
+	ProtoFlorence = "PsFLorenaUUuikDWvMDr6fGBRG8kt3e3D3fHoXK1j1BFRxeSH4i"
+	ProtoGranada  = "PtGRANADsDU8R9daYKAgWnQYAJ64omN1o3KMGVCykShA97vQbvV"
+	ProtoHangzhou = "PtHangz2aRngywmSRGGvrcTyMbbdpWdpFKuS4uMWxg2RaH9i1qx"
+	ProtoIthaca   = "Psithaca2MLRFYargivpo7YvUr7wUDqyxrdhC5CQq78mRvimz6A"
+)
+
+// OperationKind describes an operation kind known to a protocol
+type OperationKind struct {
+	New func() Operation
+	// Counter returns the NumOps member counting operations of the kind
+	Counter func(*NumOps) *uint64
+}
+
+// OperationKinds maps kind names to their descriptions
+type OperationKinds map[string]*OperationKind
+
+// extend returns a copy of k with the kinds added or replaced. Nil values remove kinds
+func (k OperationKinds) extend(kinds OperationKinds) OperationKinds {
+	res := make(OperationKinds, len(k)+len(kinds))
+	for name, v := range k {
+		res[name] = v
+	}
+	for name, v := range kinds {
+		if v != nil {
+			res[name] = v
+		} else {
+			delete(res, name)
+		}
+	}
+	return res
+}
+
+// New returns an empty operation of the given kind or an opaque one if the kind is unknown
+func (k OperationKinds) New(kind string) Operation {
+	if v, ok := k[kind]; ok {
+		return v.New()
+	}
+	return new(OpaqueOperation)
+}
+
+var emmyOperationKinds = OperationKinds{
+	"endorsement": {
+		New:     func() Operation { return new(Endorsement) },
+		Counter: func(n *NumOps) *uint64 { return &n.Endorsement },
+	},
+	"endorsement_with_slot": {
+		New:     func() Operation { return new(EndorsementWithSlot) },
+		Counter: func(n *NumOps) *uint64 { return &n.Endorsement },
+	},
+	"seed_nonce_revelation": {
+		New:     func() Operation { return new(SeedNonceRevelation) },
+		Counter: func(n *NumOps) *uint64 { return &n.SeedNonceRevelation },
+	},
+	"double_endorsement_evidence": {
+		New:     func() Operation { return new(DoubleEndorsementEvidence) },
+		Counter: func(n *NumOps) *uint64 { return &n.DoubleEndorsementEvidence },
+	},
+	"double_baking_evidence": {
+		New:     func() Operation { return new(DoubleBakingEvidence) },
+		Counter: func(n *NumOps) *uint64 { return &n.DoubleBakingEvidence },
+	},
+	"activate_account": {
+		New:     func() Operation { return new(ActivateAccount) },
+		Counter: func(n *NumOps) *uint64 { return &n.ActivateAccount },
+	},
+	"proposals": {
+		New:     func() Operation { return new(Proposals) },
+		Counter: func(n *NumOps) *uint64 { return &n.Proposals },
+	},
+	"ballot": {
+		New:     func() Operation { return new(Ballot) },
+		Counter: func(n *NumOps) *uint64 { return &n.Ballot },
+	},
+	"reveal": {
+		New:     func() Operation { return new(Reveal) },
+		Counter: func(n *NumOps) *uint64 { return &n.Reveal },
+	},
+	"transaction": {
+		New:     func() Operation { return new(Transaction) },
+		Counter: func(n *NumOps) *uint64 { return &n.Transaction },
+	},
+	"origination": {
+		New:     func() Operation { return new(Origination) },
+		Counter: func(n *NumOps) *uint64 { return &n.Origination },
+	},
+	"delegation": {
+		New:     func() Operation { return new(Delegation) },
+		Counter: func(n *NumOps) *uint64 { return &n.Delegation },
+	},
+	"failing_noop": {
+		New:     func() Operation { return new(FailingNoop) },
+		Counter: func(n *NumOps) *uint64 { return &n.FailingNoop },
+	},
+}
+
+var hangzhouOperationKinds = emmyOperationKinds.extend(OperationKinds{
+	"register_global_constant": {
+		New:     func() Operation { return new(RegisterGlobalConstant) },
+		Counter: func(n *NumOps) *uint64 { return &n.RegisterGlobalConstant },
+	},
+})
+
+var tenderbakeOperationKinds = hangzhouOperationKinds.extend(OperationKinds{
+	"endorsement": {
+		New:     func() Operation { return new(TenderbakeEndorsement) },
+		Counter: func(n *NumOps) *uint64 { return &n.Endorsement },
+	},
+	"endorsement_with_slot": nil,
+	"preendorsement": {
+		New:     func() Operation { return new(Preendorsement) },
+		Counter: func(n *NumOps) *uint64 { return &n.Preendorsement },
+	},
+	"double_preendorsement_evidence": {
+		New:     func() Operation { return new(DoublePreendorsementEvidence) },
+		Counter: func(n *NumOps) *uint64 { return &n.DoublePreendorsementEvidence },
+	},
+	"set_deposits_limit": {
+		New:     func() Operation { return new(SetDepositsLimit) },
+		Counter: func(n *NumOps) *uint64 { return &n.SetDepositsLimit },
+	},
+})
+
+var protocolOperationKinds = map[string]OperationKinds{
+	ProtoEdo:      emmyOperationKinds,
+	ProtoFlorence: emmyOperationKinds,
+	ProtoGranada:  emmyOperationKinds,
+	ProtoHangzhou: hangzhouOperationKinds,
+	ProtoIthaca:   tenderbakeOperationKinds,
+}
+
+// DefaultOperationKinds are used for protocols not listed in the registry
+var DefaultOperationKinds = tenderbakeOperationKinds
+
+// ProtocolOperationKinds returns operation kinds known to the protocol
+func ProtocolOperationKinds(protocol Base58) OperationKinds {
+	if kinds, ok := protocolOperationKinds[protocol.String()]; ok {
+		return kinds
+	}
+	return DefaultOperationKinds
+}
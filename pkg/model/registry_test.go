@@ -0,0 +1,116 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProtocolOperationKinds(t *testing.T) {
+	for proto := range protocolOperationKinds {
+		p, err := DecodeBase58Check(proto)
+		require.NoError(t, err)
+		assert.Equal(t, proto, Base58(p).String())
+	}
+
+	granada, _ := DecodeBase58Check(ProtoGranada)
+	ithaca, _ := DecodeBase58Check(ProtoIthaca)
+	assert.IsType(t, new(Endorsement), ProtocolOperationKinds(granada).New("endorsement"))
+	assert.IsType(t, new(TenderbakeEndorsement), ProtocolOperationKinds(ithaca).New("endorsement"))
+	assert.IsType(t, new(OpaqueOperation), ProtocolOperationKinds(granada).New("preendorsement"))
+	assert.IsType(t, new(OpaqueOperation), ProtocolOperationKinds(ithaca).New("endorsement_with_slot"))
+	assert.IsType(t, new(TenderbakeEndorsement), ProtocolOperationKinds(Base58{0}).New("endorsement"))
+}
+
+func TestBlockStat(t *testing.T) {
+	var (
+		p, _     = DecodeBase58Check(ProtoIthaca)
+		protocol = Base58(p)
+		hash     = Base58{1, 2, 3}
+		delegate = Base58{6, 161, 159, 1}
+		source   = Base58{6, 161, 159, 2}
+	)
+	src := fmt.Sprintf(`{
+	"protocol": "%[1]s",
+	"chain_id": "%[2]s",
+	"hash": "%[2]s",
+	"header": {"level": 1},
+	"operations": [[{
+		"protocol": "%[1]s",
+		"chain_id": "%[2]s",
+		"hash": "%[2]s",
+		"branch": "%[2]s",
+		"contents": [{
+			"kind": "endorsement",
+			"slot": 0,
+			"level": 1,
+			"round": 0,
+			"block_payload_hash": "%[2]s",
+			"metadata": {"balance_updates": [], "delegate": "%[3]s", "endorsement_power": 12}
+		}],
+		"signature": "%[2]s"
+	}, {
+		"protocol": "%[1]s",
+		"chain_id": "%[2]s",
+		"hash": "%[2]s",
+		"branch": "%[2]s",
+		"contents": [{
+			"kind": "preendorsement",
+			"slot": 1,
+			"level": 1,
+			"round": 1,
+			"block_payload_hash": "%[2]s",
+			"metadata": {"balance_updates": [], "delegate": "%[3]s", "preendorsement_power": 7}
+		}],
+		"signature": "%[2]s"
+	}], [], [], [{
+		"protocol": "%[1]s",
+		"chain_id": "%[2]s",
+		"hash": "%[2]s",
+		"branch": "%[2]s",
+		"contents": [{
+			"kind": "set_deposits_limit",
+			"source": "%[4]s",
+			"fee": "400",
+			"counter": "1",
+			"gas_limit": "1000",
+			"storage_limit": "0",
+			"metadata": {"balance_updates": [], "operation_result": {"status": "applied", "consumed_milligas": "1000000"}}
+		}, {
+			"kind": "some_future_operation"
+		}],
+		"signature": "%[2]s"
+	}]]
+}`, protocol, hash, delegate, source)
+
+	var block Block
+	require.NoError(t, json.Unmarshal([]byte(src), &block))
+	assert.Equal(t, &BlockStatistics{
+		NumOps: 4,
+		Ops: &NumOps{
+			Endorsement:      1,
+			Preendorsement:   1,
+			SetDepositsLimit: 1,
+			Other:            1,
+		},
+		Slots: 12,
+	}, block.Stat())
+
+	info := block.Operations.OperationsInfo()
+	require.Len(t, info, 4)
+	assert.Equal(t, delegate, info[0].Source)
+	assert.Equal(t, int64(12), info[0].Slots)
+	assert.Equal(t, &OperationInfo{
+		Hash:           hash,
+		Kind:           "set_deposits_limit",
+		ValidationPass: 3,
+		Source:         source,
+		Fee:            400,
+		GasLimit:       1000,
+		ConsumedGas:    1000,
+		Status:         "applied",
+	}, info[2])
+}
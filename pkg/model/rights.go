@@ -0,0 +1,104 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type BakingRight struct {
+	Level    int64  `json:"level"`
+	Delegate Base58 `json:"delegate"`
+	// Priority is the round for Tenderbake based protocols
+	Priority      int64     `json:"priority"`
+	Round         *int64    `json:"round,omitempty"`
+	EstimatedTime time.Time `json:"estimated_time"`
+}
+
+func (r *BakingRight) UnmarshalJSON(text []byte) error {
+	type bakingRight BakingRight
+	var tmp bakingRight
+	if err := json.Unmarshal(text, &tmp); err != nil {
+		return err
+	}
+	*r = BakingRight(tmp)
+	if r.Round != nil {
+		r.Priority = *r.Round
+	}
+	return nil
+}
+
+type EndorsingRight struct {
+	Level    int64    `json:"level"`
+	Delegate Base58   `json:"delegate"`
+	Slots    []uint64 `json:"slots"`
+	// FirstSlot and Power are set for Tenderbake based protocols
+	FirstSlot     uint64    `json:"first_slot,omitempty"`
+	Power         int64     `json:"endorsing_power,omitempty"`
+	EstimatedTime time.Time `json:"estimated_time"`
+}
+
+// EndorsingPower returns the number of slots for Emmy* based protocols and the endorsing power for Tenderbake based ones
+func (r *EndorsingRight) EndorsingPower() int64 {
+	if len(r.Slots) != 0 {
+		return int64(len(r.Slots))
+	}
+	return r.Power
+}
+
+// EndorsingRightsEntry is an element of the endorsing_rights response. Emmy* entries are per delegate
+// while Tenderbake ones are per level and list delegates
+type EndorsingRightsEntry struct {
+	Level         int64                      `json:"level"`
+	Delegate      Base58                     `json:"delegate,omitempty"`
+	Slots         []uint64                   `json:"slots,omitempty"`
+	Delegates     []*EndorsingRightsDelegate `json:"delegates,omitempty"`
+	EstimatedTime time.Time                  `json:"estimated_time"`
+}
+
+type EndorsingRightsDelegate struct {
+	Delegate       Base58 `json:"delegate"`
+	FirstSlot      uint64 `json:"first_slot"`
+	EndorsingPower int64  `json:"endorsing_power"`
+}
+
+type EndorsingRightsEntries []*EndorsingRightsEntry
+
+// Rights returns per delegate rights
+func (entries EndorsingRightsEntries) Rights() []*EndorsingRight {
+	var res []*EndorsingRight
+	for _, e := range entries {
+		if e.Delegates == nil {
+			res = append(res, &EndorsingRight{
+				Level:         e.Level,
+				Delegate:      e.Delegate,
+				Slots:         e.Slots,
+				EstimatedTime: e.EstimatedTime,
+			})
+			continue
+		}
+		for _, d := range e.Delegates {
+			res = append(res, &EndorsingRight{
+				Level:         e.Level,
+				Delegate:      d.Delegate,
+				FirstSlot:     d.FirstSlot,
+				Power:         d.EndorsingPower,
+				EstimatedTime: e.EstimatedTime,
+			})
+		}
+	}
+	return res
+}
+
+// DelegateRights are rights of a single delegate within a cycle
+type DelegateRights struct {
+	Baking    []*BakingRight    `json:"baking"`
+	Endorsing []*EndorsingRight `json:"endorsing"`
+}
+
+type LevelInfo struct {
+	Level              int64 `json:"level"`
+	LevelPosition      int64 `json:"level_position"`
+	Cycle              int64 `json:"cycle"`
+	CyclePosition      int64 `json:"cycle_position"`
+	ExpectedCommitment bool  `json:"expected_commitment"`
+}
@@ -0,0 +1,106 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTenderbakeHeader(t *testing.T) {
+	hash := Base58{1, 2, 3}
+	src := fmt.Sprintf(`{
+	"level": 2244609,
+	"proto": 12,
+	"predecessor": "%[1]s",
+	"timestamp": "2022-04-01T09:25:44Z",
+	"validation_pass": 4,
+	"operations_hash": "%[1]s",
+	"fitness": ["02", "00224001", "", "fffffffe", "00000002"],
+	"context": "%[1]s",
+	"payload_hash": "%[1]s",
+	"payload_round": 0,
+	"proof_of_work_nonce": "7985fafe1fb70300",
+	"liquidity_baking_escape_vote": false,
+	"signature": "%[1]s"
+}`, hash)
+	var h RawBlockHeader
+	dec := json.NewDecoder(strings.NewReader(src))
+	dec.DisallowUnknownFields()
+	require.NoError(t, dec.Decode(&h))
+	assert.True(t, h.IsTenderbake())
+	assert.Equal(t, int64(2), h.Round())
+	assert.Equal(t, int64(1), h.PredecessorRound())
+
+	emmy := RawBlockHeader{Priority: 3}
+	assert.False(t, emmy.IsTenderbake())
+	assert.Equal(t, int64(3), emmy.Round())
+}
+
+func TestRoundStart(t *testing.T) {
+	c := ProtocolConstants{MinimalBlockDelay: 30, DelayIncrementPerRound: 15}
+	t0 := time.Unix(1648805144, 0).UTC()
+	assert.Equal(t, 30*time.Second, c.RoundDuration(0))
+	assert.Equal(t, 60*time.Second, c.RoundDuration(2))
+	// predecessor at round 1 (45s), then rounds 0 and 1 (30s + 45s)
+	assert.Equal(t, t0.Add(120*time.Second), c.RoundStart(t0, 1, 2))
+	assert.Equal(t, t0.Add(30*time.Second), c.RoundStart(t0, 0, 0))
+}
+
+func TestTenderbakeConstants(t *testing.T) {
+	src := `{
+	"proof_of_work_nonce_size": 8, "nonce_length": 32, "max_anon_ops_per_block": 132, "max_operation_data_length": 32768,
+	"max_proposals_per_delegate": 20, "max_micheline_node_count": 50000, "max_micheline_bytes_limit": 50000,
+	"max_allowed_global_constants_depth": 10000, "cache_layout": ["100000000"], "michelson_maximum_type_size": 2001,
+	"preserved_cycles": 5, "blocks_per_cycle": 8192, "blocks_per_commitment": 64, "blocks_per_stake_snapshot": 512,
+	"blocks_per_voting_period": 40960, "hard_gas_limit_per_operation": "1040000", "hard_gas_limit_per_block": "5200000",
+	"proof_of_work_threshold": "70368744177663", "tokens_per_roll": "6000000000", "seed_nonce_revelation_tip": "125000",
+	"origination_size": 257, "baking_reward_fixed_portion": "10000000", "baking_reward_bonus_per_slot": "4286",
+	"endorsing_reward_per_slot": "2857", "cost_per_byte": "250", "hard_storage_limit_per_operation": "60000",
+	"quorum_min": 2000, "quorum_max": 7000, "min_proposal_quorum": 500, "liquidity_baking_subsidy": "2500000",
+	"liquidity_baking_sunset_level": 3063809, "liquidity_baking_escape_ema_threshold": 666667,
+	"max_operations_time_to_live": 120, "minimal_block_delay": "30", "delay_increment_per_round": "15",
+	"consensus_committee_size": 7000, "consensus_threshold": 4667,
+	"minimal_participation_ratio": {"numerator": 2, "denominator": 3}, "max_slashing_period": 2,
+	"frozen_deposits_percentage": 10, "double_baking_punishment": "640000000",
+	"ratio_of_frozen_deposits_slashed_per_double_endorsement": {"numerator": 1, "denominator": 2}
+}`
+	var c ProtocolConstants
+	dec := json.NewDecoder(strings.NewReader(src))
+	dec.DisallowUnknownFields()
+	require.NoError(t, dec.Decode(&c))
+	assert.Equal(t, int64(30), c.MinimalBlockDelay)
+	assert.Equal(t, &Ratio{Numerator: 2, Denominator: 3}, c.MinimalParticipationRatio)
+}
+
+func TestTenderbakeRights(t *testing.T) {
+	var baking []*BakingRight
+	require.NoError(t, json.Unmarshal([]byte(`[{"level": 100, "delegate": "tz1VSUr8wwNhLAzempoch5d6hLRiTh8Cjcjb", "round": 3, "estimated_time": "2022-04-01T09:25:44Z"}]`), &baking))
+	require.Len(t, baking, 1)
+	assert.Equal(t, int64(3), baking[0].Priority)
+
+	var entries EndorsingRightsEntries
+	require.NoError(t, json.Unmarshal([]byte(`[{
+	"level": 100,
+	"delegates": [
+		{"delegate": "tz1VSUr8wwNhLAzempoch5d6hLRiTh8Cjcjb", "first_slot": 10, "endorsing_power": 25},
+		{"delegate": "tz1KqTpEZ7Yob7QbPE4Hy4Wo8fHG8LhKxZSx", "first_slot": 0, "endorsing_power": 12}
+	],
+	"estimated_time": "2022-04-01T09:25:44Z"
+}, {
+	"level": 101,
+	"delegate": "tz1VSUr8wwNhLAzempoch5d6hLRiTh8Cjcjb",
+	"slots": [1, 5, 7]
+}]`), &entries))
+	endorsing := entries.Rights()
+	require.Len(t, endorsing, 3)
+	assert.Equal(t, int64(25), endorsing[0].EndorsingPower())
+	assert.Equal(t, uint64(10), endorsing[0].FirstSlot)
+	assert.Equal(t, int64(12), endorsing[1].EndorsingPower())
+	assert.Equal(t, int64(100), endorsing[1].Level)
+	assert.Equal(t, int64(3), endorsing[2].EndorsingPower())
+}
@@ -73,17 +73,25 @@ func (val Bytes) MarshalText() ([]byte, error) {
 	return []byte(hex.EncodeToString(val)), nil
 }
 
+// Base58 is a Base58Check encoded value. An empty value is encoded as an empty string
 type Base58 []byte
 
 func (b Base58) String() string {
+	if len(b) == 0 {
+		return ""
+	}
 	return EncodeBase58Check(b)
 }
 
 func (val *Base58) UnmarshalText(text []byte) (err error) {
+	if len(text) == 0 {
+		*val = nil
+		return nil
+	}
 	*val, err = DecodeBase58Check(string(text))
 	return
 }
 
 func (val Base58) MarshalText() ([]byte, error) {
-	return []byte(EncodeBase58Check(val)), nil
+	return []byte(val.String()), nil
 }
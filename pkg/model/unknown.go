@@ -0,0 +1,175 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Overflow keeps JSON fields unknown to the model. It's populated by UnknownFields
+type Overflow map[string]json.RawMessage
+
+var overflowType = reflect.TypeOf(Overflow(nil))
+
+type structField struct {
+	index []int
+}
+
+type structInfo struct {
+	fields   map[string]*structField
+	overflow []int
+}
+
+var structCache sync.Map
+
+// getStructInfo returns JSON names of the struct fields including the promoted ones
+func getStructInfo(t reflect.Type) *structInfo {
+	if v, ok := structCache.Load(t); ok {
+		return v.(*structInfo)
+	}
+	info := structInfo{fields: make(map[string]*structField)}
+	var collect func(t reflect.Type, index []int)
+	collect = func(t reflect.Type, index []int) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			idx := append(append([]int(nil), index...), i)
+			if f.Type == overflowType {
+				info.overflow = idx
+				continue
+			}
+			tag := f.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name := strings.Split(tag, ",")[0]
+			if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+				collect(f.Type, idx)
+				continue
+			}
+			if f.PkgPath != "" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			info.fields[name] = &structField{index: idx}
+		}
+	}
+	collect(t, nil)
+	structCache.Store(t, &info)
+	return &info
+}
+
+// UnknownFields compares the JSON source against the value decoded from it and returns paths of the fields
+// having no counterpart in the model. Unknown fields are stored in Overflow members where available, fields
+// of structs lacking one are kept in the nearest enclosing Overflow by the path relative to it
+func UnknownFields(data []byte, v interface{}) ([]string, error) {
+	var res []string
+	if err := walkUnknown(json.RawMessage(data), reflect.ValueOf(v), "", nil, &res); err != nil {
+		return nil, err
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+// overflowRef is the nearest enclosing Overflow and the key prefix of the values nested in its struct
+type overflowRef struct {
+	v      reflect.Value
+	prefix string
+}
+
+func (o *overflowRef) store(name string, val json.RawMessage) {
+	if o.v.IsNil() {
+		o.v.Set(reflect.MakeMap(overflowType))
+	}
+	o.v.SetMapIndex(reflect.ValueOf(o.prefix+name), reflect.ValueOf(val))
+}
+
+// nested returns the reference with the key prefix extended by the member
+func (o *overflowRef) nested(elem string) *overflowRef {
+	if o == nil {
+		return nil
+	}
+	return &overflowRef{v: o.v, prefix: o.prefix + elem}
+}
+
+func walkUnknown(data json.RawMessage, v reflect.Value, path string, ov *overflowRef, res *[]string) error {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil
+	}
+
+	switch {
+	case v.Kind() == reflect.Struct && data[0] == '{':
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(data, &obj); err != nil {
+			return err
+		}
+		info := getStructInfo(v.Type())
+		if info.overflow != nil && v.CanAddr() {
+			ov = &overflowRef{v: v.FieldByIndex(info.overflow)}
+		}
+		for name, val := range obj {
+			p := name
+			if path != "" {
+				p = path + "." + name
+			}
+			f, ok := info.fields[name]
+			if !ok {
+				*res = append(*res, p)
+				if ov != nil {
+					ov.store(name, val)
+				}
+				continue
+			}
+			if err := walkUnknown(val, v.FieldByIndex(f.index), p, ov.nested(name+"."), res); err != nil {
+				return err
+			}
+		}
+
+	case (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && data[0] == '[':
+		var list []json.RawMessage
+		if err := json.Unmarshal(data, &list); err != nil {
+			return err
+		}
+		if len(list) != v.Len() {
+			return nil
+		}
+		if ov != nil {
+			// the trailing dot is replaced by the index
+			ov = &overflowRef{v: ov.v, prefix: strings.TrimSuffix(ov.prefix, ".")}
+		}
+		for i, val := range list {
+			if err := walkUnknown(val, v.Index(i), path+"[]", ov.nested(fmt.Sprintf("[%d].", i)), res); err != nil {
+				return err
+			}
+		}
+
+	case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String && data[0] == '{':
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(data, &obj); err != nil {
+			return err
+		}
+		for name, val := range obj {
+			elem := v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key()))
+			if !elem.IsValid() {
+				continue
+			}
+			// map elements aren't addressable so their unknown fields can only be kept by an enclosing struct
+			if err := walkUnknown(val, elem, path+"."+name, ov.nested(name+"."), res); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnknownFields(t *testing.T) {
+	var (
+		p, _     = DecodeBase58Check(ProtoHangzhou)
+		protocol = Base58(p)
+		hash     = Base58{1, 2, 3}
+		source   = Base58{6, 161, 159, 2}
+	)
+	src := fmt.Sprintf(`{
+	"protocol": "%[1]s",
+	"chain_id": "%[2]s",
+	"hash": "%[2]s",
+	"header": {"level": 1, "new_header_field": 1},
+	"metadata": {"baker": "%[3]s", "level_info": {"level": 1, "cycle": 0, "new_level_field": 1}},
+	"operations": [[], [], [], [{
+		"protocol": "%[1]s",
+		"chain_id": "%[2]s",
+		"hash": "%[2]s",
+		"branch": "%[2]s",
+		"contents": [{
+			"kind": "transaction",
+			"source": "%[3]s",
+			"fee": "400",
+			"counter": "1",
+			"gas_limit": "1000",
+			"storage_limit": "0",
+			"amount": "1",
+			"destination": "%[3]s",
+			"ticket_hash": "xyz",
+			"metadata": {"balance_updates": [{"kind": "contract", "contract": "%[3]s", "change": "-400", "origin": "block", "reason": "fee"}],
+				"operation_result": {"status": "applied", "consumed_milligas": "1000000", "ticket_updates": []}}
+		}, {
+			"kind": "some_future_operation",
+			"anything": {"goes": true}
+		}],
+		"signature": "%[2]s"
+	}]]
+}`, protocol, hash, source)
+
+	var block Block
+	require.NoError(t, json.Unmarshal([]byte(src), &block))
+	unknown, err := UnknownFields([]byte(src), &block)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"header.new_header_field",
+		"metadata.level_info.new_level_field",
+		"operations[][].contents[].metadata.balance_updates[].reason",
+		"operations[][].contents[].metadata.operation_result.ticket_updates",
+		"operations[][].contents[].ticket_hash",
+	}, unknown)
+
+	assert.Equal(t, Overflow{"new_header_field": json.RawMessage("1")}, block.Header.Overflow)
+	tx := block.Operations[3][0].Contents[0].(*Transaction)
+	assert.Equal(t, Overflow{"ticket_hash": json.RawMessage(`"xyz"`)}, tx.Overflow)
+	// nested unknown fields are kept too
+	assert.Equal(t, Overflow{"ticket_updates": json.RawMessage(`[]`)}, tx.Metadata.OperationResult.Overflow)
+	assert.Equal(t, Overflow{"reason": json.RawMessage(`"fee"`)}, tx.Metadata.BalanceUpdates[0].(*ContractBalanceUpdate).Overflow)
+	// LevelInfo has no Overflow of its own
+	assert.Equal(t, Overflow{"level_info.new_level_field": json.RawMessage("1")}, block.Metadata.Overflow)
+
+	// list elements are keyed by index
+	var outer struct {
+		Items []struct {
+			A int `json:"a"`
+		} `json:"items"`
+		Overflow Overflow `json:"-"`
+	}
+	src = `{"items": [{"a": 1}, {"a": 2, "b": 3}]}`
+	require.NoError(t, json.Unmarshal([]byte(src), &outer))
+	unknown, err = UnknownFields([]byte(src), &outer)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"items[].b"}, unknown)
+	assert.Equal(t, Overflow{"items[1].b": json.RawMessage("3")}, outer.Overflow)
+
+	// known shapes
+	var header RawBlockHeader
+	src = `{"level": 1, "priority": 0}`
+	require.NoError(t, json.Unmarshal([]byte(src), &header))
+	unknown, err = UnknownFields([]byte(src), &header)
+	require.NoError(t, err)
+	assert.Empty(t, unknown)
+}
@@ -0,0 +1,274 @@
+package plugin
+
+// server side filtering and aggregation of the rows
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+const (
+	aggCount = "count"
+	aggSum   = "sum"
+	aggAvg   = "avg"
+	aggMin   = "min"
+	aggMax   = "max"
+)
+
+var percentileRe = regexp.MustCompile(`^p(\d{1,2}(\.\d+)?)$`)
+
+// aggregation is an aggregate function applied to the expression evaluated against each row of the group
+type aggregation struct {
+	Func string `json:"func"`
+	// Expr may be empty for count
+	Expr  string `json:"expr"`
+	Alias string `json:"alias"`
+}
+
+func (a *aggregation) name() string {
+	if a.Alias != "" {
+		return a.Alias
+	}
+	return fmt.Sprintf("%s(%s)", a.Func, a.Expr)
+}
+
+// percentile returns the requested percentile for pNN functions
+func (a *aggregation) percentile() (float64, bool) {
+	m := percentileRe.FindStringSubmatch(a.Func)
+	if m == nil {
+		return 0, false
+	}
+	p, _ := strconv.ParseFloat(m[1], 64)
+	return p / 100, true
+}
+
+func (a *aggregation) validate() error {
+	switch a.Func {
+	case aggCount:
+		return nil
+	case aggSum, aggAvg, aggMin, aggMax:
+	default:
+		if _, ok := a.percentile(); !ok {
+			return fmt.Errorf("unknown aggregate function: %q", a.Func)
+		}
+	}
+	if a.Expr == "" {
+		return fmt.Errorf("%s: expression is required", a.Func)
+	}
+	return nil
+}
+
+// apply computes the aggregate over the values
+func (a *aggregation) apply(values []float64) float64 {
+	switch a.Func {
+	case aggCount:
+		return float64(len(values))
+	case aggSum, aggAvg:
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+		if a.Func == aggAvg {
+			if len(values) == 0 {
+				return math.NaN()
+			}
+			return sum / float64(len(values))
+		}
+		return sum
+	case aggMin, aggMax:
+		if len(values) == 0 {
+			return math.NaN()
+		}
+		res := values[0]
+		for _, v := range values[1:] {
+			if a.Func == aggMin && v < res || a.Func == aggMax && v > res {
+				res = v
+			}
+		}
+		return res
+	}
+	p, _ := a.percentile()
+	if len(values) == 0 {
+		return math.NaN()
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+// filterScopes returns scopes for which the CUE predicate holds
+func filterScopes(scopes []interface{}, filter string) ([]interface{}, error) {
+	if strings.TrimSpace(filter) == "" {
+		return scopes, nil
+	}
+	c, err := compileExpr(scopes, filter)
+	if err != nil || c == nil {
+		return nil, err
+	}
+	defer c.release()
+	res := make([]interface{}, 0, len(scopes))
+	for _, scope := range scopes {
+		val, err := c.eval(scope)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := val.Bool()
+		if err != nil {
+			return nil, fmt.Errorf("filter: %w", err)
+		}
+		if ok {
+			res = append(res, scope)
+		}
+	}
+	return res, nil
+}
+
+// floatValue converts numbers to float64. CUE reports an inexact conversion for zero integers so
+// those are converted separately
+func floatValue(val cue.Value) (float64, error) {
+	if val.Kind() == cue.IntKind {
+		if v, err := val.Int64(); err == nil {
+			return float64(v), nil
+		}
+	}
+	return val.Float64()
+}
+
+type aggregateGroup struct {
+	keys   []cue.Value
+	values [][]float64
+}
+
+// makeAggregateFrame groups the scopes by the values of the key expressions and returns one row per group
+// with the key columns followed by the aggregates. Groups are ordered by the first appearance
+func makeAggregateFrame(scopes []interface{}, keys []string, aggs []*aggregation, types fieldTypes) (*data.Frame, error) {
+	if len(aggs) == 0 {
+		aggs = []*aggregation{{Func: aggCount}}
+	}
+	for _, a := range aggs {
+		if err := a.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	// evaluate all expressions of a row at once
+	var expr strings.Builder
+	expr.WriteByte('{')
+	for i, k := range keys {
+		fmt.Fprintf(&expr, "k%d: (%s),", i, k)
+	}
+	for i, a := range aggs {
+		if a.Expr != "" {
+			fmt.Fprintf(&expr, "a%d: (%s),", i, a.Expr)
+		}
+	}
+	expr.WriteByte('}')
+
+	var groups []*aggregateGroup
+	groupIdx := make(map[string]int)
+	c, err := compileExpr(scopes, expr.String())
+	if err != nil {
+		return nil, err
+	}
+	if c != nil {
+		defer c.release()
+	}
+	for _, scope := range scopes {
+		val, err := c.eval(scope)
+		if err != nil {
+			return nil, err
+		}
+
+		keyVals := make([]cue.Value, len(keys))
+		var groupKey strings.Builder
+		for i := range keys {
+			v := val.LookupPath(cue.MakePath(cue.Str(fmt.Sprintf("k%d", i))))
+			if v.Err() != nil {
+				return nil, v.Err()
+			}
+			buf, err := v.MarshalJSON()
+			if err != nil {
+				return nil, err
+			}
+			groupKey.Write(buf)
+			groupKey.WriteByte(0)
+			keyVals[i] = v
+		}
+		gi, ok := groupIdx[groupKey.String()]
+		if !ok {
+			gi = len(groups)
+			groupIdx[groupKey.String()] = gi
+			groups = append(groups, &aggregateGroup{keys: keyVals, values: make([][]float64, len(aggs))})
+		}
+		g := groups[gi]
+
+		for i, a := range aggs {
+			if a.Expr == "" {
+				g.values[i] = append(g.values[i], 0)
+				continue
+			}
+			v := val.LookupPath(cue.MakePath(cue.Str(fmt.Sprintf("a%d", i))))
+			if v.Err() != nil {
+				return nil, v.Err()
+			}
+			if v.Kind() == cue.NullKind {
+				continue
+			}
+			var f float64
+			switch v.Kind() {
+			case cue.BoolKind:
+				if b, _ := v.Bool(); b {
+					f = 1
+				}
+			case cue.IntKind, cue.FloatKind:
+				var err error
+				if f, err = floatValue(v); err != nil {
+					return nil, err
+				}
+			default:
+				if a.Func != aggCount {
+					return nil, fmt.Errorf("%s: number expected: %v", a.name(), v.Kind())
+				}
+			}
+			g.values[i] = append(g.values[i], f)
+		}
+	}
+
+	frame := data.NewFrame("")
+	for i, k := range keys {
+		col := newColumn(k, k, types[k], len(groups))
+		for gi, g := range groups {
+			if err := col.set(gi, g.keys[i]); err != nil {
+				return nil, err
+			}
+		}
+		frame.Fields = append(frame.Fields, col.field())
+	}
+	for i, a := range aggs {
+		if a.Func == aggCount {
+			values := make([]int64, len(groups))
+			for gi, g := range groups {
+				values[gi] = int64(len(g.values[i]))
+			}
+			frame.Fields = append(frame.Fields, data.NewField(a.name(), nil, values))
+			continue
+		}
+		values := make([]float64, len(groups))
+		for gi, g := range groups {
+			values[gi] = a.apply(g.values[i])
+		}
+		frame.Fields = append(frame.Fields, data.NewField(a.name(), nil, values))
+	}
+	return frame, nil
+}
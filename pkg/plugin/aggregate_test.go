@@ -0,0 +1,96 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testBlock struct {
+	Baker    string `json:"baker"`
+	Priority int64  `json:"priority"`
+	Delay    int64  `json:"delay"`
+}
+
+type testBlockScope struct {
+	Block *testBlock `json:"block"`
+}
+
+func testBlockScopes() []interface{} {
+	blocks := []*testBlock{
+		{Baker: "a", Priority: 0, Delay: 30},
+		{Baker: "b", Priority: 1, Delay: 70},
+		{Baker: "a", Priority: 2, Delay: 110},
+		{Baker: "b", Priority: 0, Delay: 30},
+		{Baker: "a", Priority: 1, Delay: 70},
+	}
+	scopes := make([]interface{}, len(blocks))
+	for i, b := range blocks {
+		scopes[i] = &testBlockScope{Block: b}
+	}
+	return scopes
+}
+
+func TestFilterScopes(t *testing.T) {
+	scopes, err := filterScopes(testBlockScopes(), "block.priority > 0")
+	require.NoError(t, err)
+	assert.Len(t, scopes, 3)
+
+	scopes, err = filterScopes(testBlockScopes(), "")
+	require.NoError(t, err)
+	assert.Len(t, scopes, 5)
+
+	_, err = filterScopes(testBlockScopes(), "block.priority")
+	assert.Error(t, err)
+}
+
+func TestMakeAggregateFrame(t *testing.T) {
+	q := queryModel{
+		Filter:    "block.priority > 0",
+		GroupKeys: []string{"block.baker"},
+		Aggregations: []*aggregation{
+			{Func: "count"},
+			{Func: "sum", Expr: "block.priority", Alias: "missed"},
+			{Func: "avg", Expr: "block.delay"},
+			{Func: "max", Expr: "block.delay"},
+			{Func: "p50", Expr: "block.delay"},
+		},
+	}
+	frame, err := q.makeFrame(testBlockScopes(), "")
+	require.NoError(t, err)
+	require.Len(t, frame.Fields, 6)
+	names := make([]string, len(frame.Fields))
+	for i, f := range frame.Fields {
+		names[i] = f.Name
+	}
+	assert.Equal(t, []string{"block.baker", "count()", "missed", "avg(block.delay)", "max(block.delay)", "p50(block.delay)"}, names)
+	require.Equal(t, 2, frame.Rows())
+	// groups are ordered by the first appearance
+	assert.Equal(t, []interface{}{"b", int64(1), 1.0, 70.0, 70.0, 70.0}, frame.RowCopy(0))
+	assert.Equal(t, []interface{}{"a", int64(2), 3.0, 90.0, 110.0, 70.0}, frame.RowCopy(1))
+
+	// count by default
+	frame, err = makeAggregateFrame(testBlockScopes(), []string{"block.priority"}, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, 3, frame.Rows())
+	assert.Equal(t, []interface{}{int64(0), int64(2)}, frame.RowCopy(0))
+
+	// overall aggregates
+	frame, err = makeAggregateFrame(testBlockScopes(), nil, []*aggregation{{Func: "min", Expr: "block.delay"}}, nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, frame.Rows())
+	assert.Equal(t, []interface{}{30.0}, frame.RowCopy(0))
+
+	// zero integers
+	frame, err = makeAggregateFrame(testBlockScopes(), nil, []*aggregation{{Func: "sum", Expr: "block.priority"}}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{4.0}, frame.RowCopy(0))
+
+	_, err = makeAggregateFrame(testBlockScopes(), nil, []*aggregation{{Func: "median", Expr: "block.delay"}}, nil)
+	assert.Error(t, err)
+	_, err = makeAggregateFrame(testBlockScopes(), nil, []*aggregation{{Func: "sum"}}, nil)
+	assert.Error(t, err)
+	_, err = makeAggregateFrame(testBlockScopes(), nil, []*aggregation{{Func: "sum", Expr: "block.baker"}}, nil)
+	assert.Error(t, err)
+}
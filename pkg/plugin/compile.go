@@ -0,0 +1,202 @@
+package plugin
+
+// compiled CUE expressions shared between queries and streams
+
+import (
+	"container/list"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+)
+
+const defaultExprCacheSize = 256
+
+// the expression result is kept in a definition to not clash with the scope members
+const exprResult = "#result"
+
+var resultPath = cue.MakePath(cue.Def(exprResult))
+
+// compiledExpr is an expression compiled against the scope members declared as top values. CUE values aren't safe
+// for concurrent use so each goroutine evaluates the expression with its own evaluator taken from the pool
+type compiledExpr struct {
+	src  string
+	pool sync.Pool
+}
+
+// exprEvaluator is a copy of the compiled expression owned by a single goroutine until released
+type exprEvaluator struct {
+	expr *compiledExpr
+	tmpl cue.Value
+}
+
+// compileMtx serializes compilation as CUE runtimes share the builtin package index
+var compileMtx sync.Mutex
+
+func newExprEvaluator(expr *compiledExpr) (*exprEvaluator, error) {
+	compileMtx.Lock()
+	tmpl := cuecontext.New().CompileString(expr.src)
+	compileMtx.Unlock()
+	if tmpl.Err() != nil {
+		return nil, tmpl.Err()
+	}
+	return &exprEvaluator{expr: expr, tmpl: tmpl}, nil
+}
+
+// evaluator returns an idle evaluator or compiles a new one
+func (c *compiledExpr) evaluator() (*exprEvaluator, error) {
+	if e, ok := c.pool.Get().(*exprEvaluator); ok {
+		return e, nil
+	}
+	return newExprEvaluator(c)
+}
+
+// release returns the evaluator to the pool. Values it has produced must not be used afterwards
+func (e *exprEvaluator) release() {
+	e.expr.pool.Put(e)
+}
+
+// eval binds the scope to the expression and returns the result
+func (e *exprEvaluator) eval(scope interface{}) (cue.Value, error) {
+	v := e.tmpl.FillPath(cue.Path{}, scope)
+	if v.Err() != nil {
+		return cue.Value{}, v.Err()
+	}
+	res := v.LookupPath(resultPath)
+	if res.Err() != nil {
+		return cue.Value{}, res.Err()
+	}
+	return res, nil
+}
+
+var scopeNamesCache sync.Map
+
+// scopeNames returns JSON names of the scope struct members
+func scopeNames(t reflect.Type) ([]string, error) {
+	if v, ok := scopeNamesCache.Load(t); ok {
+		return v.([]string), nil
+	}
+	st := t
+	for st.Kind() == reflect.Ptr {
+		st = st.Elem()
+	}
+	if st.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("unsupported scope type: %v", t)
+	}
+	var names []string
+	for i := 0; i < st.NumField(); i++ {
+		f := st.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		names = append(names, name)
+	}
+	scopeNamesCache.Store(t, names)
+	return names, nil
+}
+
+type exprCacheEntry struct {
+	key  string
+	expr *compiledExpr
+}
+
+// exprCache is an LRU cache of compiled expressions keyed by the expression text and the scope members
+type exprCache struct {
+	mtx     sync.Mutex
+	size    int
+	ll      *list.List
+	entries map[string]*list.Element
+}
+
+func newExprCache(size int) *exprCache {
+	return &exprCache{
+		size:    size,
+		ll:      list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (c *exprCache) get(key string) (*compiledExpr, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if e, ok := c.entries[key]; ok {
+		c.ll.MoveToFront(e)
+		return e.Value.(*exprCacheEntry).expr, true
+	}
+	return nil, false
+}
+
+func (c *exprCache) add(key string, expr *compiledExpr) *compiledExpr {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if e, ok := c.entries[key]; ok {
+		// compiled concurrently
+		c.ll.MoveToFront(e)
+		return e.Value.(*exprCacheEntry).expr
+	}
+	c.entries[key] = c.ll.PushFront(&exprCacheEntry{key: key, expr: expr})
+	for c.ll.Len() > c.size {
+		e := c.ll.Back()
+		c.ll.Remove(e)
+		delete(c.entries, e.Value.(*exprCacheEntry).key)
+	}
+	return expr
+}
+
+func (c *exprCache) len() int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.ll.Len()
+}
+
+// compile returns the expression compiled for scopes of the given type. Each evaluator has its own CUE context
+// so expressions are evaluated in parallel
+func (c *exprCache) compile(scopeType reflect.Type, expr string) (*compiledExpr, error) {
+	names, err := scopeNames(scopeType)
+	if err != nil {
+		return nil, err
+	}
+	key := strings.Join(names, ",") + "\x00" + expr
+	if e, ok := c.get(key); ok {
+		return e, nil
+	}
+
+	var src strings.Builder
+	for _, n := range names {
+		fmt.Fprintf(&src, "%s: _\n", n)
+	}
+	fmt.Fprintf(&src, "%s: (%s)\n", exprResult, expr)
+	compiled := &compiledExpr{src: src.String()}
+	e, err := newExprEvaluator(compiled)
+	if err != nil {
+		return nil, err
+	}
+	e.release()
+	return c.add(key, compiled), nil
+}
+
+// exprs is shared by QueryData and RunStream
+var exprs = newExprCache(defaultExprCacheSize)
+
+// compileExpr compiles the expression for the scopes, which must be of the same type, and returns an evaluator
+// to be released by the caller
+func compileExpr(scopes []interface{}, expr string) (*exprEvaluator, error) {
+	if len(scopes) == 0 {
+		return nil, nil
+	}
+	c, err := exprs.compile(reflect.TypeOf(scopes[0]), expr)
+	if err != nil {
+		return nil, err
+	}
+	return c.evaluator()
+}
@@ -0,0 +1,94 @@
+package plugin
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScopeNames(t *testing.T) {
+	type scope struct {
+		Block  *testBlock `json:"block"`
+		Update int64      `json:"update,omitempty"`
+		Skip   int64      `json:"-"`
+		Plain  int64
+		hidden int64
+	}
+	names, err := scopeNames(reflect.TypeOf(&scope{}))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"block", "update", "Plain"}, names)
+
+	_, err = scopeNames(reflect.TypeOf(0))
+	assert.Error(t, err)
+}
+
+func TestExprCache(t *testing.T) {
+	cache := newExprCache(2)
+	scopeType := reflect.TypeOf(&testBlockScope{})
+
+	a, err := cache.compile(scopeType, "block.delay")
+	require.NoError(t, err)
+	a1, err := cache.compile(scopeType, "block.delay")
+	require.NoError(t, err)
+	assert.Same(t, a, a1)
+
+	_, err = cache.compile(scopeType, "block.priority")
+	require.NoError(t, err)
+	// touch a so the second one gets evicted
+	_, ok := cache.get("block\x00block.delay")
+	assert.True(t, ok)
+	_, err = cache.compile(scopeType, "block.baker")
+	require.NoError(t, err)
+	assert.Equal(t, 2, cache.len())
+	_, ok = cache.get("block\x00block.priority")
+	assert.False(t, ok)
+	_, ok = cache.get("block\x00block.delay")
+	assert.True(t, ok)
+
+	_, err = cache.compile(scopeType, "block.")
+	assert.Error(t, err)
+	assert.Equal(t, 2, cache.len())
+}
+
+func TestCompiledExprEval(t *testing.T) {
+	cache := newExprCache(defaultExprCacheSize)
+	c, err := cache.compile(reflect.TypeOf(&testBlockScope{}), "{delay: block.delay * 2, baker: block.baker}")
+	require.NoError(t, err)
+
+	// the same compiled expression is bound to each scope independently
+	var wg sync.WaitGroup
+	for _, s := range testBlockScopes() {
+		wg.Add(1)
+		go func(s *testBlockScope) {
+			defer wg.Done()
+			e, err := c.evaluator()
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer e.release()
+			val, err := e.eval(s)
+			if !assert.NoError(t, err) {
+				return
+			}
+			var res struct {
+				Delay int64  `json:"delay"`
+				Baker string `json:"baker"`
+			}
+			assert.NoError(t, val.Decode(&res))
+			assert.Equal(t, s.Block.Delay*2, res.Delay)
+			assert.Equal(t, s.Block.Baker, res.Baker)
+		}(s.(*testBlockScope))
+	}
+	wg.Wait()
+
+	c, err = cache.compile(reflect.TypeOf(&testBlockScope{}), "block.priority + \"x\"")
+	require.NoError(t, err)
+	e, err := c.evaluator()
+	require.NoError(t, err)
+	defer e.release()
+	_, err = e.eval(testBlockScopes()[0])
+	assert.Error(t, err)
+}
@@ -10,6 +10,26 @@ import (
 	"github.com/grafana/grafana-plugin-sdk-go/data"
 )
 
+// Field type hints
+const (
+	fieldTime   = "time"
+	fieldString = "string"
+	fieldInt    = "int"
+	fieldFloat  = "float"
+	fieldBool   = "bool"
+	// fieldJSON is a string column holding JSON encoded values of any kind
+	fieldJSON = "json"
+)
+
+// fieldType is a type hint of a column. Nullable columns hold nulls as is, otherwise a null is an error
+type fieldType struct {
+	Type     string `json:"type"`
+	Nullable bool   `json:"nullable"`
+}
+
+// fieldTypes maps column names to type hints. Columns of list results are named by their position
+type fieldTypes map[string]*fieldType
+
 type fieldConverter interface {
 	Set(i int, val cue.Value) error
 	Field() *data.Field
@@ -22,7 +42,7 @@ func (f *boolField) Set(i int, val cue.Value) error {
 	if err != nil {
 		return err
 	}
-	(*data.Field)(f).Set(i, v)
+	(*data.Field)(f).SetConcrete(i, v)
 	return nil
 }
 
@@ -35,7 +55,7 @@ func (f *intField) Set(i int, val cue.Value) error {
 	if err != nil {
 		return err
 	}
-	(*data.Field)(f).Set(i, v)
+	(*data.Field)(f).SetConcrete(i, v)
 	return nil
 }
 
@@ -44,11 +64,11 @@ func (f *intField) Field() *data.Field { return (*data.Field)(f) }
 type floatField data.Field
 
 func (f *floatField) Set(i int, val cue.Value) error {
-	v, err := val.Float64()
+	v, err := floatValue(val)
 	if err != nil {
 		return err
 	}
-	(*data.Field)(f).Set(i, v)
+	(*data.Field)(f).SetConcrete(i, v)
 	return nil
 }
 
@@ -61,7 +81,7 @@ func (f *stringField) Set(i int, val cue.Value) error {
 	if err != nil {
 		return err
 	}
-	(*data.Field)(f).Set(i, v)
+	(*data.Field)(f).SetConcrete(i, v)
 	return nil
 }
 
@@ -78,36 +98,214 @@ func (f *timeField) Set(i int, val cue.Value) error {
 	if err := t.UnmarshalText([]byte(v)); err != nil {
 		return err
 	}
-	(*data.Field)(f).Set(i, t)
+	(*data.Field)(f).SetConcrete(i, t)
 	return nil
 }
 
 func (f *timeField) Field() *data.Field { return (*data.Field)(f) }
 
+type jsonField data.Field
+
+func (f *jsonField) Set(i int, val cue.Value) error {
+	v, err := val.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	(*data.Field)(f).SetConcrete(i, string(v))
+	return nil
+}
+
+func (f *jsonField) Field() *data.Field { return (*data.Field)(f) }
+
+// nullableField leaves the row empty on null values
+type nullableField struct {
+	fieldConverter
+}
+
+func (f *nullableField) Set(i int, val cue.Value) error {
+	if val.Kind() == cue.NullKind {
+		return nil
+	}
+	return f.fieldConverter.Set(i, val)
+}
+
 func newFieldFromFieldType(name string, p data.FieldType, n int) *data.Field {
 	f := data.NewFieldFromFieldType(p, n)
 	f.Name = name
 	return f
 }
 
-func newFieldConverter(name string, val cue.Value, size int) (fieldConverter, error) {
-	if val.Kind() == cue.StringKind {
-		// guess type by syntax
-		var t time.Time
-		v, _ := val.String()
-		if err := t.UnmarshalText([]byte(v)); err == nil {
-			return (*timeField)(newFieldFromFieldType(name, data.FieldTypeTime, size)), nil
-		} else {
-			return (*stringField)(newFieldFromFieldType(name, data.FieldTypeString, size)), nil
-		}
-	}
+// inferFieldType guesses the column type by the value. Strings in RFC3339 format are taken for time,
+// the string type hint turns it off. Returns nil for null values
+func inferFieldType(val cue.Value) (*fieldType, error) {
 	switch val.Kind() {
+	case cue.NullKind:
+		return nil, nil
 	case cue.BoolKind:
-		return (*boolField)(newFieldFromFieldType(name, data.FieldTypeBool, size)), nil
+		return &fieldType{Type: fieldBool}, nil
 	case cue.IntKind:
-		return (*intField)(newFieldFromFieldType(name, data.FieldTypeInt64, size)), nil
+		return &fieldType{Type: fieldInt}, nil
 	case cue.FloatKind:
-		return (*floatField)(newFieldFromFieldType(name, data.FieldTypeFloat64, size)), nil
+		return &fieldType{Type: fieldFloat}, nil
+	case cue.StringKind:
+		var t time.Time
+		v, _ := val.String()
+		if err := t.UnmarshalText([]byte(v)); err == nil {
+			return &fieldType{Type: fieldTime}, nil
+		}
+		return &fieldType{Type: fieldString}, nil
+	case cue.StructKind, cue.ListKind:
+		return &fieldType{Type: fieldJSON}, nil
 	}
 	return nil, fmt.Errorf("unsupported type: %v", val.Kind())
 }
+
+func newTypedFieldConverter(name string, t *fieldType, size int) (fieldConverter, error) {
+	var (
+		p    data.FieldType
+		conv func(f *data.Field) fieldConverter
+	)
+	switch t.Type {
+	case fieldBool:
+		p, conv = data.FieldTypeBool, func(f *data.Field) fieldConverter { return (*boolField)(f) }
+	case fieldInt:
+		p, conv = data.FieldTypeInt64, func(f *data.Field) fieldConverter { return (*intField)(f) }
+	case fieldFloat:
+		p, conv = data.FieldTypeFloat64, func(f *data.Field) fieldConverter { return (*floatField)(f) }
+	case fieldString:
+		p, conv = data.FieldTypeString, func(f *data.Field) fieldConverter { return (*stringField)(f) }
+	case fieldTime:
+		p, conv = data.FieldTypeTime, func(f *data.Field) fieldConverter { return (*timeField)(f) }
+	case fieldJSON:
+		p, conv = data.FieldTypeString, func(f *data.Field) fieldConverter { return (*jsonField)(f) }
+	default:
+		return nil, fmt.Errorf("unknown field type: %q", t.Type)
+	}
+	if t.Nullable {
+		return &nullableField{conv(newFieldFromFieldType(name, p.NullableType(), size))}, nil
+	}
+	return conv(newFieldFromFieldType(name, p, size)), nil
+}
+
+// makeNullable converts the inferred column to the nullable one keeping the first n values
+func makeNullable(conv fieldConverter, n int) fieldConverter {
+	if _, ok := conv.(*nullableField); ok {
+		return conv
+	}
+	f := conv.Field()
+	nf := newFieldFromFieldType(f.Name, f.Type().NullableType(), f.Len())
+	for i := 0; i < n; i++ {
+		nf.SetConcrete(i, f.At(i))
+	}
+	switch conv.(type) {
+	case *boolField:
+		conv = (*boolField)(nf)
+	case *intField:
+		conv = (*intField)(nf)
+	case *floatField:
+		conv = (*floatField)(nf)
+	case *stringField:
+		conv = (*stringField)(nf)
+	case *timeField:
+		conv = (*timeField)(nf)
+	case *jsonField:
+		conv = (*jsonField)(nf)
+	}
+	return &nullableField{conv}
+}
+
+// column collects values of a single frame field
+type column struct {
+	// key is the field name or the position within the list result
+	key  string
+	name string
+	hint *fieldType
+	size int
+	// nullable makes the field nullable whatever the values are
+	nullable bool
+	// typ is the type the field was created with
+	typ  *fieldType
+	conv fieldConverter
+	// null or missing values were seen before the type is known
+	nulls bool
+	// sparse is set if some rows lack the field
+	sparse bool
+	// last is the last row the value was set at
+	last int
+}
+
+func newColumn(key, name string, hint *fieldType, size int) *column {
+	return &column{key: key, name: name, hint: hint, size: size, last: -1}
+}
+
+// set converts the value creating the field on the first non-null value. Nulls turn inferred columns into
+// nullable ones
+func (c *column) set(i int, val cue.Value) error {
+	c.last = i
+	if c.conv == nil {
+		t := c.hint
+		if t == nil {
+			var err error
+			if t, err = inferFieldType(val); err != nil {
+				return fmt.Errorf("%s: %w", c.key, err)
+			}
+			if t == nil {
+				c.nulls = true
+				return nil
+			}
+		}
+		if c.nullable && !t.Nullable {
+			t = &fieldType{Type: t.Type, Nullable: true}
+		}
+		conv, err := newTypedFieldConverter(c.name, t, c.size)
+		if err != nil {
+			return fmt.Errorf("%s: %w", c.key, err)
+		}
+		if c.nulls {
+			conv = makeNullable(conv, 0)
+		}
+		c.conv, c.typ = conv, t
+	} else if val.Kind() == cue.NullKind && c.hint == nil {
+		c.conv = makeNullable(c.conv, i)
+	}
+	if err := c.conv.Set(i, val); err != nil {
+		if c.hint == nil {
+			return fmt.Errorf("%s: %w (the field type may be set explicitly)", c.key, err)
+		}
+		return fmt.Errorf("%s: %w", c.key, err)
+	}
+	return nil
+}
+
+// skip marks the row as lacking the field. Missing values are nulls regardless of the type hint
+func (c *column) skip(i int) {
+	c.sparse = true
+	if c.conv == nil {
+		c.nulls = true
+		return
+	}
+	c.conv = makeNullable(c.conv, i)
+}
+
+// fieldType returns the nullable type hint of the collected field. Columns holding only nulls are taken for strings
+func (c *column) fieldType() *fieldType {
+	if c.typ == nil {
+		return &fieldType{Type: fieldString, Nullable: true}
+	}
+	return &fieldType{Type: c.typ.Type, Nullable: true}
+}
+
+// field returns the collected field. Columns holding only nulls become nullable string ones.
+// Sparse columns are marked in the custom field config
+func (c *column) field() *data.Field {
+	var f *data.Field
+	if c.conv == nil {
+		f = newFieldFromFieldType(c.name, data.FieldTypeNullableString, c.size)
+	} else {
+		f = c.conv.Field()
+	}
+	if c.sparse {
+		f.SetConfig(&data.FieldConfig{Custom: map[string]interface{}{"sparse": true}})
+	}
+	return f
+}
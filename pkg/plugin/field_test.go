@@ -0,0 +1,123 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fieldTypesOf(frame *data.Frame) []data.FieldType {
+	types := make([]data.FieldType, len(frame.Fields))
+	for i, f := range frame.Fields {
+		types[i] = f.Type()
+	}
+	return types
+}
+
+func TestMakeFrameFieldTypes(t *testing.T) {
+	t.Run("Inferred", func(t *testing.T) {
+		frame, err := makeFrame(testBlockScopes(), `{baker: block.baker, delay: block.delay, t: "2022-04-01T00:00:00Z", obj: {p: block.priority}, list: [block.priority]}`, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []data.FieldType{data.FieldTypeString, data.FieldTypeInt64, data.FieldTypeTime, data.FieldTypeString, data.FieldTypeString}, fieldTypesOf(frame))
+		assert.Equal(t, []interface{}{"b", int64(70), time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC), `{"p":1}`, `[1]`}, frame.RowCopy(1))
+	})
+
+	t.Run("Hints", func(t *testing.T) {
+		types := fieldTypes{
+			"delay": {Type: fieldFloat},
+			"t":     {Type: fieldString},
+			"p":     {Type: fieldJSON},
+		}
+		frame, err := makeFrame(testBlockScopes(), `{delay: block.delay, t: "2022-04-01T00:00:00Z", p: block.priority}`, types)
+		require.NoError(t, err)
+		assert.Equal(t, []data.FieldType{data.FieldTypeFloat64, data.FieldTypeString, data.FieldTypeString}, fieldTypesOf(frame))
+		assert.Equal(t, []interface{}{70.0, "2022-04-01T00:00:00Z", "1"}, frame.RowCopy(1))
+
+		// list columns are referred by position
+		frame, err = makeFrame(testBlockScopes(), `[block.delay]`, fieldTypes{"0": {Type: fieldFloat}})
+		require.NoError(t, err)
+		assert.Equal(t, []data.FieldType{data.FieldTypeFloat64}, fieldTypesOf(frame))
+
+		_, err = makeFrame(testBlockScopes(), `{delay: block.delay}`, fieldTypes{"delay": {Type: "duration"}})
+		assert.Error(t, err)
+	})
+
+	t.Run("Nullable", func(t *testing.T) {
+		expr := `{p: [if block.priority > 0 {block.priority}, null][0]}`
+		frame, err := makeFrame(testBlockScopes(), expr, fieldTypes{"p": {Type: fieldInt, Nullable: true}})
+		require.NoError(t, err)
+		require.Equal(t, []data.FieldType{data.FieldTypeNullableInt64}, fieldTypesOf(frame))
+		one := int64(1)
+		assert.Equal(t, []interface{}{(*int64)(nil)}, frame.RowCopy(0))
+		assert.Equal(t, []interface{}{&one}, frame.RowCopy(1))
+
+		_, err = makeFrame(testBlockScopes(), expr, fieldTypes{"p": {Type: fieldInt}})
+		assert.Error(t, err)
+
+		// inferred columns become nullable on the first null
+		frame, err = makeFrame(testBlockScopes(), expr, nil)
+		require.NoError(t, err)
+		require.Equal(t, []data.FieldType{data.FieldTypeNullableInt64}, fieldTypesOf(frame))
+		assert.Equal(t, []interface{}{(*int64)(nil)}, frame.RowCopy(0))
+		assert.Equal(t, []interface{}{&one}, frame.RowCopy(1))
+
+		frame, err = makeFrame(testBlockScopes(), `{p: [if block.priority == 0 {block.priority}, null][0]}`, nil)
+		require.NoError(t, err)
+		require.Equal(t, []data.FieldType{data.FieldTypeNullableInt64}, fieldTypesOf(frame))
+		zero := int64(0)
+		assert.Equal(t, []interface{}{&zero}, frame.RowCopy(0))
+		assert.Equal(t, []interface{}{(*int64)(nil)}, frame.RowCopy(1))
+	})
+
+	t.Run("TypeChange", func(t *testing.T) {
+		expr := `{v: [if block.priority == 1 {"x"}, block.priority][0]}`
+		_, err := makeFrame(testBlockScopes(), expr, nil)
+		assert.Error(t, err)
+
+		frame, err := makeFrame(testBlockScopes(), expr, fieldTypes{"v": {Type: fieldJSON}})
+		require.NoError(t, err)
+		assert.Equal(t, []interface{}{"0"}, frame.RowCopy(0))
+		assert.Equal(t, []interface{}{`"x"`}, frame.RowCopy(1))
+	})
+
+	t.Run("Sparse", func(t *testing.T) {
+		frame, err := makeFrame(testBlockScopes(), `{if block.priority > 0 {p: block.priority}, d: block.delay}`, nil)
+		require.NoError(t, err)
+		require.Len(t, frame.Fields, 2)
+		assert.Equal(t, "d", frame.Fields[0].Name)
+		assert.Equal(t, data.FieldTypeInt64, frame.Fields[0].Type())
+		assert.Nil(t, frame.Fields[0].Config)
+		assert.Equal(t, "p", frame.Fields[1].Name)
+		assert.Equal(t, data.FieldTypeNullableInt64, frame.Fields[1].Type())
+		assert.Equal(t, map[string]interface{}{"sparse": true}, frame.Fields[1].Config.Custom)
+		one, two := int64(1), int64(2)
+		assert.Equal(t, []interface{}{(*int64)(nil), &one, &two, (*int64)(nil), &one}, []interface{}{
+			frame.Fields[1].At(0), frame.Fields[1].At(1), frame.Fields[1].At(2), frame.Fields[1].At(3), frame.Fields[1].At(4),
+		})
+
+		// missing on later rows
+		frame, err = makeFrame(testBlockScopes(), `[block.delay, if block.priority == 0 {block.priority}]`, fieldTypes{"1": {Type: fieldFloat}})
+		require.NoError(t, err)
+		require.Len(t, frame.Fields, 2)
+		assert.Equal(t, data.FieldTypeNullableFloat64, frame.Fields[1].Type())
+		zero := 0.0
+		assert.Equal(t, []interface{}{int64(30), &zero}, frame.RowCopy(0))
+		assert.Equal(t, []interface{}{int64(70), (*float64)(nil)}, frame.RowCopy(1))
+		assert.Equal(t, []interface{}{int64(30), &zero}, frame.RowCopy(3))
+	})
+	t.Run("Live", func(t *testing.T) {
+		expr := `{d: block.delay, p: [if block.priority > 0 {block.priority}, null][0]}`
+		frame, types, err := makeLiveFrame(testBlockScopes()[1:3], expr, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []data.FieldType{data.FieldTypeNullableInt64, data.FieldTypeNullableInt64}, fieldTypesOf(frame))
+		assert.Equal(t, fieldTypes{"d": {Type: fieldInt, Nullable: true}, "p": {Type: fieldInt, Nullable: true}}, types)
+
+		// a pushed frame holding only nulls keeps the initial types
+		frame, _, err = makeLiveFrame(testBlockScopes()[:1], expr, types)
+		require.NoError(t, err)
+		assert.Equal(t, []data.FieldType{data.FieldTypeNullableInt64, data.FieldTypeNullableInt64}, fieldTypesOf(frame))
+	})
+}
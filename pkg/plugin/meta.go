@@ -0,0 +1,119 @@
+package plugin
+
+// field metadata derived from the semantic tags of the model types
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Semantic tags
+const (
+	semanticNanoseconds = "ns"
+	semanticSeconds     = "s"
+	semanticMutez       = "mutez"
+	semanticGas         = "gas"
+	semanticMilligas    = "milligas"
+	semanticBytes       = "bytes"
+	semanticRatio       = "ratio"
+	semanticAddress     = "address"
+	semanticBlock       = "block"
+	semanticOperation   = "operation"
+	semanticStatus      = "status"
+	semanticOrphaned    = "orphaned"
+)
+
+var semanticUnits = map[string]string{
+	semanticNanoseconds: "ns",
+	semanticSeconds:     "s",
+	semanticMutez:       "suffix: mutez",
+	semanticGas:         "suffix: gas",
+	semanticMilligas:    "suffix: milligas",
+	semanticBytes:       "decbytes",
+	semanticRatio:       "percentunit",
+}
+
+var semanticLinks = map[string]string{
+	semanticAddress:   "Show account",
+	semanticBlock:     "Show block",
+	semanticOperation: "Show operation",
+}
+
+var semanticMappings = map[string]data.ValueMappings{
+	semanticStatus: {data.ValueMapper{
+		"applied":     {Text: "Applied", Color: "green", Index: 0},
+		"failed":      {Text: "Failed", Color: "red", Index: 1},
+		"backtracked": {Text: "Backtracked", Color: "orange", Index: 2},
+		"skipped":     {Text: "Skipped", Color: "yellow", Index: 3},
+	}},
+	semanticOrphaned: {
+		data.SpecialValueMapper{Match: data.SpecialValueTrue, Result: data.ValueMappingResult{Text: "Orphaned", Color: "red", Index: 0}},
+		data.SpecialValueMapper{Match: data.SpecialValueFalse, Result: data.ValueMappingResult{Text: "Canonical", Color: "green", Index: 1}},
+	},
+}
+
+var scopeFieldsCache sync.Map
+
+// scopeFields returns the scope's struct fields by the dot separated selector
+func scopeFields(t reflect.Type) map[string]*structField {
+	if v, ok := scopeFieldsCache.Load(t); ok {
+		return v.(map[string]*structField)
+	}
+	fields := make(map[string]*structField)
+	for _, f := range getStructTypeFields(t) {
+		fields[strings.Join(f.Selector, ".")] = f
+	}
+	scopeFieldsCache.Store(t, fields)
+	return fields
+}
+
+// newFieldConfig returns the config for the struct field or nil if there's nothing to set. Hashes and addresses
+// link to the explorer if its URL is set, operation statuses and the orphaned flag are mapped to colored text
+func newFieldConfig(f *structField, explorer string) *data.FieldConfig {
+	var conf data.FieldConfig
+	conf.Unit = semanticUnits[f.Semantic]
+	conf.DisplayNameFromDS = f.Title
+	conf.Mappings = semanticMappings[f.Semantic]
+	if title, ok := semanticLinks[f.Semantic]; ok && explorer != "" {
+		conf.Links = []data.DataLink{{
+			Title:       title,
+			TargetBlank: true,
+			URL:         strings.TrimRight(explorer, "/") + "/${__value.raw}",
+		}}
+	}
+	if conf.Unit == "" && conf.DisplayNameFromDS == "" && conf.Links == nil && conf.Mappings == nil {
+		return nil
+	}
+	return &conf
+}
+
+// setFieldConfig attaches the configs to the frame fields taken verbatim from the scope members. selectors maps
+// the field names to the scope selectors
+func setFieldConfig(frame *data.Frame, scopeType reflect.Type, selectors map[string]string, explorer string) {
+	if len(selectors) == 0 {
+		return
+	}
+	fields := scopeFields(scopeType)
+	for _, field := range frame.Fields {
+		sel, ok := selectors[field.Name]
+		if !ok {
+			continue
+		}
+		f, ok := fields[sel]
+		if !ok {
+			continue
+		}
+		conf := newFieldConfig(f, explorer)
+		if conf == nil {
+			continue
+		}
+		if field.Config != nil {
+			// keep the sparse flag
+			conf.Custom = field.Config.Custom
+		}
+		field.SetConfig(conf)
+	}
+}
@@ -0,0 +1,69 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ecadlabs/tezos-grafana-datasource/pkg/datasource"
+	"github.com/ecadlabs/tezos-grafana-datasource/pkg/model"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFieldConfig(t *testing.T) {
+	hash := model.Base58{1, 52, 1}
+	baker := model.Base58{6, 161, 159, 1}
+	blocks := []*datasource.BlockInfo{{
+		BlockInfo: &model.BlockInfo{
+			Header: &model.BlockHeader{
+				Hash:           hash,
+				RawBlockHeader: model.RawBlockHeader{Level: 1, Timestamp: time.Unix(0, 0).UTC()},
+			},
+			Metadata: &model.BlockMetadataInfo{Baker: baker},
+		},
+		Delay: int64(30 * time.Second),
+	}}
+
+	q := queryModel{
+		Fields:   []string{"header.timestamp", "header.hash", "delay", "orphaned", "metadata.baker"},
+		explorer: "https://explorer.example.com/",
+	}
+	frame, err := q.makeFrame(blockScopes(blocks), q.Expression("block.", "header.timestamp"))
+	require.NoError(t, err)
+	require.Len(t, frame.Fields, 5)
+
+	assert.Nil(t, frame.Fields[0].Config)
+	assert.Equal(t, &data.FieldConfig{
+		Links: []data.DataLink{{Title: "Show block", TargetBlank: true, URL: "https://explorer.example.com/${__value.raw}"}},
+	}, frame.Fields[1].Config)
+	assert.Equal(t, &data.FieldConfig{Unit: "ns", DisplayNameFromDS: "Block delay"}, frame.Fields[2].Config)
+	require.NotNil(t, frame.Fields[3].Config)
+	assert.Len(t, frame.Fields[3].Config.Mappings, 2)
+	require.NotNil(t, frame.Fields[4].Config)
+	assert.Equal(t, "Show account", frame.Fields[4].Config.Links[0].Title)
+
+	// no links without the explorer
+	q.explorer = ""
+	frame, err = q.makeFrame(blockScopes(blocks), q.Expression("block.", "header.timestamp"))
+	require.NoError(t, err)
+	assert.Nil(t, frame.Fields[1].Config)
+
+	// group keys
+	q = queryModel{
+		GroupKeys:    []string{"block.metadata.baker"},
+		Aggregations: []*aggregation{{Func: "avg", Expr: "block.delay"}},
+		explorer:     "https://explorer.example.com",
+	}
+	frame, err = q.makeFrame(blockScopes(blocks), "")
+	require.NoError(t, err)
+	require.NotNil(t, frame.Fields[0].Config)
+	assert.Equal(t, "https://explorer.example.com/${__value.raw}", frame.Fields[0].Config.Links[0].URL)
+	assert.Nil(t, frame.Fields[1].Config)
+
+	// expressions have no metadata
+	q = queryModel{UseExpr: true, Expr: "{delay: block.delay}"}
+	frame, err = q.makeFrame(blockScopes(blocks), q.Expression("block."))
+	require.NoError(t, err)
+	assert.Nil(t, frame.Fields[0].Config)
+}
@@ -2,18 +2,23 @@ package plugin
 
 import (
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"cuelang.org/go/cue"
-	"cuelang.org/go/cue/cuecontext"
 	"github.com/ecadlabs/tezos-grafana-datasource/pkg/client"
 	"github.com/ecadlabs/tezos-grafana-datasource/pkg/datasource"
+	"github.com/ecadlabs/tezos-grafana-datasource/pkg/model"
 	"github.com/ecadlabs/tezos-grafana-datasource/pkg/storage/bolt"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/httpclient"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/instancemgmt"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
 	"github.com/grafana/grafana-plugin-sdk-go/data"
@@ -23,61 +28,328 @@ import (
 const (
 	queryBlockInfo       = "block_info"
 	queryBlockInfoFields = "block_info_fields"
+	queryBucketFields    = "block_bucket_fields"
+	queryOperations      = "operations"
+	queryOperationFields = "operation_fields"
+	queryBakerPerf       = "baker_performance"
+	queryBakerPerfFields = "baker_performance_fields"
+	queryBalanceUpdates  = "balance_updates"
+	queryBalanceFields   = "balance_update_fields"
+	queryRights          = "upcoming_rights"
+	queryRightsFields    = "upcoming_rights_fields"
+	queryDiagnostics     = "diagnostics"
+	queryMempool         = "mempool"
+	queryMempoolFields   = "mempool_fields"
+	queryPending         = "mempool_operations"
+	queryPendingFields   = "mempool_operation_fields"
+)
+
+const chainIDTimeout = 30 * time.Second
+
+const (
+	breakerThreshold = 5
+	breakerCooldown  = 30 * time.Second
+)
+
+const (
+	endpointsCheckInterval = 30 * time.Second
+	defaultMaxHeadLag      = 2
 )
 
 type TezosDatasource struct {
 	storage *bolt.BoltStorage
-}
+	conf    datasourceConfig
+	unknown *client.UnknownFields
+	rpc     *client.Client
+	// stops the endpoints health check
+	cancel context.CancelFunc
+	// explorer is the base URL of the block explorer hashes and addresses link to
+	explorer string
 
-func NewTezosDatasource(_ backend.DataSourceInstanceSettings, storage *bolt.BoltStorage) (instancemgmt.Instance, error) {
-	return &TezosDatasource{storage: storage}, nil
+	mtx   sync.Mutex
+	chain *chainState
 }
 
-type datasourceConfig struct {
-	Chain string `json:"chain"`
+// chainState holds the per chain cache and background workers created once the chain ID is known
+type chainState struct {
+	storage *bolt.ChainStorage
+	ds      *datasource.Datasource
+	indexer *datasource.Indexer
+	// shares the head monitor between live streams
+	hub     *datasource.Hub
+	mempool *datasource.Mempool
 }
 
-func (d *TezosDatasource) newDatasource(is *backend.DataSourceInstanceSettings) (*datasource.Datasource, error) {
+func NewTezosDatasource(is backend.DataSourceInstanceSettings, storage *bolt.BoltStorage) (instancemgmt.Instance, error) {
 	var conf datasourceConfig
 	if err := json.Unmarshal(is.JSONData, &conf); err != nil {
 		return nil, err
 	}
-	return &datasource.Datasource{
-		DB: d.storage,
-		Client: &client.Client{
-			URL:   is.URL,
-			Chain: conf.Chain,
-		},
-	}, nil
+	rpc, err := newClient(&is, &conf)
+	if err != nil {
+		return nil, err
+	}
+	d := &TezosDatasource{
+		storage:  storage,
+		conf:     conf,
+		unknown:  rpc.UnknownFields,
+		rpc:      rpc,
+		explorer: conf.ExplorerURL,
+	}
+	if len(rpc.Endpoints) != 0 {
+		var hcCtx context.Context
+		hcCtx, d.cancel = context.WithCancel(context.Background())
+		go rpc.RunHealthCheck(hcCtx, endpointsCheckInterval)
+	}
+	// start the indexer right away if the node is reachable, otherwise the chain is resolved by the first request
+	if _, err := d.getChain(context.Background()); err != nil {
+		log.DefaultLogger.Warn("Chain ID is not resolved", "error", err)
+	}
+	return d, nil
 }
 
-func (d *TezosDatasource) QueryData(ctx context.Context, req *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
-	ds, err := d.newDatasource(req.PluginContext.DataSourceInstanceSettings)
+// getChain resolves the chain ID to isolate the cache namespace. Failures are returned to the caller
+// and retried by the next request. The lock isn't held during the RPC call so other requests aren't blocked
+// by an unresponsive node
+func (d *TezosDatasource) getChain(ctx context.Context) (*chainState, error) {
+	d.mtx.Lock()
+	c := d.chain
+	d.mtx.Unlock()
+	if c != nil {
+		return c, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, chainIDTimeout)
+	defer cancel()
+	chainID, err := d.rpc.GetChainID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("chain ID: %w", err)
+	}
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if d.chain != nil {
+		// resolved concurrently
+		return d.chain, nil
+	}
+	storage, err := d.storage.Chain(chainID)
 	if err != nil {
 		return nil, err
 	}
+
+	ds := &datasource.Datasource{
+		DB:          storage,
+		Client:      d.rpc,
+		Parallelism: d.conf.FetchParallelism,
+	}
+	c = &chainState{
+		storage: storage,
+		ds:      ds,
+		hub:     datasource.NewHub(ds),
+	}
+	c.mempool = datasource.NewMempool(ds, c.hub, 0)
+	if d.conf.IndexDepth > 0 {
+		c.indexer = datasource.NewIndexer(ds, c.hub, d.conf.IndexDepth)
+	}
+	d.chain = c
+	return c, nil
+}
+
+// Dispose stops the background activity before the instance is replaced
+func (d *TezosDatasource) Dispose() {
+	d.mtx.Lock()
+	c := d.chain
+	d.mtx.Unlock()
+	if c != nil {
+		c.mempool.Stop()
+		c.hub.Close()
+		if c.indexer != nil {
+			c.indexer.Stop()
+		}
+	}
+	if d.cancel != nil {
+		d.cancel()
+	}
+}
+
+type datasourceConfig struct {
+	Chain            string `json:"chain"`
+	IndexDepth       int64  `json:"indexDepth"`
+	FetchParallelism int    `json:"fetchParallelism"`
+	LenientDecoding  bool   `json:"lenientDecoding"`
+	// MaxRetries overrides the default number of retries if set
+	MaxRetries *int `json:"maxRetries"`
+	// Endpoints lists fallback node URLs
+	Endpoints []string `json:"endpoints"`
+	// MaxHeadLag overrides the default number of levels a node may lag behind the others before being deprioritized
+	MaxHeadLag *int64 `json:"maxHeadLag"`
+	// ExplorerURL is the block explorer base URL, the hash or address is appended to it
+	ExplorerURL string `json:"explorerURL"`
+}
+
+// newClient creates an RPC client using Grafana's HTTP settings: timeouts, TLS, basic auth and custom headers
+func newClient(is *backend.DataSourceInstanceSettings, conf *datasourceConfig) (*client.Client, error) {
+	opts, err := is.HTTPClientOptions()
+	if err != nil {
+		return nil, fmt.Errorf("http client options: %w", err)
+	}
+	if token := is.DecryptedSecureJSONData["bearerToken"]; token != "" {
+		if opts.Headers == nil {
+			opts.Headers = make(map[string]string)
+		}
+		opts.Headers["Authorization"] = "Bearer " + token
+	}
+	httpClient, err := httpclient.New(opts)
+	if err != nil {
+		return nil, fmt.Errorf("http client: %w", err)
+	}
+
+	retry := client.DefaultRetryPolicy
+	if conf.MaxRetries != nil {
+		retry.MaxRetries = *conf.MaxRetries
+	}
+	maxHeadLag := int64(defaultMaxHeadLag)
+	if conf.MaxHeadLag != nil {
+		maxHeadLag = *conf.MaxHeadLag
+	}
+	return &client.Client{
+		URL:           is.URL,
+		Client:        httpClient,
+		Endpoints:     conf.Endpoints,
+		MaxHeadLag:    maxHeadLag,
+		Chain:         conf.Chain,
+		Lenient:       conf.LenientDecoding,
+		UnknownFields: new(client.UnknownFields),
+		Retry:         &retry,
+		Breaker: &client.CircuitBreaker{
+			Threshold: breakerThreshold,
+			Cooldown:  breakerCooldown,
+		},
+	}, nil
+}
+
+func (d *TezosDatasource) QueryData(ctx context.Context, req *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
 	response := backend.NewQueryDataResponse()
+	chain, err := d.getChain(ctx)
 	for _, q := range req.Queries {
-		res := d.doQuery(ctx, ds, req.PluginContext, &q)
+		if err != nil {
+			response.Responses[q.RefID] = backend.DataResponse{Error: err}
+			continue
+		}
+		qctx, stats := client.WithRetryStats(ctx)
+		res := d.doQuery(qctx, chain, req.PluginContext, &q)
+		setRetryMeta(res.Frames, stats.Retries())
 		response.Responses[q.RefID] = res
 	}
 	return response, nil
 }
 
+// setRetryMeta reports the number of RPC retries made while serving the query
+func setRetryMeta(frames data.Frames, retries int64) {
+	for _, f := range frames {
+		if f.Meta == nil {
+			f.Meta = new(data.FrameMeta)
+		}
+		custom, _ := f.Meta.Custom.(map[string]interface{})
+		if custom == nil {
+			custom = make(map[string]interface{})
+		}
+		custom["rpc_retries"] = retries
+		f.Meta.Custom = custom
+	}
+}
+
 type queryModel struct {
-	Streaming bool     `json:"streaming"`
-	Fields    []string `json:"fields"`
-	Expr      string   `json:"expr"`
-	UseExpr   bool     `json:"useExpr"`
+	Streaming      bool     `json:"streaming"`
+	Fields         []string `json:"fields"`
+	Expr           string   `json:"expr"`
+	UseExpr        bool     `json:"useExpr"`
+	ShowOrphaned   bool     `json:"showOrphaned"`
+	OperationKinds []string `json:"operationKinds"`
+	Delegates      []string `json:"delegates"`
+	// GroupBy aggregates blocks by cycle, voting period or BucketSize levels
+	GroupBy    string `json:"groupBy"`
+	BucketSize int64  `json:"bucketSize"`
+	// Filter is a CUE predicate dropping the rows it doesn't hold for
+	Filter string `json:"filter"`
+	// GroupKeys and Aggregations turn the rows into one row per distinct combination of the key values
+	GroupKeys    []string       `json:"groupKeys"`
+	Aggregations []*aggregation `json:"aggregations"`
+	// FieldTypes overrides the column types inferred from the values
+	FieldTypes fieldTypes `json:"fieldTypes"`
+
+	// selectors maps the selected fields' names to the scope selectors
+	selectors map[string]string
+	explorer  string
+}
+
+func (q *queryModel) aggregate() bool {
+	return len(q.GroupKeys) != 0 || len(q.Aggregations) != 0
 }
 
-func (q *queryModel) Expression() string {
+// makeFrame filters the scopes and either aggregates them or evaluates the expression against each one
+func (q *queryModel) makeFrame(scopes []interface{}, expr string) (*data.Frame, error) {
+	frame, _, err := q.buildFrame(scopes, expr, false)
+	return frame, err
+}
+
+// buildFrame is makeFrame building the initial frame of a live query if streaming is set, see makeLiveFrame.
+// Returns the type hints to build the pushed frames with
+func (q *queryModel) buildFrame(scopes []interface{}, expr string, streaming bool) (*data.Frame, fieldTypes, error) {
+	if len(scopes) == 0 {
+		return buildFrame(scopes, expr, q.FieldTypes, streaming)
+	}
+	scopeType := reflect.TypeOf(scopes[0])
+	scopes, err := filterScopes(scopes, q.Filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	if q.aggregate() {
+		frame, err := makeAggregateFrame(scopes, q.GroupKeys, q.Aggregations, q.FieldTypes)
+		if err != nil {
+			return nil, nil, err
+		}
+		// group keys may be plain selectors
+		keys := make(map[string]string, len(q.GroupKeys))
+		for _, k := range q.GroupKeys {
+			keys[k] = strings.TrimSpace(k)
+		}
+		setFieldConfig(frame, scopeType, keys, q.explorer)
+		return frame, nil, nil
+	}
+	frame, types, err := buildFrame(scopes, expr, q.FieldTypes, streaming)
+	if err != nil {
+		return nil, nil, err
+	}
+	setFieldConfig(frame, scopeType, q.selectors, q.explorer)
+	return frame, types, nil
+}
+
+func (q *queryModel) delegates() ([]model.Base58, error) {
+	delegates := make([]model.Base58, len(q.Delegates))
+	for i, s := range q.Delegates {
+		var err error
+		if delegates[i], err = model.DecodeBase58Check(strings.TrimSpace(s)); err != nil {
+			return nil, err
+		}
+	}
+	return delegates, nil
+}
+
+// Expression returns the CUE expression. Selected fields are relative to the scope member denoted by prefix
+func (q *queryModel) Expression(prefix string, defaultFields ...string) string {
 	if q.UseExpr {
 		return q.Expr
 	}
 	fields := q.Fields
 	if len(q.Fields) == 0 {
-		fields = []string{"header.timestamp"}
+		fields = defaultFields
+	}
+	q.selectors = make(map[string]string, len(fields))
+	names := make(map[string]int, len(fields))
+	for _, f := range fields {
+		tmp := strings.Split(f, ".")
+		names[tmp[len(tmp)-1]]++
 	}
 	var expr strings.Builder
 	expr.WriteByte('{')
@@ -86,9 +358,15 @@ func (q *queryModel) Expression() string {
 			expr.WriteByte(',')
 		}
 		tmp := strings.Split(f, ".")
-		expr.WriteString(tmp[len(tmp)-1])
+		name := tmp[len(tmp)-1]
+		if names[name] > 1 {
+			// disambiguate fields with the same name
+			name = strings.Join(tmp, "_")
+		}
+		q.selectors[name] = prefix + f
+		expr.WriteString(name)
 		expr.WriteByte(':')
-		expr.WriteString("block.")
+		expr.WriteString(prefix)
 		expr.WriteString(f)
 	}
 	expr.WriteByte('}')
@@ -99,81 +377,179 @@ type blockScope struct {
 	Block *datasource.BlockInfo `json:"block"`
 }
 
-func makeFrame(info []*datasource.BlockInfo, expr string) (*data.Frame, error) {
-	var fields []fieldConverter
-	fieldIdx := make(map[string]int)
-	ctx := cuecontext.New()
+var blockScopeType = reflect.TypeOf((*blockScope)(nil))
 
+func blockScopes(info []*datasource.BlockInfo) []interface{} {
+	scopes := make([]interface{}, len(info))
 	for i, bi := range info {
-		scope := blockScope{
-			Block: bi,
+		scopes[i] = &blockScope{Block: bi}
+	}
+	return scopes
+}
+
+func operationScopes(ops []*datasource.OperationInfo) []interface{} {
+	scopes := make([]interface{}, len(ops))
+	for i, op := range ops {
+		scopes[i] = op
+	}
+	return scopes
+}
+
+// bakerPerformanceScopes groups the performance records by delegate preserving the order of the first appearance
+func bakerPerformanceScopes(perf []*datasource.BakerPerformanceInfo) (delegates []string, scopes map[string][]interface{}) {
+	scopes = make(map[string][]interface{})
+	for _, p := range perf {
+		delegate := p.Baker.Delegate.String()
+		if _, ok := scopes[delegate]; !ok {
+			delegates = append(delegates, delegate)
 		}
-		val := ctx.CompileString(expr, cue.Scope(ctx.Encode(&scope)))
-		if val.Err() != nil {
-			return nil, val.Err()
+		scopes[delegate] = append(scopes[delegate], p)
+	}
+	return delegates, scopes
+}
+
+// balanceUpdateScopes groups the balance updates into series by delegate and category preserving the order of the first appearance
+func balanceUpdateScopes(updates []*datasource.BalanceUpdateInfo) (series []string, scopes map[string][]interface{}) {
+	scopes = make(map[string][]interface{})
+	for _, u := range updates {
+		name := u.Update.Delegate.String() + " " + u.Update.Category
+		if _, ok := scopes[name]; !ok {
+			series = append(series, name)
+		}
+		scopes[name] = append(scopes[name], u)
+	}
+	return series, scopes
+}
+
+// makeFrame evaluates the expression against each scope value and collects the results into frame rows.
+// Column types are taken from the type hints or inferred from the first non-null value. Rows lacking
+// some of the fields hold nulls there
+func makeFrame(scopes []interface{}, expr string, types fieldTypes) (*data.Frame, error) {
+	frame, _, err := buildFrame(scopes, expr, types, false)
+	return frame, err
+}
+
+// makeLiveFrame is makeFrame for live queries. All columns are nullable so the field types don't change between
+// the pushed frames as nulls come and go. Returns the type hints of the columns to build the pushed frames with
+func makeLiveFrame(scopes []interface{}, expr string, types fieldTypes) (*data.Frame, fieldTypes, error) {
+	return buildFrame(scopes, expr, types, true)
+}
+
+func buildFrame(scopes []interface{}, expr string, types fieldTypes, nullable bool) (*data.Frame, fieldTypes, error) {
+	var columns []*column
+	columnIdx := make(map[string]int)
+	c, err := compileExpr(scopes, expr)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c != nil {
+		defer c.release()
+	}
+
+	for i, scope := range scopes {
+		val, err := c.eval(scope)
+		if err != nil {
+			return nil, nil, err
 		}
 
 		if val.Kind() == cue.StructKind {
 			f, err := val.Fields(cue.All())
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			for f.Next() {
 				if f.Value().Err() != nil {
-					return nil, f.Value().Err()
+					return nil, nil, f.Value().Err()
 				}
 				name := f.Selector().String()
-				if fi, ok := fieldIdx[name]; !ok {
-					if converter, err := newFieldConverter(name, f.Value(), len(info)); err != nil {
-						return nil, err
-					} else {
-						fieldIdx[name] = len(fields)
-						fields = append(fields, converter)
-						if err := converter.Set(i, f.Value()); err != nil {
-							return nil, err
-						}
+				ci, ok := columnIdx[name]
+				if !ok {
+					ci = len(columns)
+					columnIdx[name] = ci
+					columns = append(columns, newColumn(name, name, types[name], len(scopes)))
+					columns[ci].nullable = nullable
+					if i != 0 {
+						// the field is missing in preceding rows
+						columns[ci].skip(i)
 					}
-				} else if err := fields[fi].Set(i, f.Value()); err != nil {
-					return nil, err
+				}
+				if err := columns[ci].set(i, f.Value()); err != nil {
+					return nil, nil, err
 				}
 			}
 		} else if val.Kind() == cue.ListKind {
 			v, err := val.List()
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			var ii int
-			for v.Next() && ii <= len(fields) {
+			for v.Next() && ii <= len(columns) {
 				if v.Value().Err() != nil {
-					return nil, v.Value().Err()
+					return nil, nil, v.Value().Err()
 				}
-
-				if ii == len(fields) {
-					if converter, err := newFieldConverter("", v.Value(), len(info)); err != nil {
-						return nil, err
-					} else {
-						fields = append(fields, converter)
-						if err := converter.Set(i, v.Value()); err != nil {
-							return nil, err
-						}
+				if ii == len(columns) {
+					key := strconv.Itoa(ii)
+					columns = append(columns, newColumn(key, "", types[key], len(scopes)))
+					columns[ii].nullable = nullable
+					if i != 0 {
+						columns[ii].skip(i)
 					}
-				} else if err := fields[ii].Set(i, v.Value()); err != nil {
-					return nil, err
+				}
+				if err := columns[ii].set(i, v.Value()); err != nil {
+					return nil, nil, err
 				}
 				ii++
 			}
 		} else {
-			return nil, fmt.Errorf("list or struct type expected: %v", val.Kind())
+			return nil, nil, fmt.Errorf("list or struct type expected: %v", val.Kind())
+		}
+		for _, c := range columns {
+			if c.last != i {
+				c.skip(i)
+			}
 		}
 	}
 	frame := data.NewFrame("")
-	for _, f := range fields {
-		frame.Fields = append(frame.Fields, f.Field())
+	resolved := make(fieldTypes, len(columns))
+	for _, c := range columns {
+		frame.Fields = append(frame.Fields, c.field())
+		resolved[c.key] = c.fieldType()
+	}
+	return frame, resolved, nil
+}
+
+// makeDiagnosticsFrame lists unknown fields seen in lenient mode, most frequent first
+func makeDiagnosticsFrame(counts map[string]int64) *data.Frame {
+	paths := make([]string, 0, len(counts))
+	for p := range counts {
+		paths = append(paths, p)
 	}
-	return frame, nil
+	sort.Slice(paths, func(i, j int) bool {
+		if counts[paths[i]] != counts[paths[j]] {
+			return counts[paths[i]] > counts[paths[j]]
+		}
+		return paths[i] < paths[j]
+	})
+	values := make([]int64, len(paths))
+	for i, p := range paths {
+		values[i] = counts[p]
+	}
+	return data.NewFrame("", data.NewField("path", nil, paths), data.NewField("count", nil, values))
 }
 
-func (d *TezosDatasource) doQuery(ctx context.Context, ds *datasource.Datasource, pCtx backend.PluginContext, query *backend.DataQuery) backend.DataResponse {
+func makeFieldsFrame(v interface{}) *data.Frame {
+	fields := getStructFields(v)
+	selectors := make([]string, len(fields))
+	types := make([]string, len(fields))
+	for i, f := range fields {
+		selectors[i] = strings.Join(f.Selector, ".")
+		types[i] = f.Type.Name()
+	}
+	return data.NewFrame("", data.NewField("selector", nil, selectors), data.NewField("type", nil, types))
+}
+
+func (d *TezosDatasource) doQuery(ctx context.Context, chain *chainState, pCtx backend.PluginContext, query *backend.DataQuery) backend.DataResponse {
+	ds := chain.ds
 	queryType := query.QueryType
 	if queryType == "" {
 		queryType = queryBlockInfo
@@ -184,42 +560,251 @@ func (d *TezosDatasource) doQuery(ctx context.Context, ds *datasource.Datasource
 	if response.Error = json.Unmarshal(query.JSON, &q); response.Error != nil {
 		return response
 	}
+	q.explorer = d.explorer
 
 	switch queryType {
 	case queryBlockInfo:
+		if q.GroupBy != "" {
+			var buckets []*datasource.BlockBucketInfo
+			if buckets, response.Error = ds.GetBlockBuckets(ctx, query.TimeRange.From, query.TimeRange.To, q.GroupBy, q.BucketSize); response.Error != nil {
+				return response
+			}
+			scopes := make([]interface{}, len(buckets))
+			for i, b := range buckets {
+				scopes[i] = b
+			}
+			expr := q.Expression("bucket.", "start_time", "index", "delay_avg", "delay_p95", "n_ops_total", "missed_priorities", "endorsement_coverage")
+			var frame *data.Frame
+			if frame, response.Error = q.makeFrame(scopes, expr); response.Error != nil {
+				return response
+			}
+			response.Frames = append(response.Frames, frame)
+			return response
+		}
+
 		var blockInfo []*datasource.BlockInfo
 		if blockInfo, response.Error = ds.GetBlocksInfo(ctx, query.TimeRange.From, query.TimeRange.To); response.Error != nil {
 			return response
 		}
+		if q.ShowOrphaned {
+			var orphaned []*datasource.BlockInfo
+			if orphaned, response.Error = ds.GetOrphanedBlocksInfo(ctx, query.TimeRange.From, query.TimeRange.To); response.Error != nil {
+				return response
+			}
+			blockInfo = append(blockInfo, orphaned...)
+			sort.SliceStable(blockInfo, func(i, j int) bool {
+				return blockInfo[i].Header.Timestamp.Before(blockInfo[j].Header.Timestamp)
+			})
+		}
+
+		expr := q.Expression("block.", "header.timestamp")
+		streaming := q.Streaming && !q.aggregate()
+		var (
+			frame *data.Frame
+			types fieldTypes
+		)
+		if frame, types, response.Error = q.buildFrame(blockScopes(blockInfo), expr, streaming); response.Error != nil {
+			return response
+		}
+
+		if streaming {
+			params := streamParams{
+				Expr:         expr,
+				ShowOrphaned: q.ShowOrphaned,
+				Filter:       q.Filter,
+				FieldTypes:   types,
+				Selectors:    q.selectors,
+			}
+			var path string
+			if path, response.Error = params.Path(); response.Error != nil {
+				return response
+			}
+			channel := live.Channel{
+				Scope:     live.ScopeDatasource,
+				Namespace: pCtx.DataSourceInstanceSettings.UID,
+				Path:      path,
+			}
+			frame.SetMeta(&data.FrameMeta{Channel: channel.String()})
+		}
+
+		response.Frames = append(response.Frames, frame)
+		return response
 
-		expr := q.Expression()
+	case queryOperations:
+		var ops []*datasource.OperationInfo
+		if ops, response.Error = ds.GetOperationsInfo(ctx, query.TimeRange.From, query.TimeRange.To, q.OperationKinds); response.Error != nil {
+			return response
+		}
+		expr := q.Expression("", "block.header.timestamp", "operation.kind", "operation.hash")
 		var frame *data.Frame
-		if frame, response.Error = makeFrame(blockInfo, expr); response.Error != nil {
+		if frame, response.Error = q.makeFrame(operationScopes(ops), expr); response.Error != nil {
+			return response
+		}
+		response.Frames = append(response.Frames, frame)
+		return response
+
+	case queryBakerPerf:
+		var delegates []model.Base58
+		if delegates, response.Error = q.delegates(); response.Error != nil {
+			return response
+		}
+		var perf []*datasource.BakerPerformanceInfo
+		if perf, response.Error = ds.GetBakerPerformance(ctx, query.TimeRange.From, query.TimeRange.To, delegates); response.Error != nil {
 			return response
 		}
+		expr := q.Expression("", "block.header.timestamp", "baker.baked", "baker.missed_blocks", "baker.expected_slots", "baker.endorsed_slots")
+		// one time series per delegate
+		names, scopes := bakerPerformanceScopes(perf)
+		for _, name := range names {
+			var frame *data.Frame
+			if frame, response.Error = q.makeFrame(scopes[name], expr); response.Error != nil {
+				return response
+			}
+			frame.Name = name
+			response.Frames = append(response.Frames, frame)
+		}
+		return response
 
-		if q.Streaming {
+	case queryBalanceUpdates:
+		var delegates []model.Base58
+		if delegates, response.Error = q.delegates(); response.Error != nil {
+			return response
+		}
+		var updates []*datasource.BalanceUpdateInfo
+		if updates, response.Error = ds.GetBalanceUpdates(ctx, query.TimeRange.From, query.TimeRange.To, delegates); response.Error != nil {
+			return response
+		}
+		expr := q.Expression("", "block.header.timestamp", "update.change", "update.cycle")
+		// one time series per delegate and category
+		names, scopes := balanceUpdateScopes(updates)
+		for _, name := range names {
+			var frame *data.Frame
+			if frame, response.Error = q.makeFrame(scopes[name], expr); response.Error != nil {
+				return response
+			}
+			frame.Name = name
+			response.Frames = append(response.Frames, frame)
+		}
+		return response
+
+	case queryRights:
+		var delegates []model.Base58
+		if delegates, response.Error = q.delegates(); response.Error != nil {
+			return response
+		}
+		var rights []*datasource.RightInfo
+		if rights, response.Error = ds.GetUpcomingRights(ctx, delegates); response.Error != nil {
+			return response
+		}
+		scopes := make([]interface{}, len(rights))
+		for i, r := range rights {
+			scopes[i] = r
+		}
+		expr := q.Expression("right.", "estimated_time", "delegate", "kind", "level", "priority", "slots", "time_until")
+		var frame *data.Frame
+		if frame, response.Error = q.makeFrame(scopes, expr); response.Error != nil {
+			return response
+		}
+		response.Frames = append(response.Frames, frame)
+		return response
+
+	case queryMempool:
+		if response.Error = chain.mempool.Start(ctx); response.Error != nil {
+			return response
+		}
+		history := chain.mempool.History(query.TimeRange.From, query.TimeRange.To)
+		scopes := make([]interface{}, len(history))
+		for i, s := range history {
+			scopes[i] = &datasource.MempoolSnapshotInfo{Mempool: s}
+		}
+		expr := q.Expression("mempool.", "timestamp", "total", "applied", "branch_delayed", "latency_avg")
+		streaming := q.Streaming && !q.aggregate()
+		var (
+			frame *data.Frame
+			types fieldTypes
+		)
+		if frame, types, response.Error = q.buildFrame(scopes, expr, streaming); response.Error != nil {
+			return response
+		}
+		if streaming {
+			params := streamParams{
+				Expr:       expr,
+				Stream:     streamMempool,
+				Filter:     q.Filter,
+				FieldTypes: types,
+				Selectors:  q.selectors,
+			}
+			var path string
+			if path, response.Error = params.Path(); response.Error != nil {
+				return response
+			}
 			channel := live.Channel{
 				Scope:     live.ScopeDatasource,
 				Namespace: pCtx.DataSourceInstanceSettings.UID,
-				Path:      base64.RawStdEncoding.EncodeToString([]byte(expr)),
+				Path:      path,
 			}
 			frame.SetMeta(&data.FrameMeta{Channel: channel.String()})
 		}
+		response.Frames = append(response.Frames, frame)
+		return response
 
+	case queryPending:
+		if response.Error = chain.mempool.Start(ctx); response.Error != nil {
+			return response
+		}
+		pending := chain.mempool.Pending()
+		scopes := make([]interface{}, 0, len(pending))
+		filter := make(map[string]bool, len(q.OperationKinds))
+		for _, k := range q.OperationKinds {
+			filter[k] = true
+		}
+		for _, op := range pending {
+			if len(filter) == 0 || filter[op.Kind] {
+				scopes = append(scopes, &datasource.PendingOperationInfo{Operation: op})
+			}
+		}
+		expr := q.Expression("operation.", "first_seen", "class", "kind", "hash", "source", "fee")
+		var frame *data.Frame
+		if frame, response.Error = q.makeFrame(scopes, expr); response.Error != nil {
+			return response
+		}
 		response.Frames = append(response.Frames, frame)
 		return response
 
+	case queryMempoolFields:
+		response.Frames = append(response.Frames, makeFieldsFrame((*datasource.MempoolSnapshot)(nil)))
+		return response
+
+	case queryPendingFields:
+		response.Frames = append(response.Frames, makeFieldsFrame((*model.MempoolOperationInfo)(nil)))
+		return response
+
+	case queryDiagnostics:
+		response.Frames = append(response.Frames, makeDiagnosticsFrame(d.unknown.Counts()))
+		return response
+
 	case queryBlockInfoFields:
-		fields := getStructFields((*datasource.BlockInfo)(nil))
-		selectors := make([]string, len(fields))
-		types := make([]string, len(fields))
-		for i, f := range fields {
-			selectors[i] = strings.Join(f.Selector, ".")
-			types[i] = f.Type.Name()
-		}
-		frame := data.NewFrame("", data.NewField("selector", nil, selectors), data.NewField("type", nil, types))
-		response.Frames = append(response.Frames, frame)
+		response.Frames = append(response.Frames, makeFieldsFrame((*datasource.BlockInfo)(nil)))
+		return response
+
+	case queryBucketFields:
+		response.Frames = append(response.Frames, makeFieldsFrame((*datasource.BlockBucket)(nil)))
+		return response
+
+	case queryOperationFields:
+		response.Frames = append(response.Frames, makeFieldsFrame((*datasource.OperationInfo)(nil)))
+		return response
+
+	case queryBakerPerfFields:
+		response.Frames = append(response.Frames, makeFieldsFrame((*datasource.BakerPerformanceInfo)(nil)))
+		return response
+
+	case queryBalanceFields:
+		response.Frames = append(response.Frames, makeFieldsFrame((*datasource.BalanceUpdateInfo)(nil)))
+		return response
+
+	case queryRightsFields:
+		response.Frames = append(response.Frames, makeFieldsFrame((*datasource.Right)(nil)))
 		return response
 
 	default:
@@ -229,22 +814,64 @@ func (d *TezosDatasource) doQuery(ctx context.Context, ds *datasource.Datasource
 }
 
 func (d *TezosDatasource) CheckHealth(ctx context.Context, req *backend.CheckHealthRequest) (*backend.CheckHealthResult, error) {
-	ds, err := d.newDatasource(req.PluginContext.DataSourceInstanceSettings)
-	if err != nil {
-		return nil, err
+	details := make(map[string]interface{})
+	var endpointsMsg string
+	if len(d.rpc.Endpoints) != 0 {
+		endpoints := d.rpc.CheckEndpoints(ctx)
+		healthy := 0
+		for _, e := range endpoints {
+			if e.Healthy {
+				healthy++
+			}
+		}
+		endpointsMsg = fmt.Sprintf("%d of %d endpoints healthy", healthy, len(endpoints))
+		details["endpoints"] = endpoints
+	}
+
+	chain, err := d.getChain(ctx)
+	if err == nil {
+		_, err = d.rpc.GetBlockHeader(ctx, "head")
 	}
-	var status *backend.CheckHealthResult
-	_, err = ds.Client.GetBlockHeader(ctx, "head")
 	if err != nil {
-		status = &backend.CheckHealthResult{
+		res := &backend.CheckHealthResult{
 			Status:  backend.HealthStatusError,
 			Message: err.Error(),
 		}
+		if endpointsMsg != "" {
+			res.Message += " (" + endpointsMsg + ")"
+			res.JSONDetails, _ = json.Marshal(details)
+		}
+		return res, nil
 	}
-	status = &backend.CheckHealthResult{
+	status := &backend.CheckHealthResult{
 		Status:  backend.HealthStatusOk,
 		Message: "Data source is working",
 	}
+	if endpointsMsg != "" {
+		status.Message += ", " + endpointsMsg
+	}
+	if details["cache"], err = chain.storage.Stat(ctx); err != nil {
+		return nil, err
+	}
+	if chain.indexer != nil {
+		st := chain.indexer.Status()
+		if st.Highest < 0 {
+			status.Message += ", indexer is starting"
+		} else {
+			status.Message += fmt.Sprintf(", indexed levels %d to %d", st.Lowest, st.Highest)
+		}
+		if st.Error != nil {
+			status.Message += fmt.Sprintf(" (indexer error: %v)", st.Error)
+		}
+		details["indexer"] = st
+	}
+	if unknown := d.unknown.Counts(); len(unknown) != 0 {
+		status.Message += fmt.Sprintf(", %d unknown field(s) seen, see the diagnostics query", len(unknown))
+		details["unknown_fields"] = unknown
+	}
+	if status.JSONDetails, err = json.Marshal(details); err != nil {
+		return nil, err
+	}
 	return status, nil
 }
 
@@ -255,25 +882,35 @@ func (d *TezosDatasource) SubscribeStream(_ context.Context, req *backend.Subscr
 }
 
 func (d *TezosDatasource) RunStream(ctx context.Context, req *backend.RunStreamRequest, sender *backend.StreamSender) error {
-	ds, err := d.newDatasource(req.PluginContext.DataSourceInstanceSettings)
+	params, err := parseStreamPath(req.Path)
 	if err != nil {
 		return err
 	}
-
-	expr, err := base64.RawStdEncoding.DecodeString(req.Path)
+	chain, err := d.getChain(ctx)
 	if err != nil {
 		return err
 	}
+	if params.Stream == streamMempool {
+		return d.runMempoolStream(ctx, chain, params, sender)
+	}
 
-	blockinfoCh, errCh, err := ds.MonitorBlockInfo(ctx)
+	updatesCh, errCh, err := chain.hub.Subscribe(ctx)
 	if err != nil {
 		return err
 	}
-	for bi := range blockinfoCh {
-		frame, err := makeFrame([]*datasource.BlockInfo{bi}, string(expr))
+	for update := range updatesCh {
+		if update.Reorg() {
+			log.DefaultLogger.Info("Chain reorganization", "orphaned", len(update.Orphaned))
+		}
+		frame, err := makeUpdateFrame(update, params)
 		if err != nil {
 			return err
 		}
+		setFieldConfig(frame, blockScopeType, params.Selectors, d.explorer)
+		if len(frame.Fields) == 0 && !update.Reorg() {
+			// all new blocks are filtered out
+			continue
+		}
 		if err = sender.SendFrame(frame, data.IncludeAll); err != nil {
 			log.DefaultLogger.Error("Error sending frame", "error", err)
 			continue
@@ -286,6 +923,36 @@ func (d *TezosDatasource) RunStream(ctx context.Context, req *backend.RunStreamR
 	return nil
 }
 
+func (d *TezosDatasource) runMempoolStream(ctx context.Context, chain *chainState, params *streamParams, sender *backend.StreamSender) error {
+	if err := chain.mempool.Start(ctx); err != nil {
+		return err
+	}
+	snapshots, errCh := chain.mempool.Subscribe(ctx)
+	for s := range snapshots {
+		scopes, err := filterScopes([]interface{}{&datasource.MempoolSnapshotInfo{Mempool: s}}, params.Filter)
+		if err != nil {
+			return err
+		}
+		if len(scopes) == 0 {
+			continue
+		}
+		frame, _, err := makeLiveFrame(scopes, params.Expr, params.FieldTypes)
+		if err != nil {
+			return err
+		}
+		setFieldConfig(frame, reflect.TypeOf(scopes[0]), params.Selectors, d.explorer)
+		if err = sender.SendFrame(frame, data.IncludeAll); err != nil {
+			log.DefaultLogger.Error("Error sending frame", "error", err)
+			continue
+		}
+	}
+	if err, ok := <-errCh; ok && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	log.DefaultLogger.Info("Mempool stream stopped")
+	return nil
+}
+
 func (d *TezosDatasource) PublishStream(_ context.Context, req *backend.PublishStreamRequest) (*backend.PublishStreamResponse, error) {
 	return &backend.PublishStreamResponse{
 		Status: backend.PublishStreamStatusPermissionDenied,
@@ -293,7 +960,8 @@ func (d *TezosDatasource) PublishStream(_ context.Context, req *backend.PublishS
 }
 
 var (
-	_ backend.QueryDataHandler   = (*TezosDatasource)(nil)
-	_ backend.CheckHealthHandler = (*TezosDatasource)(nil)
-	_ backend.StreamHandler      = (*TezosDatasource)(nil)
+	_ instancemgmt.InstanceDisposer = (*TezosDatasource)(nil)
+	_ backend.QueryDataHandler      = (*TezosDatasource)(nil)
+	_ backend.CheckHealthHandler    = (*TezosDatasource)(nil)
+	_ backend.StreamHandler         = (*TezosDatasource)(nil)
 )
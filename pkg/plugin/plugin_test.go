@@ -0,0 +1,172 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ecadlabs/tezos-grafana-datasource/pkg/storage/bolt"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewClient(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "user" || pass != "secret" || r.Header.Get("X-Api-Key") != "key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`"NetXdQprcVkpaWU"`))
+	}))
+	defer srv.Close()
+
+	caCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	jsonData, err := json.Marshal(map[string]interface{}{
+		"chain":             "main",
+		"tlsAuthWithCACert": true,
+		"timeout":           10,
+		"httpHeaderName1":   "X-Api-Key",
+	})
+	require.NoError(t, err)
+
+	is := backend.DataSourceInstanceSettings{
+		URL:              srv.URL,
+		JSONData:         jsonData,
+		BasicAuthEnabled: true,
+		BasicAuthUser:    "user",
+		DecryptedSecureJSONData: map[string]string{
+			"basicAuthPassword": "secret",
+			"tlsCACert":         string(caCert),
+			"httpHeaderValue1":  "key",
+		},
+	}
+	var conf datasourceConfig
+	require.NoError(t, json.Unmarshal(jsonData, &conf))
+
+	rpc, err := newClient(&is, &conf)
+	require.NoError(t, err)
+	id, err := rpc.GetChainID(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "NetXdQprcVkpaWU", id.String())
+
+	// without the CA certificate the server isn't trusted
+	is.JSONData = []byte(`{}`)
+	rpc, err = newClient(&is, &datasourceConfig{})
+	require.NoError(t, err)
+	_, err = rpc.GetChainID(context.Background())
+	assert.Error(t, err)
+}
+
+func TestNewClientBearerToken(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`"NetXdQprcVkpaWU"`))
+	}))
+	defer srv.Close()
+
+	is := backend.DataSourceInstanceSettings{
+		URL:                     srv.URL,
+		JSONData:                []byte(`{}`),
+		DecryptedSecureJSONData: map[string]string{"bearerToken": "token"},
+	}
+	rpc, err := newClient(&is, &datasourceConfig{})
+	require.NoError(t, err)
+	_, err = rpc.GetChainID(context.Background())
+	require.NoError(t, err)
+}
+
+func TestLazyChainID(t *testing.T) {
+	var up int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&up) == 0 || r.URL.Path != "/chains/main/chain_id" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`"NetXdQprcVkpaWU"`))
+	}))
+	defer srv.Close()
+
+	storage, err := bolt.NewBoltStorage(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer storage.Close()
+
+	// the instance is created while the node is down
+	inst, err := NewTezosDatasource(backend.DataSourceInstanceSettings{URL: srv.URL, JSONData: []byte(`{"maxRetries": 0}`)}, storage)
+	require.NoError(t, err)
+	d := inst.(*TezosDatasource)
+	defer d.Dispose()
+
+	res, err := d.QueryData(context.Background(), &backend.QueryDataRequest{
+		Queries: []backend.DataQuery{{RefID: "A", QueryType: queryBlockInfoFields, JSON: []byte(`{}`)}},
+	})
+	require.NoError(t, err)
+	assert.Error(t, res.Responses["A"].Error)
+
+	health, err := d.CheckHealth(context.Background(), &backend.CheckHealthRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, backend.HealthStatusError, health.Status)
+
+	// resolved once the node is back
+	atomic.StoreInt32(&up, 1)
+	chain, err := d.getChain(context.Background())
+	require.NoError(t, err)
+	assert.NotNil(t, chain.ds)
+}
+
+func TestChainIDUnlocked(t *testing.T) {
+	var (
+		state   int32 // 0: down, 1: the next request stalls, 2: up
+		stalled = make(chan struct{})
+		release = make(chan struct{})
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case atomic.LoadInt32(&state) == 0:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		case atomic.CompareAndSwapInt32(&state, 1, 2):
+			close(stalled)
+			<-release
+		}
+		w.Write([]byte(`"NetXdQprcVkpaWU"`))
+	}))
+	defer srv.Close()
+
+	storage, err := bolt.NewBoltStorage(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer storage.Close()
+
+	inst, err := NewTezosDatasource(backend.DataSourceInstanceSettings{URL: srv.URL, JSONData: []byte(`{"maxRetries": 0}`)}, storage)
+	require.NoError(t, err)
+	d := inst.(*TezosDatasource)
+	defer d.Dispose()
+
+	atomic.StoreInt32(&state, 1)
+	first := make(chan *chainState)
+	go func() {
+		c, err := d.getChain(context.Background())
+		assert.NoError(t, err)
+		first <- c
+	}()
+	<-stalled
+
+	// not blocked by the stalled request
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	chain, err := d.getChain(ctx)
+	require.NoError(t, err)
+
+	close(release)
+	assert.Same(t, chain, <-first)
+}
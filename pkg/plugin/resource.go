@@ -0,0 +1,67 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+const (
+	resourceCacheStats = "cache/stats"
+	resourceCachePurge = "cache/purge"
+)
+
+func sendJSON(sender backend.CallResourceResponseSender, status int, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return sender.Send(&backend.CallResourceResponse{
+		Status:  status,
+		Headers: map[string][]string{"Content-Type": {"application/json"}},
+		Body:    body,
+	})
+}
+
+func sendError(sender backend.CallResourceResponseSender, status int, err error) error {
+	return sendJSON(sender, status, map[string]string{"error": err.Error()})
+}
+
+func (d *TezosDatasource) CallResource(ctx context.Context, req *backend.CallResourceRequest, sender backend.CallResourceResponseSender) error {
+	chain, err := d.getChain(ctx)
+	if err != nil {
+		return sendError(sender, http.StatusServiceUnavailable, err)
+	}
+	switch req.Path {
+	case resourceCacheStats:
+		if req.Method != http.MethodGet {
+			return sender.Send(&backend.CallResourceResponse{Status: http.StatusMethodNotAllowed})
+		}
+		stat, err := chain.storage.Stat(ctx)
+		if err != nil {
+			return sendError(sender, http.StatusInternalServerError, err)
+		}
+		return sendJSON(sender, http.StatusOK, stat)
+
+	case resourceCachePurge:
+		if req.Method != http.MethodPost {
+			return sender.Send(&backend.CallResourceResponse{Status: http.StatusMethodNotAllowed})
+		}
+		if err := chain.storage.Purge(ctx); err != nil {
+			return sendError(sender, http.StatusInternalServerError, err)
+		}
+		if chain.indexer != nil {
+			chain.indexer.Reset()
+		}
+		stat, err := chain.storage.Stat(ctx)
+		if err != nil {
+			return sendError(sender, http.StatusInternalServerError, err)
+		}
+		return sendJSON(sender, http.StatusOK, stat)
+
+	default:
+		return sender.Send(&backend.CallResourceResponse{Status: http.StatusNotFound})
+	}
+}
@@ -0,0 +1,109 @@
+package plugin
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ecadlabs/tezos-grafana-datasource/pkg/datasource"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// streamMempool selects the stream of mempool snapshots instead of blocks
+const streamMempool = "mempool"
+
+// streamParams are passed to RunStream through the channel path
+type streamParams struct {
+	Expr         string `json:"expr"`
+	ShowOrphaned bool   `json:"orphaned,omitempty"`
+	Stream       string `json:"stream,omitempty"`
+	Filter       string `json:"filter,omitempty"`
+	// FieldTypes are the column types of the initial frame
+	FieldTypes fieldTypes `json:"types,omitempty"`
+	// Selectors maps the field names to the scope selectors to set the fields' units and links
+	Selectors map[string]string `json:"selectors,omitempty"`
+}
+
+func (p *streamParams) Path() (string, error) {
+	buf, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawStdEncoding.EncodeToString(buf), nil
+}
+
+func parseStreamPath(path string) (*streamParams, error) {
+	buf, err := base64.RawStdEncoding.DecodeString(path)
+	if err != nil {
+		return nil, err
+	}
+	var p streamParams
+	if err := json.Unmarshal(buf, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+const streamActionReplace = "replace"
+
+type retractedBlock struct {
+	Level     int64     `json:"level"`
+	Hash      string    `json:"hash"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// streamMeta is attached to frames replacing a part of the previously streamed chain
+type streamMeta struct {
+	Action    string            `json:"action"`
+	Retracted []*retractedBlock `json:"retracted"`
+}
+
+// makeUpdateFrame returns the frame for a canonical chain update. On a branch switch the frame carries
+// the list of retracted blocks and the replacement rows, preceded by the orphaned ones if requested
+func makeUpdateFrame(update *datasource.ChainUpdate, p *streamParams) (*data.Frame, error) {
+	if !update.Reorg() {
+		scopes, err := filterScopes(blockScopes(update.Blocks), p.Filter)
+		if err != nil {
+			return nil, err
+		}
+		frame, _, err := makeLiveFrame(scopes, p.Expr, p.FieldTypes)
+		return frame, err
+	}
+
+	var rows []*datasource.BlockInfo
+	meta := streamMeta{
+		Action:    streamActionReplace,
+		Retracted: make([]*retractedBlock, len(update.Orphaned)),
+	}
+	for i, o := range update.Orphaned {
+		meta.Retracted[i] = &retractedBlock{
+			Level:     o.Header.Level,
+			Hash:      o.Header.Hash.String(),
+			Timestamp: o.Header.Timestamp,
+		}
+	}
+	if p.ShowOrphaned {
+		for i := len(update.Orphaned) - 1; i >= 0; i-- {
+			rows = append(rows, update.Orphaned[i])
+		}
+	}
+	rows = append(rows, update.Blocks...)
+
+	scopes, err := filterScopes(blockScopes(rows), p.Filter)
+	if err != nil {
+		return nil, err
+	}
+	frame, _, err := makeLiveFrame(scopes, p.Expr, p.FieldTypes)
+	if err != nil {
+		return nil, err
+	}
+	frame.SetMeta(&data.FrameMeta{
+		Custom: &meta,
+		Notices: []data.Notice{{
+			Severity: data.NoticeSeverityWarning,
+			Text:     fmt.Sprintf("Chain reorganization: %d block(s) orphaned since level %d", len(update.Orphaned), update.Orphaned[len(update.Orphaned)-1].Header.Level),
+		}},
+	})
+	return frame, nil
+}
@@ -12,6 +12,10 @@ import (
 type structField struct {
 	Selector []string
 	Type     reflect.Type
+	// Semantic is the meaning of the value taken from the tz tag, like a duration unit, an amount in mutez or an address
+	Semantic string
+	// Title is the display name taken from the title tag
+	Title string
 }
 
 var (
@@ -21,6 +25,7 @@ var (
 	bigRatType    = reflect.TypeOf((*big.Rat)(nil)).Elem()
 	textMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
 	jsonMarshaler = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	rawJSONType   = reflect.TypeOf(json.RawMessage(nil))
 )
 
 // collect fields with corresponding selectors which are convertable to CUE types and then to Grafana types
@@ -38,6 +43,10 @@ func getStructTypeFields(t reflect.Type) (fields []*structField) {
 		if ft.Kind() == reflect.Ptr {
 			ft = ft.Elem()
 		}
+		if ft == rawJSONType {
+			// arbitrary JSON has no fixed type
+			continue
+		}
 		name := field.Name
 		if jn := strings.Split(field.Tag.Get("json"), ",")[0]; jn != "" {
 			name = jn
@@ -45,7 +54,12 @@ func getStructTypeFields(t reflect.Type) (fields []*structField) {
 		if k := ft.Kind(); k >= reflect.Bool && k <= reflect.Float64 || k == reflect.String ||
 			ft == timeType || ft == bigIntType || ft == bigFloatType || ft == bigRatType ||
 			ft.Implements(jsonMarshaler) || ft.Implements(textMarshaler) {
-			fields = append(fields, &structField{Selector: []string{name}, Type: ft})
+			fields = append(fields, &structField{
+				Selector: []string{name},
+				Type:     ft,
+				Semantic: field.Tag.Get("tz"),
+				Title:    field.Tag.Get("title"),
+			})
 		} else if ft.Kind() == reflect.Struct {
 			nestedFields := getStructTypeFields(ft)
 			if field.Anonymous {
@@ -55,6 +69,8 @@ func getStructTypeFields(t reflect.Type) (fields []*structField) {
 					fields = append(fields, &structField{
 						Type:     f.Type,
 						Selector: append([]string{name}, f.Selector...),
+						Semantic: f.Semantic,
+						Title:    f.Title,
 					})
 				}
 			}
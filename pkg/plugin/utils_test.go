@@ -16,7 +16,7 @@ type Struct0 struct {
 }
 
 type Struct1 struct {
-	Field0 int64 `json:"field0"`
+	Field0 int64 `json:"field0" tz:"ns" title:"Field 0"`
 }
 
 type EmbeddedStruct struct {
@@ -37,6 +37,8 @@ func TestFieldSelectors(t *testing.T) {
 		{
 			Selector: []string{"field2", "field0"},
 			Type:     reflect.TypeOf(int64(0)),
+			Semantic: "ns",
+			Title:    "Field 0",
 		},
 		{
 			Selector: []string{"field3"},
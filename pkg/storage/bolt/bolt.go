@@ -236,7 +236,7 @@ func (c *Cursor) Prev(key, value interface{}) (bool, error) {
 }
 
 func (c *Cursor) Seek(seek, key, value interface{}) (bool, error) {
-	s, err := c.codec.Key.Marshal(key)
+	s, err := c.codec.Key.Marshal(seek)
 	if err != nil {
 		return false, err
 	}
@@ -279,7 +279,7 @@ func keyValFunc(t reflect.Type) (kt, vt reflect.Type) {
 	if t.NumOut() != 1 {
 		panic(fmt.Sprintf("wrong number of return parameters: %d", t.NumOut()))
 	}
-	if t.Out(1) != errorType {
+	if t.Out(0) != errorType {
 		panic("function must return an error")
 	}
 	return t.In(0), t.In(1)
@@ -1,45 +1,400 @@
 package bolt
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/ecadlabs/tezos-grafana-datasource/pkg/model"
 	"github.com/ecadlabs/tezos-grafana-datasource/pkg/storage"
+	bolt "go.etcd.io/bbolt"
 )
 
 const (
-	bktBlockInfo = "block_info"
+	bktChainPrefix    = "chain/"
+	bktBlockInfo      = "block_info"
+	bktBlockLevel     = "block_level"     // level -> hash
+	bktBlockTimestamp = "block_timestamp" // timestamp (ns) -> level
+	bktBlockOrphaned  = "block_orphaned"  // timestamp (ns) + hash -> nothing
+	bktBlockOps       = "block_operations"
+	bktBlockBalance   = "block_balance_updates_v2"
+	bktRights         = "rights" // cycle + delegate -> rights
 )
 
+var chainBuckets = []string{bktBlockInfo, bktBlockLevel, bktBlockTimestamp, bktBlockOrphaned, bktBlockOps, bktBlockBalance, bktRights}
+
+// obsoleteChainBuckets hold data computed by previous versions in a different way
+var obsoleteChainBuckets = []string{"block_balance_updates"}
+
+func orphanKey(ts time.Time, hash model.Base58) []byte {
+	k := make([]byte, 8+len(hash))
+	be.PutUint64(k, uint64(ts.UnixNano()))
+	copy(k[8:], hash)
+	return k
+}
+
+func rightsKey(cycle int64, delegate model.Base58) []byte {
+	k := make([]byte, 8+len(delegate))
+	be.PutUint64(k, uint64(cycle))
+	copy(k[8:], delegate)
+	return k
+}
+
+func chainBucketName(chainID model.Base58) []byte {
+	return []byte(bktChainPrefix + chainID.String())
+}
+
 type BoltStorage struct {
 	DB *DB
 }
 
-func (b *BoltStorage) GetBlockInfo(ctx context.Context, blockID model.Base58) (info *model.BlockInfo, err error) {
+// ChainStorage is a view of the cache namespaced by chain ID
+type ChainStorage struct {
+	DB      *DB
+	ChainID model.Base58
+}
+
+// Chain returns the chain namespace creating it if necessary
+func (b *BoltStorage) Chain(chainID model.Base58) (*ChainStorage, error) {
+	if err := b.DB.Update(func(tx *Tx) error {
+		_, err := createChainBuckets(tx, chainID)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return &ChainStorage{DB: b.DB, ChainID: chainID}, nil
+}
+
+// Stat returns statistics for all cached chains
+func (b *BoltStorage) Stat(ctx context.Context) (stat []*storage.CacheStatistics, err error) {
 	err = b.DB.View(func(tx *Tx) error {
-		var ok bool
-		i := new(model.BlockInfo)
-		ok, err = tx.Bucket([]byte(bktBlockInfo)).Get(blockID, i)
-		if !ok {
+		return tx.ForEach(func(name []byte, bkt *Bucket) error {
+			if !bytes.HasPrefix(name, []byte(bktChainPrefix)) {
+				return nil
+			}
+			var chainID model.Base58
+			if err := chainID.UnmarshalText(name[len(bktChainPrefix):]); err != nil {
+				return err
+			}
+			s, err := chainStat(bkt, chainID)
+			if err != nil {
+				return err
+			}
+			stat = append(stat, s)
 			return nil
+		})
+	})
+	return
+}
+
+func createChainBuckets(tx *Tx, chainID model.Base58) (*Bucket, error) {
+	chain, err := tx.CreateBucketIfNotExists(chainBucketName(chainID))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range chainBuckets {
+		if _, err := chain.CreateBucketIfNotExists([]byte(name)); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range obsoleteChainBuckets {
+		if err := chain.DeleteBucket([]byte(name)); err != nil && err != bolt.ErrBucketNotFound {
+			return nil, err
+		}
+	}
+	return chain, nil
+}
+
+func (c *ChainStorage) bucket(tx *Tx) *Bucket {
+	return tx.Bucket(chainBucketName(c.ChainID))
+}
+
+func getBlockInfo(chain *Bucket, blockID model.Base58) (*model.BlockInfo, error) {
+	info := new(model.BlockInfo)
+	ok, err := chain.Bucket([]byte(bktBlockInfo)).Get(blockID, info)
+	if !ok || err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (c *ChainStorage) GetBlockInfo(ctx context.Context, blockID model.Base58) (info *model.BlockInfo, err error) {
+	err = c.DB.View(func(tx *Tx) error {
+		info, err = getBlockInfo(c.bucket(tx), blockID)
+		return err
+	})
+	return
+}
+
+func putBlockInfo(chain *Bucket, info *model.BlockInfo) error {
+	if err := chain.Bucket([]byte(bktBlockInfo)).Put(info.Header.Hash, info); err != nil {
+		return err
+	}
+
+	levels := chain.Bucket([]byte(bktBlockLevel))
+	timestamps := chain.Bucket([]byte(bktBlockTimestamp))
+	orphans := chain.Bucket([]byte(bktBlockOrphaned))
+
+	var hash model.Base58
+	ok, err := levels.Get(info.Header.Level, &hash)
+	if err != nil {
+		return err
+	}
+
+	if info.Orphaned {
+		// drop from the canonical chain indexes
+		if ok && bytes.Equal(hash, info.Header.Hash) {
+			if err := levels.Delete(info.Header.Level); err != nil {
+				return err
+			}
+			if err := timestamps.Delete(info.Header.Timestamp.UnixNano()); err != nil {
+				return err
+			}
 		}
+		return orphans.Put(orphanKey(info.Header.Timestamp, info.Header.Hash), []byte{})
+	}
+	if err := orphans.Delete(orphanKey(info.Header.Timestamp, info.Header.Hash)); err != nil {
+		return err
+	}
+
+	// drop the timestamp of the block previously stored at the same level
+	if ok && !bytes.Equal(hash, info.Header.Hash) {
+		prev, err := getBlockInfo(chain, hash)
 		if err != nil {
 			return err
 		}
-		info = i
+		if prev != nil && !prev.Header.Timestamp.Equal(info.Header.Timestamp) {
+			if err := timestamps.Delete(prev.Header.Timestamp.UnixNano()); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := levels.Put(info.Header.Level, info.Header.Hash); err != nil {
+		return err
+	}
+	return timestamps.Put(info.Header.Timestamp.UnixNano(), info.Header.Level)
+}
+
+func (c *ChainStorage) UpdateBlockInfo(ctx context.Context, info *model.BlockInfo) error {
+	if !bytes.Equal(info.Header.ChainID, c.ChainID) {
+		return fmt.Errorf("block %v belongs to chain %v, expected %v", info.Header.Hash, info.Header.ChainID, c.ChainID)
+	}
+	return c.DB.Update(func(tx *Tx) error {
+		return putBlockInfo(c.bucket(tx), info)
+	})
+}
+
+func (c *ChainStorage) GetLevelBefore(ctx context.Context, ts time.Time) (level int64, ok bool, err error) {
+	err = c.DB.View(func(tx *Tx) error {
+		cur := c.bucket(tx).Bucket([]byte(bktBlockTimestamp)).Cursor()
+		var k int64
+		if ok, err = cur.Seek(ts.UnixNano(), &k, &level); err != nil {
+			return err
+		}
+		if ok {
+			ok, err = cur.Prev(&k, &level)
+		} else {
+			ok, err = cur.Last(&k, &level)
+		}
+		return err
+	})
+	return
+}
+
+func (c *ChainStorage) GetLevelAfter(ctx context.Context, ts time.Time) (level int64, ok bool, err error) {
+	err = c.DB.View(func(tx *Tx) error {
+		var k int64
+		ok, err = c.bucket(tx).Bucket([]byte(bktBlockTimestamp)).Cursor().Seek(ts.UnixNano(), &k, &level)
+		return err
+	})
+	return
+}
+
+func (c *ChainStorage) GetBlocksInfoByLevel(ctx context.Context, from, to int64) (blocks map[int64]*model.BlockInfo, err error) {
+	blocks = make(map[int64]*model.BlockInfo)
+	err = c.DB.View(func(tx *Tx) error {
+		chain := c.bucket(tx)
+		cur := chain.Bucket([]byte(bktBlockLevel)).Cursor()
+		var (
+			level int64
+			hash  model.Base58
+		)
+		ok, err := cur.Seek(from, &level, &hash)
+		for ; ok && err == nil && level <= to; ok, err = cur.Next(&level, &hash) {
+			info, err := getBlockInfo(chain, hash)
+			if err != nil {
+				return err
+			}
+			if info != nil {
+				blocks[level] = info
+			}
+		}
+		return err
+	})
+	return
+}
+
+func (c *ChainStorage) MarkOrphaned(ctx context.Context, blockID model.Base58) error {
+	return c.DB.Update(func(tx *Tx) error {
+		chain := c.bucket(tx)
+		info, err := getBlockInfo(chain, blockID)
+		if err != nil || info == nil || info.Orphaned {
+			return err
+		}
+		info.Orphaned = true
+		return putBlockInfo(chain, info)
+	})
+}
+
+func (c *ChainStorage) GetOrphanedBlocksInfo(ctx context.Context, start, end time.Time) (blocks []*model.BlockInfo, err error) {
+	err = c.DB.View(func(tx *Tx) error {
+		chain := c.bucket(tx)
+		// keys are raw so the cursor is used directly
+		cur := chain.Bucket([]byte(bktBlockOrphaned)).bucket.Cursor()
+		from := make([]byte, 8)
+		be.PutUint64(from, uint64(start.UnixNano()))
+		for k, _ := cur.Seek(from); k != nil && int64(be.Uint64(k)) < end.UnixNano(); k, _ = cur.Next() {
+			info, err := getBlockInfo(chain, model.Base58(k[8:]))
+			if err != nil {
+				return err
+			}
+			if info != nil {
+				blocks = append(blocks, info)
+			}
+		}
 		return nil
 	})
 	return
 }
 
-func (b *BoltStorage) UpdateBlockInfo(ctx context.Context, info *model.BlockInfo) error {
-	return b.DB.Update(func(tx *Tx) error {
-		return tx.Bucket([]byte(bktBlockInfo)).Put(info.Header.Hash, info)
+func (c *ChainStorage) GetOperationsInfo(ctx context.Context, blockID model.Base58) (ops []*model.OperationInfo, ok bool, err error) {
+	err = c.DB.View(func(tx *Tx) error {
+		ok, err = c.bucket(tx).Bucket([]byte(bktBlockOps)).Get(blockID, &ops)
+		return err
+	})
+	return
+}
+
+func (c *ChainStorage) UpdateOperationsInfo(ctx context.Context, blockID model.Base58, ops []*model.OperationInfo) error {
+	return c.DB.Update(func(tx *Tx) error {
+		return c.bucket(tx).Bucket([]byte(bktBlockOps)).Put(blockID, ops)
+	})
+}
+
+func (c *ChainStorage) GetBalanceUpdates(ctx context.Context, blockID model.Base58) (updates []*model.BalanceUpdateInfo, ok bool, err error) {
+	err = c.DB.View(func(tx *Tx) error {
+		ok, err = c.bucket(tx).Bucket([]byte(bktBlockBalance)).Get(blockID, &updates)
+		return err
+	})
+	return
+}
+
+func (c *ChainStorage) UpdateBalanceUpdates(ctx context.Context, blockID model.Base58, updates []*model.BalanceUpdateInfo) error {
+	return c.DB.Update(func(tx *Tx) error {
+		return c.bucket(tx).Bucket([]byte(bktBlockBalance)).Put(blockID, updates)
+	})
+}
+
+func (c *ChainStorage) GetDelegateRights(ctx context.Context, cycle int64, delegate model.Base58) (r *model.DelegateRights, ok bool, err error) {
+	err = c.DB.View(func(tx *Tx) error {
+		ok, err = c.bucket(tx).Bucket([]byte(bktRights)).Get(rightsKey(cycle, delegate), &r)
+		return err
+	})
+	return
+}
+
+func (c *ChainStorage) UpdateDelegateRights(ctx context.Context, cycle int64, delegate model.Base58, r *model.DelegateRights) error {
+	return c.DB.Update(func(tx *Tx) error {
+		return c.bucket(tx).Bucket([]byte(bktRights)).Put(rightsKey(cycle, delegate), r)
+	})
+}
+
+func chainStat(chain *Bucket, chainID model.Base58) (*storage.CacheStatistics, error) {
+	stat := storage.CacheStatistics{
+		ChainID:  chainID,
+		Blocks:   int64(chain.Bucket([]byte(bktBlockInfo)).Stats().KeyN),
+		Orphaned: int64(chain.Bucket([]byte(bktBlockOrphaned)).Stats().KeyN),
+		Rights:   int64(chain.Bucket([]byte(bktRights)).Stats().KeyN),
+	}
+	var (
+		hash model.Base58
+		ts   int64
+	)
+	levels := chain.Bucket([]byte(bktBlockLevel)).Cursor()
+	if _, err := levels.First(&stat.LowestLevel, &hash); err != nil {
+		return nil, err
+	}
+	if _, err := levels.Last(&stat.HighestLevel, &hash); err != nil {
+		return nil, err
+	}
+	timestamps := chain.Bucket([]byte(bktBlockTimestamp)).Cursor()
+	var level int64
+	if ok, err := timestamps.First(&ts, &level); err != nil {
+		return nil, err
+	} else if ok {
+		stat.Earliest = time.Unix(0, ts).UTC()
+	}
+	if ok, err := timestamps.Last(&ts, &level); err != nil {
+		return nil, err
+	} else if ok {
+		stat.Latest = time.Unix(0, ts).UTC()
+	}
+	return &stat, nil
+}
+
+// Stat returns the chain cache statistics
+func (c *ChainStorage) Stat(ctx context.Context) (stat *storage.CacheStatistics, err error) {
+	err = c.DB.View(func(tx *Tx) error {
+		stat, err = chainStat(c.bucket(tx), c.ChainID)
+		return err
+	})
+	return
+}
+
+// Purge drops all cached data of the chain
+func (c *ChainStorage) Purge(ctx context.Context) error {
+	return c.DB.Update(func(tx *Tx) error {
+		if err := tx.DeleteBucket(chainBucketName(c.ChainID)); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+		_, err := createChainBuckets(tx, c.ChainID)
+		return err
 	})
 }
 
+// migrate moves blocks cached by the previous versions into their chain namespaces
+func migrate(tx *Tx) error {
+	legacy := tx.Tx.Bucket([]byte(bktBlockInfo))
+	if legacy == nil {
+		return nil
+	}
+	chains := make(map[string]*Bucket)
+	if err := tx.Bucket([]byte(bktBlockInfo)).ForEach(func(_ model.Base58, info model.BlockInfo) error {
+		id := info.Header.ChainID.String()
+		chain, ok := chains[id]
+		if !ok {
+			var err error
+			if chain, err = createChainBuckets(tx, info.Header.ChainID); err != nil {
+				return err
+			}
+			chains[id] = chain
+		}
+		return putBlockInfo(chain, &info)
+	}); err != nil {
+		return err
+	}
+	for _, name := range chainBuckets {
+		if err := tx.DeleteBucket([]byte(name)); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
 const defaultDBFile = ".tezos-grafana-datasource/block_cache.db"
 
 func NewBoltStorage(path string) (*BoltStorage, error) {
@@ -53,15 +408,9 @@ func NewBoltStorage(path string) (*BoltStorage, error) {
 	if err != nil {
 		return nil, err
 	}
-
-	// create buckets
-	if err := db.Update(func(tx *Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte(bktBlockInfo))
-		return err
-	}); err != nil {
+	if err := db.Update(migrate); err != nil {
 		return nil, err
 	}
-
 	return &BoltStorage{db}, nil
 }
 
@@ -69,4 +418,4 @@ func (b *BoltStorage) Close() error {
 	return b.DB.Close()
 }
 
-var _ storage.BlockInfoStorage = (*BoltStorage)(nil)
+var _ storage.Storage = (*ChainStorage)(nil)
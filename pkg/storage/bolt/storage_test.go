@@ -0,0 +1,203 @@
+package bolt
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ecadlabs/tezos-grafana-datasource/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testChainID = model.Base58{0x7a, 0x06, 0xa7, 0x70}
+
+func newTestBlockInfo(level int64, hash byte, ts time.Time) *model.BlockInfo {
+	return &model.BlockInfo{
+		Header: &model.BlockHeader{
+			ChainID: testChainID,
+			Hash:    model.Base58{hash},
+			RawBlockHeader: model.RawBlockHeader{
+				Level:       level,
+				Predecessor: model.Base58{hash - 1},
+				Timestamp:   ts,
+			},
+		},
+		Stat: &model.BlockStatistics{Ops: &model.NumOps{}},
+	}
+}
+
+func TestBlockIndex(t *testing.T) {
+	db, err := NewBoltStorage(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	s, err := db.Chain(testChainID)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	t0 := time.Unix(1633000000, 0).UTC()
+	for l := int64(10); l < 20; l++ {
+		require.NoError(t, s.UpdateBlockInfo(ctx, newTestBlockInfo(l, byte(l), t0.Add(time.Duration(l)*time.Minute))))
+	}
+
+	level, ok, err := s.GetLevelBefore(ctx, t0.Add(15*time.Minute))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(14), level)
+
+	level, ok, err = s.GetLevelAfter(ctx, t0.Add(15*time.Minute))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(15), level)
+
+	level, ok, err = s.GetLevelBefore(ctx, t0.Add(time.Hour))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(19), level)
+
+	_, ok, err = s.GetLevelBefore(ctx, t0)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, ok, err = s.GetLevelAfter(ctx, t0.Add(time.Hour))
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// replace a block at the same level
+	require.NoError(t, s.UpdateBlockInfo(ctx, newTestBlockInfo(15, 100, t0.Add(15*time.Minute+30*time.Second))))
+	level, ok, err = s.GetLevelAfter(ctx, t0.Add(15*time.Minute))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(15), level)
+
+	blocks, err := s.GetBlocksInfoByLevel(ctx, 14, 16)
+	require.NoError(t, err)
+	require.Len(t, blocks, 3)
+	assert.Equal(t, model.Base58{14}, blocks[14].Header.Hash)
+	assert.Equal(t, model.Base58{100}, blocks[15].Header.Hash)
+	assert.Equal(t, model.Base58{16}, blocks[16].Header.Hash)
+}
+
+func TestChainIsolation(t *testing.T) {
+	db, err := NewBoltStorage(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	s0, err := db.Chain(testChainID)
+	require.NoError(t, err)
+	otherChainID := model.Base58{0xbd, 0xb5, 0x7e, 0x3f}
+	s1, err := db.Chain(otherChainID)
+	require.NoError(t, err)
+
+	info := newTestBlockInfo(10, 10, time.Unix(1633000000, 0).UTC())
+	require.NoError(t, s0.UpdateBlockInfo(ctx, info))
+	assert.Error(t, s1.UpdateBlockInfo(ctx, info))
+
+	i, err := s1.GetBlockInfo(ctx, info.Header.Hash)
+	require.NoError(t, err)
+	assert.Nil(t, i)
+
+	stat, err := db.Stat(ctx)
+	require.NoError(t, err)
+	require.Len(t, stat, 2)
+
+	st, err := s0.Stat(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), st.Blocks)
+	assert.Equal(t, int64(10), st.LowestLevel)
+	assert.Equal(t, int64(10), st.HighestLevel)
+	assert.Equal(t, info.Header.Timestamp, st.Latest)
+
+	require.NoError(t, s0.Purge(ctx))
+	i, err = s0.GetBlockInfo(ctx, info.Header.Hash)
+	require.NoError(t, err)
+	assert.Nil(t, i)
+	st, err = s0.Stat(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), st.Blocks)
+}
+
+func TestDelegateRights(t *testing.T) {
+	db, err := NewBoltStorage(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	s, err := db.Chain(testChainID)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	delegate := model.Base58{6, 161, 159, 1}
+	rights := &model.DelegateRights{
+		Baking:    []*model.BakingRight{{Level: 4097, Delegate: delegate, Priority: 2, EstimatedTime: time.Unix(1633000000, 0).UTC()}},
+		Endorsing: []*model.EndorsingRight{{Level: 4098, Delegate: delegate, Slots: []uint64{3, 7}}},
+	}
+	require.NoError(t, s.UpdateDelegateRights(ctx, 1, delegate, rights))
+
+	r, ok, err := s.GetDelegateRights(ctx, 1, delegate)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, rights, r)
+
+	_, ok, err = s.GetDelegateRights(ctx, 2, delegate)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	st, err := s.Stat(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), st.Rights)
+}
+
+func TestBalanceUpdates(t *testing.T) {
+	db, err := NewBoltStorage(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	s, err := db.Chain(testChainID)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	updates := []*model.BalanceUpdateInfo{
+		{Delegate: model.Base58{6, 161, 159, 1}, Category: model.BalanceRewards, Cycle: 12, Change: 16093750, Count: 1},
+		{Delegate: model.Base58{6, 161, 159, 2}, Category: model.BalanceDeposits, Cycle: 12, Change: -640000000, Count: 2},
+	}
+	require.NoError(t, s.UpdateBalanceUpdates(ctx, model.Base58{1}, updates))
+	require.NoError(t, s.UpdateBalanceUpdates(ctx, model.Base58{2}, []*model.BalanceUpdateInfo{}))
+
+	u, ok, err := s.GetBalanceUpdates(ctx, model.Base58{1})
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, updates, u)
+
+	// blocks without updates are cached as well
+	u, ok, err = s.GetBalanceUpdates(ctx, model.Base58{2})
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Empty(t, u)
+
+	_, ok, err = s.GetBalanceUpdates(ctx, model.Base58{3})
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestBlockMetadata(t *testing.T) {
+	db, err := NewBoltStorage(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	s, err := db.Chain(testChainID)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	delegate := model.Base58{6, 161, 159, 1}
+	info := newTestBlockInfo(1, 1, time.Unix(1633000000, 0).UTC())
+	info.Metadata = &model.BlockMetadataInfo{
+		Baker:       delegate,
+		LevelInfo:   &model.LevelInfo{Level: 1, Cycle: 0, CyclePosition: 1},
+		ConsumedGas: 1000,
+	}
+	require.NoError(t, s.UpdateBlockInfo(ctx, info))
+
+	res, err := s.GetBlockInfo(ctx, info.Header.Hash)
+	require.NoError(t, err)
+	require.NotNil(t, res)
+	assert.Equal(t, info.Metadata, res.Metadata)
+}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"time"
 
 	"github.com/ecadlabs/tezos-grafana-datasource/pkg/model"
 )
@@ -9,4 +10,47 @@ import (
 type BlockInfoStorage interface {
 	GetBlockInfo(ctx context.Context, blockID model.Base58) (s *model.BlockInfo, err error)
 	UpdateBlockInfo(ctx context.Context, s *model.BlockInfo) error
+	// GetLevelBefore returns the highest cached level with a timestamp before ts
+	GetLevelBefore(ctx context.Context, ts time.Time) (level int64, ok bool, err error)
+	// GetLevelAfter returns the lowest cached level with a timestamp not before ts
+	GetLevelAfter(ctx context.Context, ts time.Time) (level int64, ok bool, err error)
+	// GetBlocksInfoByLevel returns cached blocks within [from, to] levels range keyed by level
+	GetBlocksInfoByLevel(ctx context.Context, from, to int64) (map[int64]*model.BlockInfo, error)
+	// MarkOrphaned flags the block as not belonging to the canonical chain and removes it from the indexes
+	MarkOrphaned(ctx context.Context, blockID model.Base58) error
+	// GetOrphanedBlocksInfo returns orphaned blocks within [start, end) time range ordered by timestamp
+	GetOrphanedBlocksInfo(ctx context.Context, start, end time.Time) ([]*model.BlockInfo, error)
+}
+
+type OperationsInfoStorage interface {
+	GetOperationsInfo(ctx context.Context, blockID model.Base58) (ops []*model.OperationInfo, ok bool, err error)
+	UpdateOperationsInfo(ctx context.Context, blockID model.Base58, ops []*model.OperationInfo) error
+}
+
+type BalanceUpdatesStorage interface {
+	GetBalanceUpdates(ctx context.Context, blockID model.Base58) (updates []*model.BalanceUpdateInfo, ok bool, err error)
+	UpdateBalanceUpdates(ctx context.Context, blockID model.Base58, updates []*model.BalanceUpdateInfo) error
+}
+
+type RightsStorage interface {
+	GetDelegateRights(ctx context.Context, cycle int64, delegate model.Base58) (r *model.DelegateRights, ok bool, err error)
+	UpdateDelegateRights(ctx context.Context, cycle int64, delegate model.Base58, r *model.DelegateRights) error
+}
+
+type Storage interface {
+	BlockInfoStorage
+	OperationsInfoStorage
+	BalanceUpdatesStorage
+	RightsStorage
+}
+
+type CacheStatistics struct {
+	ChainID      model.Base58 `json:"chain_id"`
+	Blocks       int64        `json:"blocks"`
+	Orphaned     int64        `json:"orphaned"`
+	Rights       int64        `json:"rights"`
+	LowestLevel  int64        `json:"lowest_level"`
+	HighestLevel int64        `json:"highest_level"`
+	Earliest     time.Time    `json:"earliest"`
+	Latest       time.Time    `json:"latest"`
 }
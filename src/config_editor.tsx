@@ -1,26 +1,124 @@
 import React, { ChangeEvent, PureComponent } from 'react';
-import { InlineField, Input, Legend } from '@grafana/ui';
+import {
+  Button,
+  DataSourceHttpSettings,
+  InlineField,
+  InlineSwitch,
+  Input,
+  Legend,
+  SecretInput,
+  TextArea,
+} from '@grafana/ui';
 import { DataSourcePluginOptionsEditorProps } from '@grafana/data';
-import { DataSourceOptions } from './types';
+import { getBackendSrv } from '@grafana/runtime';
+import { DataSourceOptions, SecureDataSourceOptions } from './types';
+
+export class ConfigEditor extends PureComponent<
+  DataSourcePluginOptionsEditorProps<DataSourceOptions, SecureDataSourceOptions>
+> {
+  private onPurgeCache = async () => {
+    const { options } = this.props;
+    await getBackendSrv().post(`/api/datasources/${options.id}/resources/cache/purge`);
+  };
+
+  private onResetBearerToken = () => {
+    const { options, onOptionsChange } = this.props;
+    onOptionsChange({
+      ...options,
+      secureJsonFields: { ...options.secureJsonFields, bearerToken: false },
+      secureJsonData: { ...options.secureJsonData, bearerToken: '' },
+    });
+  };
 
-export class ConfigEditor extends PureComponent<DataSourcePluginOptionsEditorProps<DataSourceOptions>> {
   render() {
     const { options, onOptionsChange } = this.props;
-    const { jsonData } = options;
-    const isValidUrl = (u: string) =>
-      /^(ftp|http|https):\/\/(\w+:{0,1}\w*@)?(\S+)(:[0-9]+)?(\/|\/([\w#!:.?+=&%@!\-\/]))?$/.test(u);
+    const { jsonData, secureJsonFields, secureJsonData } = options;
 
     return (
       <div className="gf-form-group">
+        <DataSourceHttpSettings
+          defaultUrl="http://localhost:8732"
+          dataSourceConfig={options}
+          onChange={onOptionsChange}
+          showAccessOptions={false}
+        />
         <Legend>RPC</Legend>
         <div className="gf-form">
-          <InlineField required invalid={!isValidUrl(options.url)} label="URL" labelWidth={15}>
+          <InlineField label="Bearer token" labelWidth={15} tooltip="Sent in the Authorization header">
+            <SecretInput
+              width={40}
+              isConfigured={(secureJsonFields && secureJsonFields.bearerToken) as boolean}
+              value={secureJsonData?.bearerToken || ''}
+              onReset={this.onResetBearerToken}
+              onChange={(event: ChangeEvent<HTMLInputElement>) =>
+                onOptionsChange({
+                  ...options,
+                  secureJsonData: { ...secureJsonData, bearerToken: event.currentTarget.value },
+                })
+              }
+            />
+          </InlineField>
+        </div>
+        <div className="gf-form">
+          <InlineField
+            label="Fallback URLs"
+            labelWidth={15}
+            tooltip="Additional nodes, one URL per line. Requests are routed to the most up to date healthy node"
+          >
+            <TextArea
+              cols={40}
+              rows={3}
+              value={(jsonData.endpoints || []).join('\n')}
+              onChange={(event: ChangeEvent<HTMLTextAreaElement>) =>
+                onOptionsChange({
+                  ...options,
+                  jsonData: {
+                    ...jsonData,
+                    endpoints: event.currentTarget.value
+                      .split('\n')
+                      .map((u) => u.trim())
+                      .filter((u) => u !== ''),
+                  },
+                })
+              }
+            />
+          </InlineField>
+        </div>
+        <div className="gf-form">
+          <InlineField
+            label="Max head lag"
+            labelWidth={15}
+            tooltip="Number of levels a node may lag behind the most up to date one before requests are routed elsewhere"
+          >
+            <Input
+              width={40}
+              type="number"
+              min={0}
+              placeholder="2"
+              value={jsonData.maxHeadLag ?? ''}
+              onChange={(event: ChangeEvent<HTMLInputElement>) => {
+                const v = parseInt(event.currentTarget.value, 10);
+                onOptionsChange({ ...options, jsonData: { ...jsonData, maxHeadLag: isNaN(v) ? undefined : v } });
+              }}
+            />
+          </InlineField>
+        </div>
+        <div className="gf-form">
+          <InlineField
+            label="Explorer URL"
+            labelWidth={15}
+            tooltip="Block explorer base URL. Block and operation hashes and addresses link to the explorer"
+          >
             <Input
               width={40}
               type="text"
-              value={options.url}
+              placeholder="https://tzkt.io"
+              value={jsonData.explorerURL || ''}
               onChange={(event: ChangeEvent<HTMLInputElement>) =>
-                onOptionsChange({ ...options, url: event.currentTarget.value })
+                onOptionsChange({
+                  ...options,
+                  jsonData: { ...jsonData, explorerURL: event.currentTarget.value.trim() || undefined },
+                })
               }
             />
           </InlineField>
@@ -37,6 +135,82 @@ export class ConfigEditor extends PureComponent<DataSourcePluginOptionsEditorPro
             />
           </InlineField>
         </div>
+        <div className="gf-form">
+          <InlineField
+            label="Max retries"
+            labelWidth={15}
+            tooltip="Number of retries of RPC requests failed due to network errors or temporary unavailability of the node"
+          >
+            <Input
+              width={40}
+              type="number"
+              min={0}
+              placeholder="3"
+              value={jsonData.maxRetries ?? ''}
+              onChange={(event: ChangeEvent<HTMLInputElement>) => {
+                const v = parseInt(event.currentTarget.value, 10);
+                onOptionsChange({ ...options, jsonData: { ...jsonData, maxRetries: isNaN(v) ? undefined : v } });
+              }}
+            />
+          </InlineField>
+        </div>
+        <div className="gf-form">
+          <InlineField
+            label="Lenient decoding"
+            labelWidth={15}
+            tooltip="Accept fields unknown to the plugin instead of failing. Unknown fields are reported by the health check and the Diagnostics query"
+          >
+            <InlineSwitch
+              checked={jsonData.lenientDecoding || false}
+              onChange={(event: ChangeEvent<HTMLInputElement>) =>
+                onOptionsChange({ ...options, jsonData: { ...jsonData, lenientDecoding: event.currentTarget.checked } })
+              }
+            />
+          </InlineField>
+        </div>
+        <Legend>Cache</Legend>
+        <div className="gf-form">
+          <InlineField
+            label="Index depth"
+            labelWidth={15}
+            tooltip="Number of blocks below the head to keep indexed in background. Zero disables the indexer"
+          >
+            <Input
+              width={40}
+              type="number"
+              min={0}
+              value={jsonData.indexDepth || 0}
+              onChange={(event: ChangeEvent<HTMLInputElement>) =>
+                onOptionsChange({
+                  ...options,
+                  jsonData: { ...jsonData, indexDepth: parseInt(event.currentTarget.value, 10) || 0 },
+                })
+              }
+            />
+          </InlineField>
+        </div>
+        <div className="gf-form">
+          <InlineField label="Parallel fetches" labelWidth={15} tooltip="Maximum number of blocks fetched concurrently">
+            <Input
+              width={40}
+              type="number"
+              min={1}
+              placeholder="8"
+              value={jsonData.fetchParallelism || ''}
+              onChange={(event: ChangeEvent<HTMLInputElement>) =>
+                onOptionsChange({
+                  ...options,
+                  jsonData: { ...jsonData, fetchParallelism: parseInt(event.currentTarget.value, 10) || undefined },
+                })
+              }
+            />
+          </InlineField>
+        </div>
+        <div className="gf-form">
+          <Button variant="destructive" disabled={!options.id} onClick={this.onPurgeCache}>
+            Purge chain cache
+          </Button>
+        </div>
       </div>
     );
   }
@@ -1,12 +1,201 @@
-import React, { PureComponent, ChangeEvent } from 'react';
-import { AsyncMultiSelect, InlineField, InlineSwitch, Input } from '@grafana/ui';
+import React, { PureComponent, ChangeEvent, FocusEvent } from 'react';
+import { AsyncMultiSelect, InlineField, InlineSwitch, Input, MultiSelect, Select } from '@grafana/ui';
 import { QueryEditorProps, SelectableValue } from '@grafana/data';
 import { DataSource } from './datasource';
-import { DataSourceOptions, Query } from './types';
+import { Aggregation, DataSourceOptions, FieldTypeHint, GroupBy, Query, QueryType } from './types';
 
 type Props = QueryEditorProps<DataSource, Query, DataSourceOptions>;
 
+const queryTypes: Array<SelectableValue<QueryType>> = [
+  { label: 'Blocks', value: 'block_info' },
+  { label: 'Operations', value: 'operations' },
+  { label: 'Baker performance', value: 'baker_performance' },
+  { label: 'Balance updates', value: 'balance_updates' },
+  { label: 'Upcoming rights', value: 'upcoming_rights' },
+  { label: 'Mempool', value: 'mempool' },
+  { label: 'Mempool operations', value: 'mempool_operations' },
+  { label: 'Diagnostics', value: 'diagnostics' },
+];
+
+const groupByOptions: Array<SelectableValue<GroupBy>> = [
+  { label: 'None', value: '' },
+  { label: 'Cycle', value: 'cycle' },
+  { label: 'Voting period', value: 'voting_period' },
+  { label: 'Levels', value: 'levels' },
+];
+
+const defaultBucketFields = [
+  'start_time',
+  'index',
+  'delay_avg',
+  'delay_p95',
+  'n_ops_total',
+  'missed_priorities',
+  'endorsement_coverage',
+];
+
+const defaultFields: { [k: string]: string[] } = {
+  block_info: ['header.timestamp'],
+  operations: ['block.header.timestamp', 'operation.kind', 'operation.hash'],
+  baker_performance: [
+    'block.header.timestamp',
+    'baker.baked',
+    'baker.missed_blocks',
+    'baker.expected_slots',
+    'baker.endorsed_slots',
+  ],
+  balance_updates: ['block.header.timestamp', 'update.change', 'update.cycle'],
+  upcoming_rights: ['estimated_time', 'delegate', 'kind', 'level', 'priority', 'slots', 'time_until'],
+  mempool: ['timestamp', 'total', 'applied', 'branch_delayed', 'latency_avg'],
+  mempool_operations: ['first_seen', 'class', 'kind', 'hash', 'source', 'fee'],
+};
+
+const fieldsQueryTypes: { [k: string]: QueryType } = {
+  block_info: 'block_info_fields',
+  operations: 'operation_fields',
+  baker_performance: 'baker_performance_fields',
+  balance_updates: 'balance_update_fields',
+  upcoming_rights: 'upcoming_rights_fields',
+  mempool: 'mempool_fields',
+  mempool_operations: 'mempool_operation_fields',
+};
+
+const operationKinds = [
+  'endorsement',
+  'endorsement_with_slot',
+  'preendorsement',
+  'seed_nonce_revelation',
+  'double_endorsement_evidence',
+  'double_baking_evidence',
+  'double_preendorsement_evidence',
+  'activate_account',
+  'proposals',
+  'ballot',
+  'reveal',
+  'transaction',
+  'origination',
+  'delegation',
+  'register_global_constant',
+  'set_deposits_limit',
+  'failing_noop',
+].map<SelectableValue<string>>((v) => ({ label: v, value: v }));
+
+// splitTopLevel splits the list by commas outside of parentheses, brackets and braces
+const splitTopLevel = (s: string): string[] => {
+  const res: string[] = [];
+  let depth = 0;
+  let start = 0;
+  for (let i = 0; i < s.length; i++) {
+    const c = s[i];
+    if (c === '(' || c === '[' || c === '{') {
+      depth++;
+    } else if (c === ')' || c === ']' || c === '}') {
+      depth--;
+    } else if (c === ',' && depth === 0) {
+      res.push(s.slice(start, i));
+      start = i + 1;
+    }
+  }
+  res.push(s.slice(start));
+  return res.map((v) => v.trim()).filter((v) => v !== '');
+};
+
+// parseAggregations parses a list like `count(), avg(block.delay) as delay`
+const parseAggregations = (s: string): Aggregation[] =>
+  splitTopLevel(s).map<Aggregation>((v) => {
+    const m = v.match(/^(\w+)\((.*)\)(?:\s+as\s+(\w+))?$/);
+    if (!m) {
+      return { func: v };
+    }
+    return { func: m[1], expr: m[2].trim() || undefined, alias: m[3] };
+  });
+
+const formatAggregations = (aggs: Aggregation[]): string =>
+  aggs.map((a) => `${a.func}(${a.expr || ''})${a.alias ? ` as ${a.alias}` : ''}`).join(', ');
+
+// parseFieldTypes parses a list like `timestamp: time, nonce: string?`, the question mark makes the field nullable
+const parseFieldTypes = (s: string): Record<string, FieldTypeHint> | undefined => {
+  const res: Record<string, FieldTypeHint> = {};
+  let n = 0;
+  for (const v of splitTopLevel(s)) {
+    const m = v.match(/^(.+):\s*(\w+)(\?)?$/);
+    if (m) {
+      res[m[1].trim()] = { type: m[2] as FieldTypeHint['type'], nullable: m[3] ? true : undefined };
+      n++;
+    }
+  }
+  return n !== 0 ? res : undefined;
+};
+
+const formatFieldTypes = (types: Record<string, FieldTypeHint>): string =>
+  Object.entries(types)
+    .map(([name, t]) => `${name}: ${t.type}${t.nullable ? '?' : ''}`)
+    .join(', ');
+
 export class QueryEditor extends PureComponent<Props> {
+  private queryType = (): QueryType => this.props.query.queryType || 'block_info';
+
+  private onQueryTypeChange = (value: SelectableValue<QueryType>) => {
+    const { onChange, query, onRunQuery } = this.props;
+    const queryType = value.value || 'block_info';
+    onChange({ ...query, queryType, fields: defaultFields[queryType] });
+    onRunQuery();
+  };
+
+  private onGroupByChange = (value: SelectableValue<GroupBy>) => {
+    const { onChange, query, onRunQuery } = this.props;
+    const groupBy = value.value || '';
+    const fields = groupBy ? defaultBucketFields : defaultFields.block_info;
+    onChange({ ...query, groupBy, fields, streaming: groupBy ? false : query.streaming });
+    onRunQuery();
+  };
+
+  private onBucketSizeChange = (event: FocusEvent<HTMLInputElement>) => {
+    const { onChange, query, onRunQuery } = this.props;
+    const bucketSize = parseInt(event.currentTarget.value, 10);
+    onChange({ ...query, bucketSize: isNaN(bucketSize) ? undefined : bucketSize });
+    onRunQuery();
+  };
+
+  private onFilterChange = (event: FocusEvent<HTMLInputElement>) => {
+    const { onChange, query, onRunQuery } = this.props;
+    onChange({ ...query, filter: event.currentTarget.value.trim() || undefined });
+    onRunQuery();
+  };
+
+  private onGroupKeysChange = (event: FocusEvent<HTMLInputElement>) => {
+    const { onChange, query, onRunQuery } = this.props;
+    onChange({ ...query, groupKeys: splitTopLevel(event.currentTarget.value) });
+    onRunQuery();
+  };
+
+  private onAggregationsChange = (event: FocusEvent<HTMLInputElement>) => {
+    const { onChange, query, onRunQuery } = this.props;
+    onChange({ ...query, aggregations: parseAggregations(event.currentTarget.value) });
+    onRunQuery();
+  };
+
+  private onFieldTypesChange = (event: FocusEvent<HTMLInputElement>) => {
+    const { onChange, query, onRunQuery } = this.props;
+    onChange({ ...query, fieldTypes: parseFieldTypes(event.currentTarget.value) });
+    onRunQuery();
+  };
+
+  private onOperationKindsChange = (values: Array<SelectableValue<string>>) => {
+    const { onChange, query } = this.props;
+    onChange({ ...query, operationKinds: values.map<string>((v) => v.value || '') });
+  };
+
+  private onDelegatesChange = (event: FocusEvent<HTMLInputElement>) => {
+    const { onChange, query, onRunQuery } = this.props;
+    const delegates = event.currentTarget.value
+      .split(',')
+      .map((v) => v.trim())
+      .filter((v) => v !== '');
+    onChange({ ...query, delegates });
+    onRunQuery();
+  };
+
   private onFieldsChange = (values: Array<SelectableValue<string>>) => {
     const { onChange, query } = this.props;
     onChange({ ...query, fields: values.map<string>((v) => v.value || '') });
@@ -28,32 +217,81 @@ export class QueryEditor extends PureComponent<Props> {
     onChange({ ...query, useExpr: event.currentTarget.checked });
   };
 
+  private onShowOrphanedChange = (event: ChangeEvent<HTMLInputElement>) => {
+    const { onChange, query, onRunQuery } = this.props;
+    onChange({ ...query, showOrphaned: event.currentTarget.checked });
+    onRunQuery();
+  };
+
   private loadOptions = async (): Promise<Array<SelectableValue<string>>> => {
-    const { datasource } = this.props;
-    const res = await datasource.getFieldsQuery('block_info_fields');
+    const { datasource, query } = this.props;
+    const queryType = this.queryType();
+    const res = await datasource.getFieldsQuery(
+      queryType === 'block_info' && query.groupBy ? 'block_bucket_fields' : fieldsQueryTypes[queryType]
+    );
     return res.map<SelectableValue<string>>((v) => ({ label: `${v.selector}: ${v.type}`, value: v.selector }));
   };
 
   render() {
     const { query } = this.props;
+    const queryType = this.queryType();
     if (query.fields === undefined) {
-      query.fields = ['header.timestamp'];
+      query.fields = defaultFields[queryType] || [];
     }
 
     const fieldsVal = (v: string[]) => v.map<SelectableValue<string>>((v) => ({ label: v, value: v }));
 
     return (
       <div className="gf-form">
-        <InlineField label="Extended">
-          <InlineSwitch checked={query.useExpr || false} onChange={this.onUseExprChange} />
+        <InlineField label="Query">
+          <Select
+            width={16}
+            menuShouldPortal
+            options={queryTypes}
+            value={queryType}
+            onChange={this.onQueryTypeChange}
+          />
         </InlineField>
-        {query.useExpr ? (
+        {(queryType === 'operations' || queryType === 'mempool_operations') && (
+          <InlineField label="Kinds">
+            <MultiSelect
+              menuShouldPortal
+              options={operationKinds}
+              value={fieldsVal(query.operationKinds || [])}
+              onChange={this.onOperationKindsChange}
+            />
+          </InlineField>
+        )}
+        {(queryType === 'baker_performance' || queryType === 'balance_updates' || queryType === 'upcoming_rights') && (
+          <InlineField
+            label="Delegates"
+            tooltip={
+              queryType === 'upcoming_rights'
+                ? 'Comma separated list of delegate addresses'
+                : 'Comma separated list of delegate addresses, all delegates if empty'
+            }
+          >
+            <Input
+              width={40}
+              defaultValue={(query.delegates || []).join(', ')}
+              type="text"
+              onBlur={this.onDelegatesChange}
+            ></Input>
+          </InlineField>
+        )}
+        {fieldsQueryTypes[queryType] && (
+          <InlineField label="Extended">
+            <InlineSwitch checked={query.useExpr || false} onChange={this.onUseExprChange} />
+          </InlineField>
+        )}
+        {!fieldsQueryTypes[queryType] ? null : query.useExpr ? (
           <InlineField label="Expression" grow>
             <Input value={query.expr} type="text" onChange={this.onExprChange}></Input>
           </InlineField>
         ) : (
           <InlineField label="Select fields" grow>
             <AsyncMultiSelect
+              key={queryType + (query.groupBy || '')}
               menuShouldPortal
               defaultOptions
               loadOptions={this.loadOptions}
@@ -62,9 +300,74 @@ export class QueryEditor extends PureComponent<Props> {
             ></AsyncMultiSelect>
           </InlineField>
         )}
-        <InlineField label="Enable streaming">
-          <InlineSwitch checked={query.streaming || false} onChange={this.onWithStreamingChange} />
-        </InlineField>
+        {fieldsQueryTypes[queryType] && (
+          <>
+            <InlineField label="Filter" tooltip="CUE predicate, e.g. block.round > 0">
+              <Input width={30} defaultValue={query.filter} type="text" onBlur={this.onFilterChange}></Input>
+            </InlineField>
+            <InlineField label="Group keys" tooltip="Comma separated list of CUE expressions to group the rows by">
+              <Input
+                width={30}
+                defaultValue={(query.groupKeys || []).join(', ')}
+                type="text"
+                onBlur={this.onGroupKeysChange}
+              ></Input>
+            </InlineField>
+            <InlineField
+              label="Aggregate"
+              tooltip="Comma separated list of count, sum, avg, min, max or pNN percentiles, e.g. count(), p95(block.delay) as delay"
+            >
+              <Input
+                width={30}
+                defaultValue={formatAggregations(query.aggregations || [])}
+                type="text"
+                onBlur={this.onAggregationsChange}
+              ></Input>
+            </InlineField>
+            <InlineField
+              label="Field types"
+              tooltip="Comma separated list of time, string, int, float, bool or json column types, ? makes the column nullable, e.g. timestamp: time, nonce: string?"
+            >
+              <Input
+                width={30}
+                defaultValue={formatFieldTypes(query.fieldTypes || {})}
+                type="text"
+                onBlur={this.onFieldTypesChange}
+              ></Input>
+            </InlineField>
+          </>
+        )}
+        {queryType === 'mempool' && (
+          <InlineField label="Enable streaming">
+            <InlineSwitch checked={query.streaming || false} onChange={this.onWithStreamingChange} />
+          </InlineField>
+        )}
+        {queryType === 'block_info' && (
+          <InlineField label="Group by" tooltip="Aggregate blocks by cycle, voting period or a fixed number of levels">
+            <Select
+              width={16}
+              menuShouldPortal
+              options={groupByOptions}
+              value={query.groupBy || ''}
+              onChange={this.onGroupByChange}
+            />
+          </InlineField>
+        )}
+        {queryType === 'block_info' && query.groupBy === 'levels' && (
+          <InlineField label="Bucket size" tooltip="Number of levels per bucket">
+            <Input width={12} defaultValue={query.bucketSize} type="number" onBlur={this.onBucketSizeChange}></Input>
+          </InlineField>
+        )}
+        {queryType === 'block_info' && !query.groupBy && (
+          <>
+            <InlineField label="Enable streaming">
+              <InlineSwitch checked={query.streaming || false} onChange={this.onWithStreamingChange} />
+            </InlineField>
+            <InlineField label="Show orphaned" tooltip="Include blocks which were replaced by a competing branch">
+              <InlineSwitch checked={query.showOrphaned || false} onChange={this.onShowOrphanedChange} />
+            </InlineField>
+          </>
+        )}
       </div>
     );
   }
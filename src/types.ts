@@ -6,10 +6,43 @@ export interface Query extends DataQuery {
   fields?: string[];
   expr?: string;
   useExpr?: boolean;
+  showOrphaned?: boolean;
+  operationKinds?: string[];
+  delegates?: string[];
+  groupBy?: GroupBy;
+  bucketSize?: number;
+  filter?: string;
+  groupKeys?: string[];
+  aggregations?: Aggregation[];
+  fieldTypes?: Record<string, FieldTypeHint>;
 }
 
+export interface FieldTypeHint {
+  type: 'time' | 'string' | 'int' | 'float' | 'bool' | 'json';
+  nullable?: boolean;
+}
+
+export interface Aggregation {
+  func: string;
+  expr?: string;
+  alias?: string;
+}
+
+export type GroupBy = '' | 'cycle' | 'voting_period' | 'levels';
+
 export interface DataSourceOptions extends DataSourceJsonData {
   chain?: string;
+  indexDepth?: number;
+  fetchParallelism?: number;
+  lenientDecoding?: boolean;
+  maxRetries?: number;
+  endpoints?: string[];
+  maxHeadLag?: number;
+  explorerURL?: string;
+}
+
+export interface SecureDataSourceOptions {
+  bearerToken?: string;
 }
 
 export interface FieldType {
@@ -17,4 +50,20 @@ export interface FieldType {
   type: string;
 }
 
-export type QueryType = 'block_info' | 'block_info_fields';
+export type QueryType =
+  | 'block_info'
+  | 'block_info_fields'
+  | 'block_bucket_fields'
+  | 'operations'
+  | 'operation_fields'
+  | 'baker_performance'
+  | 'baker_performance_fields'
+  | 'balance_updates'
+  | 'balance_update_fields'
+  | 'upcoming_rights'
+  | 'upcoming_rights_fields'
+  | 'mempool'
+  | 'mempool_fields'
+  | 'mempool_operations'
+  | 'mempool_operation_fields'
+  | 'diagnostics';